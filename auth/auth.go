@@ -2,9 +2,15 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -14,17 +20,49 @@ import (
 
 var jwtKey = []byte("QXR0cUZYZjM5STB3NzNubE1jdVhYTVBxNjhQR3JaWWF5NGt4RkZYRXlwcHhTSEQ2dw==")
 
+// accessTokenAudience marks tokens that grant access to the API
+const accessTokenAudience = "access"
+
+// mfaChallengeAudience marks tokens that only allow completing a two-factor login
+const mfaChallengeAudience = "mfa"
+
+// MFAChallengeTTL is how long a user has to enter their two-factor code after their password
+const MFAChallengeTTL = 5 * time.Minute
+
+// AccessTokenTTL is how long an access token is valid; override with ACCESS_TOKEN_TTL (e.g. "30m").
+// It is kept short so that revoked sessions and role changes take effect quickly; clients get a new
+// access token with their refresh token when it expires.
+var AccessTokenTTL = durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+
+// RefreshTokenTTL is how long a refresh token is valid; override with REFRESH_TOKEN_TTL (e.g. "720h")
+var RefreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
 type Claims struct {
-	Username string `json:"username"`
-	UserID   string `json:"userId"`
+	Username  string   `json:"username"`
+	UserID    string   `json:"userId"`
+	Roles     []string `json:"roles,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateJWT(userID uint) (string, error) {
+// GenerateAccessToken issues a short-lived access token for a user's session carrying the user's roles.
+// The token ID (jti) is returned so the token can be revoked individually.
+func GenerateAccessToken(userID uint, sessionID string, roles []string) (string, *Claims, error) {
+	tokenID, err := NewTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
 	claims := &Claims{
-		UserID: strconv.FormatUint(uint64(userID), 10),
+		UserID:    strconv.FormatUint(uint64(userID), 10),
+		Roles:     roles,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+			Id:        tokenID,
+			Audience:  accessTokenAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
 		},
 	}
 
@@ -32,63 +70,127 @@ func GenerateJWT(userID uint) (string, error) {
 	signedToken, err := token.SignedString(jwtKey)
 	if err != nil {
 		log.Printf("Error signing token: %v\n", err)
-		return "", err
+		return "", nil, err
 	}
 
-	log.Printf("Generated token: %s\n", signedToken)
-	log.Printf("Secret key used for signing: %s\n", string(jwtKey))
+	return signedToken, claims, nil
+}
 
-	return signedToken, nil
+// ParseAccessToken verifies an access token and returns its claims
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, accessTokenAudience)
 }
 
-// GetUserIDFromToken retrieves the user ID from the provided HTTP request's Authorization header token.
-func GetUserIDFromToken(r *http.Request) (int, error) {
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		log.Println("Authorization header missing")
-		return 0, errors.New("authorization header missing")
+// GenerateMFAChallenge issues a short-lived token proving that a user has entered their password,
+// which can only be exchanged for a session together with a valid two-factor code
+func GenerateMFAChallenge(userID uint) (string, error) {
+	tokenID, err := NewTokenID()
+	if err != nil {
+		return "", err
 	}
 
-	// Remove the "Bearer " prefix from the token string
-	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+	now := time.Now()
+	claims := &Claims{
+		UserID: strconv.FormatUint(uint64(userID), 10),
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenID,
+			Audience:  mfaChallengeAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(MFAChallengeTTL).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+}
+
+// ParseMFAChallenge verifies a two-factor challenge token and returns the principal it was issued to.
+// The principal's token ID lets the challenge be revoked once it has been used.
+func ParseMFAChallenge(tokenString string) (*Principal, error) {
+	claims, err := parseToken(tokenString, mfaChallengeAudience)
+	if err != nil {
+		return nil, err
+	}
+	return PrincipalFromClaims(claims)
+}
 
+// parseToken verifies a signed token issued for the given audience and returns its claims
+func parseToken(tokenString, audience string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
 		return jwtKey, nil
 	})
 	if err != nil {
-		log.Printf("Error parsing token: %v\n", err)
-		return 0, err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		// Extract the user ID from the token claims
-		userID, err := strconv.Atoi(claims.UserID)
-		if err != nil {
-			log.Printf("Error converting user ID to integer: %v\n", err)
-			return 0, err
-		}
-		return userID, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
 	}
-	log.Println("Invalid token")
-	return 0, errors.New("invalid token")
+	if !claims.VerifyAudience(audience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+	return claims, nil
 }
 
-// VerifyToken verifies the provided JWT token and returns the user ID if the token is valid.
-func VerifyToken(tokenString string) (int, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil {
-		return 0, err
+// ParseRequestToken verifies the bearer token in the request's Authorization header and returns its claims
+func ParseRequestToken(r *http.Request) (*Claims, error) {
+	tokenString := r.Header.Get("Authorization")
+	if tokenString == "" {
+		return nil, errors.New("authorization header missing")
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		userID, err := strconv.Atoi(claims.UserID)
-		if err != nil {
-			return 0, err
-		}
-		return userID, nil
+	// Remove the "Bearer " prefix from the token string
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+	return ParseAccessToken(tokenString)
+}
+
+// *************************** Refresh Tokens ***************************
+
+// GenerateRefreshToken creates an opaque refresh token and the hash under which it is stored
+func GenerateRefreshToken() (token, tokenHash string, err error) {
+	return GenerateOpaqueToken()
+}
+
+// GenerateOpaqueToken creates a random URL-safe token, such as a password reset token,
+// and the hash under which it is stored
+func GenerateOpaqueToken() (token, tokenHash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the SHA-256 hash of an opaque token as stored in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenID generates a random identifier for tokens and sessions
+func NewTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(buf), nil
+}
 
-	return 0, errors.New("invalid token")
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid %s %q, using default %s", name, value, fallback)
+		return fallback
+	}
+	return duration
 }
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Principal is the authenticated identity attached to a request
+type Principal struct {
+	UserID    uint
+	Roles     []string
+	TokenID   string
+	SessionID string
+	ExpiresAt time.Time
+}
+
+// HasRole reports whether the principal holds the given role
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+// PrincipalFromClaims builds the principal described by verified access token claims
+func PrincipalFromClaims(claims *Claims) (*Principal, error) {
+	userID, err := strconv.ParseUint(claims.UserID, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid user ID in token")
+	}
+
+	return &Principal{
+		UserID:    uint(userID),
+		Roles:     claims.Roles,
+		TokenID:   claims.Id,
+		SessionID: claims.SessionID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal stored by the auth middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,196 @@
+// Package avatar turns uploaded profile photos into square JPEG thumbnails.
+//
+// Uploads are decoded and re-encoded rather than stored as sent, so that nothing but pixels
+// survives: EXIF metadata such as GPS coordinates and camera details is dropped, as is anything
+// hidden after the image data. The EXIF orientation of JPEGs is applied first so that photos
+// taken with a rotated phone still appear the right way up.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Thumbnail sizes in pixels; every avatar is stored at each size
+const (
+	SizeLarge  = 512
+	SizeMedium = 256
+	SizeSmall  = 64
+)
+
+// Sizes lists the thumbnail sizes made of every avatar, largest first
+var Sizes = []int{SizeLarge, SizeMedium, SizeSmall}
+
+const (
+	// MaxUploadBytes is the largest upload accepted
+	MaxUploadBytes = 5 << 20
+	// MaxPixels is the most pixels accepted, which bounds the memory needed to decode an upload to
+	// 64 MB whatever the shape of the image
+	MaxPixels = 4096 * 4096
+	// MinDimension is the smallest width or height accepted
+	MinDimension = SizeSmall
+	// jpegQuality is the quality thumbnails are encoded at
+	jpegQuality = 85
+)
+
+// formats are the image formats accepted, as named by the image package
+var formats = map[string]bool{"jpeg": true, "png": true, "webp": true}
+
+var (
+	// ErrUnsupportedFormat is returned for uploads that aren't a JPEG, PNG or WebP image
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooLarge is returned for images with more than MaxPixels pixels
+	ErrTooLarge = errors.New("image too large")
+	// ErrTooSmall is returned for images narrower or shorter than MinDimension
+	ErrTooSmall = errors.New("image too small")
+)
+
+// Process decodes an uploaded image and returns a JPEG thumbnail for each of Sizes, cropped to a
+// square from the centre of the image. Transparent areas are filled with white.
+func Process(data []byte) (map[int][]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !formats[format] {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	if config.Width < MinDimension || config.Height < MinDimension {
+		return nil, ErrTooSmall
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	crop := centreSquare(img.Bounds())
+	thumbnails := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		thumbnail := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.Draw(thumbnail, thumbnail.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, crop, draw.Over, nil)
+
+		// A centre square crop looks the same whichever way up the image is, so orienting the small
+		// thumbnail gives the same result as orienting the whole upload first
+		var encoded bytes.Buffer
+		if err := jpeg.Encode(&encoded, orient(thumbnail, orientation), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		thumbnails[size] = encoded.Bytes()
+	}
+	return thumbnails, nil
+}
+
+// centreSquare returns the largest square in the middle of bounds
+func centreSquare(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	min := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(side, side))}
+}
+
+// orient transforms a square image according to an EXIF orientation so that it displays upright
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	n := img.Bounds().Dx()
+	oriented := image.NewRGBA(img.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = n-1-x, y
+			case 3: // rotated 180°
+				dx, dy = n-1-x, n-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, n-1-y
+			case 5: // mirrored along the top-left to bottom-right diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° anticlockwise, so turn clockwise
+				dx, dy = n-1-y, x
+			case 7: // mirrored along the top-right to bottom-left diagonal
+				dx, dy = n-1-y, n-1-x
+			case 8: // rotated 90° clockwise, so turn anticlockwise
+				dx, dy = y, n-1-x
+			}
+			oriented.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+	return oriented
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, returning 1 (upright) when there isn't one
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the marker segments before the image data looking for the APP1 segment holding EXIF
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag (0x0112) from the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var u16 func([]byte) int
+	var u32 func([]byte) int
+	switch string(tiff[:2]) {
+	case "II":
+		u16 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 }
+		u32 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24 }
+	case "MM":
+		u16 = func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+		u32 = func(b []byte) int { return int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3]) }
+	default:
+		return 1
+	}
+
+	offset := u32(tiff[4:8])
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := u16(tiff[offset:])
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if u16(tiff[entry:]) == 0x0112 {
+			return u16(tiff[entry+8:])
+		}
+	}
+	return 1
+}
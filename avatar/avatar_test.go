@@ -0,0 +1,192 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// halves returns a square image whose top half is red and bottom half is blue
+func halves(n int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, n, n))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if y < n/2 {
+				img.SetRGBA(x, y, red)
+			} else {
+				img.SetRGBA(x, y, blue)
+			}
+		}
+	}
+	return img
+}
+
+// exifSegment returns an APP1 segment holding EXIF with just an orientation tag, in the given
+// byte order ("II" or "MM")
+func exifSegment(order string, orientation uint16) []byte {
+	var byteOrder binary.AppendByteOrder = binary.LittleEndian
+	if order == "MM" {
+		byteOrder = binary.BigEndian
+	}
+
+	tiff := []byte(order)
+	tiff = byteOrder.AppendUint16(tiff, 42)
+	tiff = byteOrder.AppendUint32(tiff, 8)
+	tiff = byteOrder.AppendUint16(tiff, 1)
+	tiff = byteOrder.AppendUint16(tiff, 0x0112)
+	tiff = byteOrder.AppendUint16(tiff, 3)
+	tiff = byteOrder.AppendUint32(tiff, 1)
+	tiff = byteOrder.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// jpegWithExif encodes img as a JPEG with an EXIF segment straight after the start of image marker
+func jpegWithExif(t *testing.T, img image.Image, order string, orientation uint16) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("encoding JPEG: %v", err)
+	}
+	data := encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), exifSegment(order, orientation)...), data[2:]...)
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	return encoded.Bytes()
+}
+
+// isRed reports whether a pixel of a decoded thumbnail is mostly red rather than blue
+func isRed(img image.Image, x, y int) bool {
+	r, _, b, _ := img.At(x, y).RGBA()
+	return r > b
+}
+
+func TestJpegOrientation(t *testing.T) {
+	img := halves(8)
+	for _, order := range []string{"II", "MM"} {
+		for _, orientation := range []uint16{1, 3, 6, 8} {
+			if got := jpegOrientation(jpegWithExif(t, img, order, orientation)); got != int(orientation) {
+				t.Errorf("jpegOrientation() in %s order = %d, want %d", order, got, orientation)
+			}
+		}
+	}
+
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, img, nil); err != nil {
+		t.Fatalf("encoding JPEG: %v", err)
+	}
+	for name, data := range map[string][]byte{
+		"no EXIF":    plain.Bytes(),
+		"not a JPEG": encodePNG(t, img),
+		"truncated":  jpegWithExif(t, img, "II", 6)[:20],
+	} {
+		if got := jpegOrientation(data); got != 1 {
+			t.Errorf("jpegOrientation() of %s = %d, want 1", name, got)
+		}
+	}
+}
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	// Each orientation maps the stored red top half to the side that should be shown
+	tests := []struct {
+		orientation uint16
+		redAt       image.Point
+		blueAt      image.Point
+	}{
+		{orientation: 1, redAt: image.Pt(32, 8), blueAt: image.Pt(32, 56)},
+		{orientation: 3, redAt: image.Pt(32, 56), blueAt: image.Pt(32, 8)},
+		{orientation: 6, redAt: image.Pt(56, 32), blueAt: image.Pt(8, 32)},
+		{orientation: 8, redAt: image.Pt(8, 32), blueAt: image.Pt(56, 32)},
+	}
+
+	for _, tt := range tests {
+		for _, order := range []string{"II", "MM"} {
+			thumbnails, err := Process(jpegWithExif(t, halves(128), order, tt.orientation))
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			small, err := jpeg.Decode(bytes.NewReader(thumbnails[SizeSmall]))
+			if err != nil {
+				t.Fatalf("decoding thumbnail: %v", err)
+			}
+			if !isRed(small, tt.redAt.X, tt.redAt.Y) || isRed(small, tt.blueAt.X, tt.blueAt.Y) {
+				t.Errorf("orientation %d in %s order: want red at %v and blue at %v", tt.orientation, order, tt.redAt, tt.blueAt)
+			}
+		}
+	}
+}
+
+func TestProcessStripsMetadata(t *testing.T) {
+	data := append(jpegWithExif(t, halves(128), "MM", 6), []byte("hidden after the image")...)
+
+	thumbnails, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if len(thumbnails) != len(Sizes) {
+		t.Fatalf("Process() made %d thumbnails, want %d", len(thumbnails), len(Sizes))
+	}
+	for _, size := range Sizes {
+		thumbnail := thumbnails[size]
+		if bytes.Contains(thumbnail, []byte("Exif")) || bytes.Contains(thumbnail, []byte{0xFF, 0xE1}) {
+			t.Errorf("%dpx thumbnail kept the EXIF segment", size)
+		}
+		if bytes.Contains(thumbnail, []byte("hidden after the image")) {
+			t.Errorf("%dpx thumbnail kept the data after the image", size)
+		}
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+		if err != nil {
+			t.Fatalf("decoding %dpx thumbnail: %v", size, err)
+		}
+		if config.Width != size || config.Height != size {
+			t.Errorf("%dpx thumbnail is %dx%d", size, config.Width, config.Height)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "not an image", data: []byte("GIF89a not really"), want: ErrUnsupportedFormat},
+		{name: "too many pixels", data: encodePNG(t, image.NewGray(image.Rect(0, 0, 4097, 4097))), want: ErrTooLarge},
+		{name: "too narrow", data: encodePNG(t, image.NewGray(image.Rect(0, 0, MinDimension-1, 512))), want: ErrTooSmall},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data); err != tt.want {
+				t.Errorf("Process() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// A long thin image under the pixel limit is accepted
+	if _, err := Process(encodePNG(t, image.NewGray(image.Rect(0, 0, 8192, MinDimension)))); err != nil {
+		t.Errorf("Process() of an 8192x%d image = %v, want it accepted", MinDimension, err)
+	}
+}
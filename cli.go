@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"event-connect/models"
+	"event-connect/oidc"
+	"event-connect/repositories"
+)
+
+// runCommand runs a maintenance command given on the command line instead of starting the server
+func runCommand(args []string, userRepo *repositories.UserRepository, roleRepo *repositories.RoleRepository) error {
+	switch args[0] {
+	case "grant-admin":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: grant-admin <username>")
+		}
+		return grantAdmin(args[1], userRepo, roleRepo)
+	case "oidc-dev-provider":
+		addr := "localhost:9000"
+		if len(args) == 2 {
+			addr = args[1]
+		} else if len(args) > 2 {
+			return fmt.Errorf("usage: oidc-dev-provider [address]")
+		}
+		return runDevProvider(addr)
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// grantAdmin gives the named user the admin role, bootstrapping the first admin account
+func grantAdmin(username string, userRepo *repositories.UserRepository, roleRepo *repositories.RoleRepository) error {
+	userID, err := userRepo.GetUserIDByUsername(username)
+	if err != nil {
+		return fmt.Errorf("looking up user %q: %w", username, err)
+	}
+
+	if err := roleRepo.GrantRole(userID, models.RoleAdmin); err != nil {
+		return fmt.Errorf("granting admin role to %q: %w", username, err)
+	}
+
+	log.Printf("Granted admin role to %s (user ID %d); it takes effect from their next login or token refresh", username, userID)
+	return nil
+}
+
+// runDevProvider serves a stand-in OpenID Connect provider for trying "sign in with" locally
+func runDevProvider(addr string) error {
+	provider, err := oidc.NewDevProvider("http://" + addr)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Development OpenID Connect provider listening on http://%s", addr)
+	return http.ListenAndServe(addr, provider)
+}
@@ -0,0 +1,113 @@
+// Package draw implements the committed-seed selection algorithm used for raffle draws.
+//
+// A random seed is generated when a raffle is configured and only its SHA-256 hash is
+// published while entries are open. Once entries close the seed is revealed, and anyone
+// can recompute the result from the seed and the published list of entrants:
+//
+//  1. Check that hex(SHA-256(seed)) equals the published seed hash.
+//  2. Sort the entrant user IDs in ascending numeric order.
+//  3. For each user ID compute hex(SHA-256(seed + ":" + userID)).
+//  4. Order the entrants by that hex string ascending (user ID breaks ties).
+//  5. The first `places` entrants win; the rest form the waitlist in that order.
+package draw
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
+// Algorithm identifies the selection algorithm stored with each draw record
+const Algorithm = "sha256-rank-v1"
+
+// Description explains how to recompute a draw from its published data
+const Description = "Check hex(SHA-256(seed)) equals seedHash. Sort entrant user IDs ascending, " +
+	"compute hex(SHA-256(seed + \":\" + userId)) for each, order entrants by that value ascending " +
+	"(user ID breaks ties). The first `places` entrants win; the remainder form the waitlist in order."
+
+// NewSeed generates a random seed and the hash that is published before entries close
+func NewSeed() (seed, seedHash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	seed = hex.EncodeToString(buf)
+	return seed, HashSeed(seed), nil
+}
+
+// HashSeed returns the commitment published for a seed
+func HashSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// SortEntrants returns the entrant user IDs in the canonical ascending order
+func SortEntrants(userIDs []uint) []uint {
+	sorted := append([]uint(nil), userIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// Select deterministically ranks the entrants using the seed and splits them into
+// winners and waitlist
+func Select(seed string, userIDs []uint, places int) (winners, waitlist []uint) {
+	type rankedEntrant struct {
+		userID uint
+		key    string
+	}
+
+	ranked := make([]rankedEntrant, 0, len(userIDs))
+	for _, userID := range SortEntrants(userIDs) {
+		sum := sha256.Sum256([]byte(seed + ":" + strconv.FormatUint(uint64(userID), 10)))
+		ranked = append(ranked, rankedEntrant{userID: userID, key: hex.EncodeToString(sum[:])})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].key == ranked[j].key {
+			return ranked[i].userID < ranked[j].userID
+		}
+		return ranked[i].key < ranked[j].key
+	})
+
+	if places > len(ranked) {
+		places = len(ranked)
+	}
+	if places < 0 {
+		places = 0
+	}
+
+	winners = make([]uint, 0, places)
+	waitlist = make([]uint, 0, len(ranked)-places)
+	for i, entrant := range ranked {
+		if i < places {
+			winners = append(winners, entrant.userID)
+		} else {
+			waitlist = append(waitlist, entrant.userID)
+		}
+	}
+	return winners, waitlist
+}
+
+// Verify recomputes a draw from its published data and reports whether it matches
+func Verify(seed, seedHash string, userIDs []uint, places int, winners, waitlist []uint) bool {
+	if HashSeed(seed) != seedHash {
+		return false
+	}
+
+	expectedWinners, expectedWaitlist := Select(seed, userIDs, places)
+	return equalIDs(expectedWinners, winners) && equalIDs(expectedWaitlist, waitlist)
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package draw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+const testSeed = "5f0c6d1b3a2e4f8d9c7b6a5e4d3c2b1a0f9e8d7c6b5a4e3d2c1b0a9f8e7d6c5b"
+
+// rankByDescription ranks entrants by following the published description step by step, separately
+// from Select
+func rankByDescription(seed string, userIDs []uint) []uint {
+	keys := make(map[uint]string)
+	ranked := append([]uint(nil), userIDs...)
+	for _, userID := range ranked {
+		sum := sha256.Sum256([]byte(seed + ":" + strconv.FormatUint(uint64(userID), 10)))
+		keys[userID] = hex.EncodeToString(sum[:])
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if keys[ranked[i]] == keys[ranked[j]] {
+			return ranked[i] < ranked[j]
+		}
+		return keys[ranked[i]] < keys[ranked[j]]
+	})
+	return ranked
+}
+
+func TestSelectFollowsDescription(t *testing.T) {
+	entrants := []uint{4, 8, 15, 16, 23, 42, 108}
+	ranked := rankByDescription(testSeed, entrants)
+
+	winners, waitlist := Select(testSeed, entrants, 3)
+	if !reflect.DeepEqual(winners, ranked[:3]) || !reflect.DeepEqual(waitlist, ranked[3:]) {
+		t.Errorf("Select() = %v, %v, want %v, %v", winners, waitlist, ranked[:3], ranked[3:])
+	}
+}
+
+func TestSelectIsDeterministic(t *testing.T) {
+	entrants := []uint{4, 8, 15, 16, 23, 42, 108}
+	shuffled := []uint{42, 108, 4, 23, 16, 8, 15}
+
+	winners, waitlist := Select(testSeed, entrants, 3)
+	for i := 0; i < 3; i++ {
+		againWinners, againWaitlist := Select(testSeed, shuffled, 3)
+		if !reflect.DeepEqual(winners, againWinners) || !reflect.DeepEqual(waitlist, againWaitlist) {
+			t.Fatalf("Select() = %v, %v, then %v, %v for the same seed", winners, waitlist, againWinners, againWaitlist)
+		}
+	}
+
+	otherWinners, otherWaitlist := Select(testSeed+"0", entrants, 3)
+	if reflect.DeepEqual(append(winners, waitlist...), append(otherWinners, otherWaitlist...)) {
+		t.Error("Select() ranked the entrants the same way for another seed")
+	}
+}
+
+func TestSelectPlaces(t *testing.T) {
+	entrants := []uint{1, 2, 3}
+	tests := []struct {
+		places        int
+		winners, wait int
+	}{
+		{places: 0, winners: 0, wait: 3},
+		{places: 2, winners: 2, wait: 1},
+		{places: 5, winners: 3, wait: 0},
+		{places: -1, winners: 0, wait: 3},
+	}
+
+	for _, tt := range tests {
+		winners, waitlist := Select(testSeed, entrants, tt.places)
+		if len(winners) != tt.winners || len(waitlist) != tt.wait {
+			t.Errorf("Select() with %d places = %d winners and %d waitlisted, want %d and %d",
+				tt.places, len(winners), len(waitlist), tt.winners, tt.wait)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	seed, seedHash, err := NewSeed()
+	if err != nil {
+		t.Fatalf("NewSeed: %v", err)
+	}
+	if HashSeed(seed) != seedHash {
+		t.Fatalf("HashSeed(seed) = %s, want the hash NewSeed returned", HashSeed(seed))
+	}
+
+	entrants := []uint{3, 1, 4, 5, 9, 2, 6}
+	winners, waitlist := Select(seed, entrants, 2)
+
+	if !Verify(seed, seedHash, entrants, 2, winners, waitlist) {
+		t.Error("Verify rejected a genuine draw")
+	}
+	if Verify(seed, HashSeed("another seed"), entrants, 2, winners, waitlist) {
+		t.Error("Verify accepted a seed that doesn't match the published hash")
+	}
+	swapped := append([]uint{waitlist[0]}, winners[1:]...)
+	if Verify(seed, seedHash, entrants, 2, swapped, append([]uint{winners[0]}, waitlist[1:]...)) {
+		t.Error("Verify accepted a draw with a winner swapped for a waitlisted entrant")
+	}
+	if Verify(seed, seedHash, entrants, 3, winners, waitlist) {
+		t.Error("Verify accepted a draw for a different number of places")
+	}
+}
@@ -0,0 +1,164 @@
+// Package eligibility evaluates the per-event rules that restrict who may enter a raffle.
+//
+// Rules are stored per event as a JSON array, for example:
+//
+//	[
+//	  {"type": "age_range", "min": 18, "max": 30},
+//	  {"type": "max_distance", "maxDistanceKm": 50},
+//	  {"type": "registered_for_event"},
+//	  {"type": "unique_email_domain", "exemptDomains": ["gmail.com"]}
+//	]
+//
+// Every rule must pass for a user to be eligible.
+package eligibility
+
+import (
+	"fmt"
+	"strings"
+
+	"event-connect/geo"
+)
+
+// Rule types
+const (
+	RuleAgeRange           = "age_range"
+	RuleMaxDistance        = "max_distance"
+	RuleRegisteredForEvent = "registered_for_event"
+	RuleUniqueEmailDomain  = "unique_email_domain"
+)
+
+// Rule is a single eligibility rule definition
+type Rule struct {
+	Type          string   `json:"type"`
+	Min           *int     `json:"min,omitempty"`
+	Max           *int     `json:"max,omitempty"`
+	MaxDistanceKm float64  `json:"maxDistanceKm,omitempty"`
+	ExemptDomains []string `json:"exemptDomains,omitempty"`
+}
+
+// Candidate is the data about a user that rules are evaluated against
+type Candidate struct {
+	UserID             uint
+	Age                int
+	Latitude           float64
+	Longitude          float64
+	Email              string
+	RegisteredForEvent bool
+}
+
+// Event is the data about an event that rules are evaluated against
+type Event struct {
+	VenueLatitude  float64
+	VenueLongitude float64
+	HasVenue       bool
+	// TakenEmailDomains maps the email domains of users who have already entered to their user IDs
+	TakenEmailDomains map[string][]uint
+}
+
+// Failure describes the rule a candidate did not satisfy
+type Failure struct {
+	Index  int    `json:"ruleIndex"`
+	Rule   Rule   `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// Validate checks that a rule set is well formed
+func Validate(rules []Rule) error {
+	for i, rule := range rules {
+		switch rule.Type {
+		case RuleAgeRange:
+			if rule.Min == nil && rule.Max == nil {
+				return fmt.Errorf("rule %d: age_range requires min or max", i)
+			}
+			if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+				return fmt.Errorf("rule %d: age_range min must not exceed max", i)
+			}
+		case RuleMaxDistance:
+			if rule.MaxDistanceKm <= 0 {
+				return fmt.Errorf("rule %d: max_distance requires a positive maxDistanceKm", i)
+			}
+		case RuleRegisteredForEvent, RuleUniqueEmailDomain:
+		default:
+			return fmt.Errorf("rule %d: unknown rule type %q", i, rule.Type)
+		}
+	}
+	return nil
+}
+
+// Evaluate checks a candidate against every rule and returns the first failure, or nil if eligible
+func Evaluate(rules []Rule, candidate Candidate, event Event) *Failure {
+	for i, rule := range rules {
+		if reason := evaluateRule(rule, candidate, event); reason != "" {
+			return &Failure{Index: i, Rule: rule, Reason: reason}
+		}
+	}
+	return nil
+}
+
+func evaluateRule(rule Rule, candidate Candidate, event Event) string {
+	switch rule.Type {
+	case RuleAgeRange:
+		if rule.Min != nil && candidate.Age < *rule.Min {
+			return fmt.Sprintf("You must be at least %d to enter this raffle", *rule.Min)
+		}
+		if rule.Max != nil && candidate.Age > *rule.Max {
+			return fmt.Sprintf("You must be %d or younger to enter this raffle", *rule.Max)
+		}
+	case RuleMaxDistance:
+		if !event.HasVenue {
+			return "The venue location for this event is unknown"
+		}
+		distance := geo.DistanceKm(candidate.Latitude, candidate.Longitude, event.VenueLatitude, event.VenueLongitude)
+		if distance > rule.MaxDistanceKm {
+			return fmt.Sprintf("You must live within %.0f km of the venue to enter this raffle", rule.MaxDistanceKm)
+		}
+	case RuleRegisteredForEvent:
+		if !candidate.RegisteredForEvent {
+			return "You must be registered for this event to enter the raffle"
+		}
+	case RuleUniqueEmailDomain:
+		domain := EmailDomain(candidate.Email)
+		if isExempt(domain, rule.ExemptDomains) {
+			return ""
+		}
+		// A candidate's own entry doesn't count against them
+		for _, userID := range event.TakenEmailDomains[domain] {
+			if userID != candidate.UserID {
+				return "Someone with the same email domain has already entered this raffle"
+			}
+		}
+	default:
+		return fmt.Sprintf("Unknown rule type %q", rule.Type)
+	}
+	return ""
+}
+
+// ReservedEmailDomain returns the email domain an entry with this email takes up under the rules,
+// or "" when the rules don't limit entries per domain or the domain is exempt
+func ReservedEmailDomain(rules []Rule, email string) string {
+	domain := EmailDomain(email)
+	for _, rule := range rules {
+		if rule.Type == RuleUniqueEmailDomain && domain != "" && !isExempt(domain, rule.ExemptDomains) {
+			return domain
+		}
+	}
+	return ""
+}
+
+// EmailDomain returns the lower-cased domain part of an email address
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+func isExempt(domain string, exempt []string) bool {
+	for _, d := range exempt {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package eligibility
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"event-connect/geo"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// kmPerDegree is the length of a degree of latitude on the sphere geo.DistanceKm uses
+const kmPerDegree = 6371 * math.Pi / 180
+
+var venue = Event{VenueLatitude: 51.5, VenueLongitude: -0.1, HasVenue: true}
+
+// candidateNorth returns a candidate living km kilometers north of the test venue
+func candidateNorth(km float64) Candidate {
+	return Candidate{UserID: 1, Latitude: venue.VenueLatitude + km/kmPerDegree, Longitude: venue.VenueLongitude}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{name: "no rules", rules: `[]`},
+		{name: "every rule type", rules: `[{"type": "age_range", "min": 18, "max": 30}, {"type": "max_distance", "maxDistanceKm": 50},
+			{"type": "registered_for_event"}, {"type": "unique_email_domain", "exemptDomains": ["gmail.com"]}]`},
+		{name: "age range with only a minimum", rules: `[{"type": "age_range", "min": 18}]`},
+		{name: "age range of a single age", rules: `[{"type": "age_range", "min": 21, "max": 21}]`},
+		{name: "age range without bounds", rules: `[{"type": "age_range"}]`, wantErr: true},
+		{name: "age range with min above max", rules: `[{"type": "age_range", "min": 30, "max": 18}]`, wantErr: true},
+		{name: "max distance without a distance", rules: `[{"type": "max_distance"}]`, wantErr: true},
+		{name: "max distance below zero", rules: `[{"type": "max_distance", "maxDistanceKm": -5}]`, wantErr: true},
+		{name: "unknown type", rules: `[{"type": "min_height", "min": 150}]`, wantErr: true},
+		{name: "missing type", rules: `[{"min": 18}]`, wantErr: true},
+		{name: "invalid rule after a valid one", rules: `[{"type": "registered_for_event"}, {"type": "age_range"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []Rule
+			if err := json.Unmarshal([]byte(tt.rules), &rules); err != nil {
+				t.Fatalf("decoding rules: %v", err)
+			}
+			if err := Validate(rules); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMalformedRulesDontDecode(t *testing.T) {
+	for _, rules := range []string{
+		`{"type": "age_range", "min": 18}`,
+		`[{"type": "age_range", "min": "18"}]`,
+		`[{"type": "age_range", "min": 18.5}]`,
+		`[{"type": "max_distance", "maxDistanceKm": "50"}]`,
+		`[{"type": "unique_email_domain", "exemptDomains": "gmail.com"}]`,
+		`[{"type": "age_range"`,
+	} {
+		var decoded []Rule
+		if err := json.Unmarshal([]byte(rules), &decoded); err == nil {
+			t.Errorf("decoding %s succeeded, want an error", rules)
+		}
+	}
+}
+
+func TestEvaluateAgeRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		age      int
+		eligible bool
+	}{
+		{name: "below the minimum", rule: Rule{Type: RuleAgeRange, Min: intPtr(18), Max: intPtr(30)}, age: 17},
+		{name: "at the minimum", rule: Rule{Type: RuleAgeRange, Min: intPtr(18), Max: intPtr(30)}, age: 18, eligible: true},
+		{name: "at the maximum", rule: Rule{Type: RuleAgeRange, Min: intPtr(18), Max: intPtr(30)}, age: 30, eligible: true},
+		{name: "above the maximum", rule: Rule{Type: RuleAgeRange, Min: intPtr(18), Max: intPtr(30)}, age: 31},
+		{name: "no maximum", rule: Rule{Type: RuleAgeRange, Min: intPtr(18)}, age: 99, eligible: true},
+		{name: "no minimum", rule: Rule{Type: RuleAgeRange, Max: intPtr(30)}, age: 16, eligible: true},
+		{name: "no age given", rule: Rule{Type: RuleAgeRange, Min: intPtr(18)}, age: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := Evaluate([]Rule{tt.rule}, Candidate{UserID: 1, Age: tt.age}, Event{})
+			if (failure == nil) != tt.eligible {
+				t.Errorf("Evaluate() = %+v, want eligible %v", failure, tt.eligible)
+			}
+		})
+	}
+}
+
+func TestEvaluateMaxDistance(t *testing.T) {
+	rules := []Rule{{Type: RuleMaxDistance, MaxDistanceKm: 50}}
+
+	tests := []struct {
+		name      string
+		candidate Candidate
+		event     Event
+		eligible  bool
+	}{
+		{name: "at the venue", candidate: candidateNorth(0), event: venue, eligible: true},
+		{name: "just inside the limit", candidate: candidateNorth(49.9), event: venue, eligible: true},
+		{name: "just beyond the limit", candidate: candidateNorth(50.1), event: venue},
+		{name: "venue unknown", candidate: candidateNorth(0), event: Event{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := Evaluate(rules, tt.candidate, tt.event)
+			if (failure == nil) != tt.eligible {
+				distance := geo.DistanceKm(tt.candidate.Latitude, tt.candidate.Longitude, tt.event.VenueLatitude, tt.event.VenueLongitude)
+				t.Errorf("Evaluate() at %.2fkm = %+v, want eligible %v", distance, failure, tt.eligible)
+			}
+		})
+	}
+}
+
+func TestEvaluateRegisteredForEvent(t *testing.T) {
+	rules := []Rule{{Type: RuleRegisteredForEvent}}
+	if failure := Evaluate(rules, Candidate{UserID: 1, RegisteredForEvent: true}, Event{}); failure != nil {
+		t.Errorf("Evaluate() for a registered user = %+v, want eligible", failure)
+	}
+	if failure := Evaluate(rules, Candidate{UserID: 1}, Event{}); failure == nil {
+		t.Error("Evaluate() for an unregistered user = eligible, want a failure")
+	}
+}
+
+func TestEvaluateUniqueEmailDomain(t *testing.T) {
+	rules := []Rule{{Type: RuleUniqueEmailDomain, ExemptDomains: []string{"GMail.com"}}}
+	event := Event{TakenEmailDomains: map[string][]uint{"example.com": {2}, "gmail.com": {3}, "own.org": {1}}}
+
+	tests := []struct {
+		name     string
+		email    string
+		eligible bool
+	}{
+		{name: "domain taken by someone else", email: "ada@example.com"},
+		{name: "domain taken regardless of case and spacing", email: "Ada@EXAMPLE.com "},
+		{name: "domain free", email: "ada@example.org", eligible: true},
+		{name: "domain taken by the candidate's own entry", email: "ada@own.org", eligible: true},
+		{name: "exempt domain regardless of case", email: "ada@gmail.COM", eligible: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := Evaluate(rules, Candidate{UserID: 1, Email: tt.email}, event)
+			if (failure == nil) != tt.eligible {
+				t.Errorf("Evaluate() = %+v, want eligible %v", failure, tt.eligible)
+			}
+		})
+	}
+}
+
+func TestEvaluateReportsFirstFailure(t *testing.T) {
+	rules := []Rule{
+		{Type: RuleRegisteredForEvent},
+		{Type: RuleAgeRange, Min: intPtr(18)},
+		{Type: RuleMaxDistance, MaxDistanceKm: 10},
+	}
+	candidate := candidateNorth(20)
+	candidate.Age = 16
+	candidate.RegisteredForEvent = true
+
+	failure := Evaluate(rules, candidate, venue)
+	if failure == nil || failure.Index != 1 || failure.Rule.Type != RuleAgeRange || failure.Reason == "" {
+		t.Errorf("Evaluate() = %+v, want the age range rule at index 1", failure)
+	}
+}
+
+func TestEmailDomain(t *testing.T) {
+	tests := []struct {
+		email, want string
+	}{
+		{"ada@example.com", "example.com"},
+		{"Ada@Example.COM", "example.com"},
+		{"ada@example.com ", "example.com"},
+		{`"ada@home"@example.com`, "example.com"},
+		{"ada", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := EmailDomain(tt.email); got != tt.want {
+			t.Errorf("EmailDomain(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestReservedEmailDomain(t *testing.T) {
+	unique := []Rule{{Type: RuleAgeRange, Min: intPtr(18)}, {Type: RuleUniqueEmailDomain, ExemptDomains: []string{"gmail.com"}}}
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		email string
+		want  string
+	}{
+		{name: "domain reserved", rules: unique, email: "Ada@Example.com", want: "example.com"},
+		{name: "exempt domain", rules: unique, email: "ada@Gmail.com", want: ""},
+		{name: "no domain", rules: unique, email: "ada", want: ""},
+		{name: "no unique domain rule", rules: []Rule{{Type: RuleRegisteredForEvent}}, email: "ada@example.com", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReservedEmailDomain(tt.rules, tt.email); got != tt.want {
+				t.Errorf("ReservedEmailDomain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package geo provides geographic helpers shared across the application.
+package geo
+
+import "math"
+
+// earthRadiusKm is the mean radius of the Earth in kilometers
+const earthRadiusKm = 6371
+
+// DistanceKm returns the great-circle distance in kilometers between two coordinates
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	dlat := (lat2 - lat1) * math.Pi / 180
+	dlon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1Rad)*math.Cos(lat2Rad)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return earthRadiusKm * c
+}
@@ -0,0 +1,173 @@
+package geo
+
+import (
+	"embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrLocationNotFound is returned when a location can't be resolved
+var ErrLocationNotFound = errors.New("location not found")
+
+// maxReverseGeocodeKm is how far coordinates can be from the nearest known place and still be named after it
+const maxReverseGeocodeKm = 50
+
+// Place is a named location
+type Place struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder converts between free-text locations and coordinates
+type Geocoder interface {
+	// Geocode finds the place described by a free-text location such as "Leeds, UK" or a postcode
+	Geocode(query string) (*Place, error)
+	// ReverseGeocode finds the name of the place nearest to coordinates
+	ReverseGeocode(latitude, longitude float64) (*Place, error)
+}
+
+//go:embed data/uk_places.csv data/uk_postcode_areas.csv
+var placeData embed.FS
+
+// postcodePattern matches a full UK postcode or just its outward code, capturing the postcode area
+var postcodePattern = regexp.MustCompile(`^([a-z]{1,2})[0-9][0-9a-z]?(\s*[0-9][a-z]{2})?$`)
+
+// locationSuffixes are country names that are ignored when they are part of a location
+var locationSuffixes = map[string]bool{
+	"uk": true, "united kingdom": true, "gb": true, "great britain": true,
+	"england": true, "scotland": true, "wales": true, "northern ireland": true,
+}
+
+// OfflineGeocoder resolves UK towns, cities and postcodes from a bundled dataset without calling
+// an external service. Postcodes are resolved to the main town of their postcode area.
+type OfflineGeocoder struct {
+	places        []Place
+	placesByName  map[string]Place
+	postcodeAreas map[string]Place
+}
+
+// NewOfflineGeocoder loads the bundled place and postcode datasets
+func NewOfflineGeocoder() (*OfflineGeocoder, error) {
+	geocoder := &OfflineGeocoder{
+		placesByName:  make(map[string]Place),
+		postcodeAreas: make(map[string]Place),
+	}
+
+	places, err := readPlaces("data/uk_places.csv")
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range places {
+		geocoder.places = append(geocoder.places, record.place)
+		geocoder.placesByName[normaliseName(record.place.Name)] = record.place
+	}
+
+	areas, err := readPlaces("data/uk_postcode_areas.csv")
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range areas {
+		geocoder.postcodeAreas[strings.ToLower(record.key)] = record.place
+	}
+
+	return geocoder, nil
+}
+
+// Geocode tries each comma-separated part of the query as a postcode or place name, so that
+// "Didsbury, Manchester, UK" resolves to Manchester
+func (g *OfflineGeocoder) Geocode(query string) (*Place, error) {
+	for _, part := range strings.Split(query, ",") {
+		part = normaliseName(part)
+		if part == "" || locationSuffixes[part] {
+			continue
+		}
+
+		if place, ok := g.placesByName[part]; ok {
+			return &place, nil
+		}
+		if match := postcodePattern.FindStringSubmatch(part); match != nil {
+			if place, ok := g.postcodeAreas[match[1]]; ok {
+				return &place, nil
+			}
+		}
+	}
+	return nil, ErrLocationNotFound
+}
+
+// ReverseGeocode returns the nearest known place, if it is close enough to name the coordinates after
+func (g *OfflineGeocoder) ReverseGeocode(latitude, longitude float64) (*Place, error) {
+	var nearest *Place
+	nearestKm := float64(maxReverseGeocodeKm)
+	for i := range g.places {
+		distance := DistanceKm(latitude, longitude, g.places[i].Latitude, g.places[i].Longitude)
+		if distance <= nearestKm {
+			nearest, nearestKm = &g.places[i], distance
+		}
+	}
+	if nearest == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	place := Place{Name: nearest.Name, Latitude: latitude, Longitude: longitude}
+	return &place, nil
+}
+
+type placeRecord struct {
+	key   string
+	place Place
+}
+
+// readPlaces reads a bundled CSV file. Files with four columns have a lookup key before the place name.
+func readPlaces(name string) ([]placeRecord, error) {
+	file, err := placeData.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	var records []placeRecord
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+
+		var record placeRecord
+		if len(row) == 4 {
+			record.key, row = row[0], row[1:]
+		}
+		if len(row) != 3 {
+			return nil, fmt.Errorf("%s line %d: expected name, latitude and longitude", name, i+1)
+		}
+		latitude, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, i+1, err)
+		}
+		longitude, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", name, i+1, err)
+		}
+
+		record.place = Place{Name: row[0], Latitude: latitude, Longitude: longitude}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// normaliseName lowercases a place name and collapses punctuation and spacing so that
+// "Stoke on Trent" matches "Stoke-on-Trent"
+func normaliseName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("-", " ", ".", "", "'", "").Replace(name)
+	name = strings.TrimPrefix(name, "city of ")
+	return strings.Join(strings.Fields(name), " ")
+}
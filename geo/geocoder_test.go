@@ -0,0 +1,140 @@
+package geo
+
+import "testing"
+
+func newTestGeocoder(t *testing.T) *OfflineGeocoder {
+	t.Helper()
+
+	geocoder, err := NewOfflineGeocoder()
+	if err != nil {
+		t.Fatalf("NewOfflineGeocoder: %v", err)
+	}
+	return geocoder
+}
+
+func TestGeocode(t *testing.T) {
+	geocoder := newTestGeocoder(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "town", query: "Leeds", want: "Leeds"},
+		{name: "town in any case", query: "  mAnChEsTeR ", want: "Manchester"},
+		{name: "full postcode", query: "LS1 4AP", want: "Leeds"},
+		{name: "full postcode without a space", query: "ls14ap", want: "Leeds"},
+		{name: "outward code", query: "M1", want: "Manchester"},
+		{name: "one letter area with a lettered district", query: "W1A 1AA", want: "London"},
+		{name: "two letter area with a lettered district", query: "EC1A 1BB", want: "London"},
+		{name: "district before the town", query: "Didsbury, Manchester", want: "Manchester"},
+		{name: "street address before a postcode", query: "Flat 2, 10 Downing Street, SW1A 2AA", want: "London"},
+		{name: "first part that resolves wins", query: "Manchester, Leeds", want: "Manchester"},
+		{name: "country suffix", query: "Leeds, UK", want: "Leeds"},
+		{name: "country before the town", query: "England, Leeds", want: "Leeds"},
+		{name: "hyphens are optional", query: "Stoke on Trent", want: "Stoke-on-Trent"},
+		{name: "hyphens are accepted", query: "stoke-on-trent", want: "Stoke-on-Trent"},
+		{name: "city of prefix", query: "City of London", want: "London"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			place, err := geocoder.Geocode(tt.query)
+			if err != nil {
+				t.Fatalf("Geocode(%q): %v", tt.query, err)
+			}
+			if place.Name != tt.want {
+				t.Errorf("Geocode(%q) = %q, want %q", tt.query, place.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeocodeUnresolvable(t *testing.T) {
+	geocoder := newTestGeocoder(t)
+
+	queries := []string{
+		"",
+		" , ",
+		"Atlantis",
+		"UK",
+		"England, United Kingdom",
+		"QQ1 1AA",
+		"LS1 4A",
+		"LS1 4AP 5",
+		"Didsbury",
+	}
+	for _, query := range queries {
+		if place, err := geocoder.Geocode(query); err != ErrLocationNotFound {
+			t.Errorf("Geocode(%q) = %+v, %v, want ErrLocationNotFound", query, place, err)
+		}
+	}
+}
+
+func TestReverseGeocode(t *testing.T) {
+	geocoder := &OfflineGeocoder{places: []Place{{Name: "London", Latitude: 51.5074, Longitude: -0.1278}}}
+
+	tests := []struct {
+		name    string
+		km      float64
+		want    string
+		wantErr error
+	}{
+		{name: "at the place", km: 0, want: "London"},
+		{name: "just inside the cutoff", km: maxReverseGeocodeKm - 0.1, want: "London"},
+		{name: "just beyond the cutoff", km: maxReverseGeocodeKm + 0.1, wantErr: ErrLocationNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon := north(51.5074, -0.1278, tt.km)
+			place, err := geocoder.ReverseGeocode(lat, lon)
+			if err != tt.wantErr {
+				t.Fatalf("ReverseGeocode() = %+v, %v, want error %v", place, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// The place is named after the nearest town but keeps the given coordinates
+			if place.Name != tt.want || place.Latitude != lat || place.Longitude != lon {
+				t.Errorf("ReverseGeocode() = %+v, want %q at %v, %v", place, tt.want, lat, lon)
+			}
+		})
+	}
+}
+
+func TestReverseGeocodeNearest(t *testing.T) {
+	geocoder := newTestGeocoder(t)
+
+	// Piccadilly station is nearer the centre of Manchester than the centre of Salford
+	place, err := geocoder.ReverseGeocode(53.4774, -2.2309)
+	if err != nil || place.Name != "Manchester" {
+		t.Errorf("ReverseGeocode() = %+v, %v, want Manchester", place, err)
+	}
+
+	// The middle of the Atlantic
+	if place, err := geocoder.ReverseGeocode(50, -30); err != ErrLocationNotFound {
+		t.Errorf("ReverseGeocode() at sea = %+v, %v, want ErrLocationNotFound", place, err)
+	}
+}
+
+func TestNormaliseName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Stoke-on-Trent", "stoke on trent"},
+		{"  Stoke   on  Trent ", "stoke on trent"},
+		{"City of London", "london"},
+		{"city of  Westminster", "westminster"},
+		{"St. Albans", "st albans"},
+		{"King's Lynn", "kings lynn"},
+		{"Hastings", "hastings"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := normaliseName(tt.name); got != tt.want {
+			t.Errorf("normaliseName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
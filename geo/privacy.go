@@ -0,0 +1,181 @@
+package geo
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+// kmPerDegreeLatitude is the length of one degree of latitude in kilometers
+const kmPerDegreeLatitude = 111.32
+
+// Ways of hiding a user's exact coordinates
+const (
+	// FuzzGrid snaps coordinates to the centre of a fixed grid cell
+	FuzzGrid = "grid"
+	// FuzzOffset moves coordinates by a random distance and bearing that is the same every time
+	FuzzOffset = "offset"
+)
+
+// LocationFuzzer hides users' exact coordinates before they are shared with other users.
+// The fuzzed location of a user is stable, so collecting it repeatedly can't average the noise out.
+type LocationFuzzer struct {
+	mode       string
+	key        []byte
+	fuzzKm     float64
+	heatmapKm  float64
+	kAnonymity int
+}
+
+// NewLocationFuzzerFromEnv configures a fuzzer with LOCATION_PRIVACY_MODE ("grid" or "offset"),
+// LOCATION_PRIVACY_KEY, LOCATION_FUZZ_KM, LOCATION_HEATMAP_CELL_KM and LOCATION_K_ANONYMITY
+func NewLocationFuzzerFromEnv() (*LocationFuzzer, error) {
+	fuzzer := &LocationFuzzer{
+		mode:       os.Getenv("LOCATION_PRIVACY_MODE"),
+		key:        []byte(os.Getenv("LOCATION_PRIVACY_KEY")),
+		fuzzKm:     floatFromEnv("LOCATION_FUZZ_KM", 2),
+		heatmapKm:  floatFromEnv("LOCATION_HEATMAP_CELL_KM", 5),
+		kAnonymity: int(floatFromEnv("LOCATION_K_ANONYMITY", 3)),
+	}
+	if fuzzer.mode != FuzzOffset {
+		fuzzer.mode = FuzzGrid
+	}
+	if len(fuzzer.key) == 0 {
+		// Offsets then change on every restart, which lets them be averaged across restarts
+		log.Println("LOCATION_PRIVACY_KEY is not set, using a random key until the next restart")
+		fuzzer.key = make([]byte, 32)
+		if _, err := rand.Read(fuzzer.key); err != nil {
+			return nil, err
+		}
+	}
+	return fuzzer, nil
+}
+
+// Fuzz returns the location to show other users in place of a user's exact coordinates
+func (f *LocationFuzzer) Fuzz(userID uint, latitude, longitude float64) (float64, float64) {
+	if f.mode == FuzzOffset {
+		return f.offset(userID, latitude, longitude)
+	}
+	return snapToGrid(latitude, longitude, f.fuzzKm)
+}
+
+// offset moves a location up to fuzzKm in a direction derived from a keyed hash of the user and
+// their location. The offset only changes when the user moves.
+func (f *LocationFuzzer) offset(userID uint, latitude, longitude float64) (float64, float64) {
+	mac := hmac.New(sha256.New, f.key)
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(userID))
+	mac.Write(buf)
+	// Rounded to about 10m so that re-saving the same place doesn't pick a new offset
+	mac.Write([]byte(strconv.FormatFloat(latitude, 'f', 4, 64) + "," + strconv.FormatFloat(longitude, 'f', 4, 64)))
+	sum := mac.Sum(nil)
+
+	bearing := unitFloat(sum[0:8]) * 2 * math.Pi
+	// At least a quarter of the radius away, spread evenly over the remaining area
+	distance := f.fuzzKm * math.Sqrt(0.0625+0.9375*unitFloat(sum[8:16]))
+
+	dLat := distance * math.Cos(bearing) / kmPerDegreeLatitude
+	dLon := distance * math.Sin(bearing) / (kmPerDegreeLatitude * math.Max(math.Cos(latitude*math.Pi/180), 0.01))
+	return latitude + dLat, longitude + dLon
+}
+
+// snapToGrid returns the centre of the grid cell of about cellKm by cellKm containing a location
+func snapToGrid(latitude, longitude, cellKm float64) (float64, float64) {
+	latStep := cellKm / kmPerDegreeLatitude
+	snappedLat := (math.Floor(latitude/latStep) + 0.5) * latStep
+
+	// Longitude cells are widened away from the equator so they stay roughly square
+	lonStep := cellKm / (kmPerDegreeLatitude * math.Max(math.Cos(snappedLat*math.Pi/180), 0.01))
+	snappedLon := (math.Floor(longitude/lonStep) + 0.5) * lonStep
+	return snappedLat, snappedLon
+}
+
+// unitFloat converts 8 bytes of a hash to a number in [0, 1)
+func unitFloat(b []byte) float64 {
+	return float64(binary.BigEndian.Uint64(b)>>11) / float64(1<<53)
+}
+
+// *************************** Heatmap ***************************
+
+// HeatmapCell is the number of users whose location falls in an area
+type HeatmapCell struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+}
+
+// Heatmap counts the given locations per cell. Cells with fewer than the k-anonymity threshold are
+// merged into coarser cells, and locations that still can't be grouped with enough others are left
+// out and only counted in hidden.
+func (f *LocationFuzzer) Heatmap(latitudes, longitudes []float64) (cells []HeatmapCell, hidden int) {
+	type cellKey struct{ lat, lon float64 }
+
+	cells = []HeatmapCell{}
+	remaining := make([]int, len(latitudes))
+	for i := range remaining {
+		remaining[i] = i
+	}
+
+	for _, cellKm := range []float64{f.heatmapKm, f.heatmapKm * 4, f.heatmapKm * 16} {
+		members := make(map[cellKey][]int)
+		var order []cellKey
+		for _, i := range remaining {
+			lat, lon := snapToGrid(latitudes[i], longitudes[i], cellKm)
+			key := cellKey{lat, lon}
+			if _, ok := members[key]; !ok {
+				order = append(order, key)
+			}
+			members[key] = append(members[key], i)
+		}
+
+		remaining = remaining[:0]
+		for _, key := range order {
+			if len(members[key]) >= f.kAnonymity {
+				cells = append(cells, HeatmapCell{Latitude: key.lat, Longitude: key.lon, Count: len(members[key])})
+			} else {
+				remaining = append(remaining, members[key]...)
+			}
+		}
+	}
+
+	return cells, len(remaining)
+}
+
+// Crowded reports, for each location, whether its heatmap cell holds at least k-anonymity locations,
+// so that showing it on its own doesn't single anyone out
+func (f *LocationFuzzer) Crowded(latitudes, longitudes []float64) []bool {
+	type cellKey struct{ lat, lon float64 }
+
+	keys := make([]cellKey, len(latitudes))
+	counts := make(map[cellKey]int)
+	for i := range latitudes {
+		lat, lon := snapToGrid(latitudes[i], longitudes[i], f.heatmapKm)
+		keys[i] = cellKey{lat, lon}
+		counts[keys[i]]++
+	}
+
+	crowded := make([]bool, len(latitudes))
+	for i, key := range keys {
+		crowded[i] = counts[key] >= f.kAnonymity
+	}
+	return crowded
+}
+
+func floatFromEnv(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid %s %q, using default %v", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
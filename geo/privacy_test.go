@@ -0,0 +1,139 @@
+package geo
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func newTestFuzzer(mode string) *LocationFuzzer {
+	return &LocationFuzzer{mode: mode, key: []byte("test key"), fuzzKm: 2, heatmapKm: 5, kAnonymity: 3}
+}
+
+// north returns a location km kilometers north of the given one
+func north(latitude, longitude, km float64) (float64, float64) {
+	return latitude + km/kmPerDegreeLatitude, longitude
+}
+
+func TestFuzzIsStableAndNearby(t *testing.T) {
+	for _, mode := range []string{FuzzGrid, FuzzOffset} {
+		t.Run(mode, func(t *testing.T) {
+			fuzzer := newTestFuzzer(mode)
+			lat, lon := fuzzer.Fuzz(7, 51.5074, -0.1278)
+			againLat, againLon := fuzzer.Fuzz(7, 51.5074, -0.1278)
+			if lat != againLat || lon != againLon {
+				t.Errorf("Fuzz() = %v, %v, then %v, %v for the same user and location", lat, lon, againLat, againLon)
+			}
+			if lat == 51.5074 && lon == -0.1278 {
+				t.Error("Fuzz() returned the exact location")
+			}
+			// Grid cells are fuzzKm wide, so their centre is at most half a diagonal away
+			if d := DistanceKm(51.5074, -0.1278, lat, lon); d > fuzzer.fuzzKm*math.Sqrt2 {
+				t.Errorf("Fuzz() moved the location %.2fkm, want at most %.2fkm", d, fuzzer.fuzzKm*math.Sqrt2)
+			}
+		})
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	fuzzer := newTestFuzzer(FuzzGrid)
+
+	// The centre of a 20km cell lies on a 5km cell boundary, so 1km and 7km north of it are in
+	// neighbouring 5km cells of the same 20km cell
+	centreLat, centreLon := snapToGrid(51.5074, -0.1278, fuzzer.heatmapKm*4)
+	nearLat, nearLon := north(centreLat, centreLon, 1)
+	farLat, farLon := north(centreLat, centreLon, 7)
+	nearCell, _ := snapToGrid(nearLat, nearLon, fuzzer.heatmapKm)
+	farCell, _ := snapToGrid(farLat, farLon, fuzzer.heatmapKm)
+	if nearCell == farCell {
+		t.Fatal("test locations share a 5km cell")
+	}
+
+	// Manchester and Edinburgh are too far from London and each other to merge
+	const manLat, manLon = 53.4808, -2.2426
+	const ednLat, ednLon = 55.9533, -3.1883
+
+	tests := []struct {
+		name                  string
+		latitudes, longitudes []float64
+		counts                []int
+		hidden                int
+	}{
+		{
+			name:       "a crowded cell is shown",
+			latitudes:  []float64{nearLat, nearLat, nearLat},
+			longitudes: []float64{nearLon, nearLon, nearLon},
+			counts:     []int{3},
+		},
+		{
+			name:       "sparse neighbouring cells are merged into a coarser cell",
+			latitudes:  []float64{nearLat, nearLat, farLat},
+			longitudes: []float64{nearLon, nearLon, farLon},
+			counts:     []int{3},
+		},
+		{
+			name:       "isolated locations are hidden",
+			latitudes:  []float64{nearLat, nearLat, nearLat, manLat, ednLat},
+			longitudes: []float64{nearLon, nearLon, nearLon, manLon, ednLon},
+			counts:     []int{3},
+			hidden:     2,
+		},
+		{
+			name:   "no locations",
+			counts: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells, hidden := fuzzer.Heatmap(tt.latitudes, tt.longitudes)
+			counts := []int{}
+			for _, cell := range cells {
+				counts = append(counts, cell.Count)
+			}
+			if !reflect.DeepEqual(counts, tt.counts) || hidden != tt.hidden {
+				t.Errorf("Heatmap() = cells of %v, %d hidden, want %v, %d hidden", counts, hidden, tt.counts, tt.hidden)
+			}
+		})
+	}
+}
+
+func TestHeatmapNeverShowsSmallCells(t *testing.T) {
+	fuzzer := newTestFuzzer(FuzzGrid)
+
+	// A line of locations 3km apart, which fall into cells of every size
+	var latitudes, longitudes []float64
+	for i := 0; i < 40; i++ {
+		lat, lon := north(51.5074, -0.1278, float64(i*3))
+		latitudes = append(latitudes, lat)
+		longitudes = append(longitudes, lon)
+	}
+
+	cells, hidden := fuzzer.Heatmap(latitudes, longitudes)
+	total := hidden
+	for _, cell := range cells {
+		if cell.Count < fuzzer.kAnonymity {
+			t.Errorf("Heatmap() has a cell of %d, fewer than %d", cell.Count, fuzzer.kAnonymity)
+		}
+		total += cell.Count
+	}
+	if total != len(latitudes) {
+		t.Errorf("Heatmap() counted %d locations, want %d", total, len(latitudes))
+	}
+}
+
+func TestCrowded(t *testing.T) {
+	fuzzer := newTestFuzzer(FuzzGrid)
+	centreLat, centreLon := snapToGrid(51.5074, -0.1278, fuzzer.heatmapKm*4)
+	nearLat, nearLon := north(centreLat, centreLon, 1)
+	farLat, farLon := north(centreLat, centreLon, 7)
+
+	got := fuzzer.Crowded(
+		[]float64{nearLat, nearLat, farLat, nearLat},
+		[]float64{nearLon, nearLon, farLon, nearLon},
+	)
+	want := []bool{true, true, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Crowded() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/repositories"
+	"event-connect/storage"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// accountDeletionGracePeriod is how long a deleted account can be restored before its personal data is purged
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// ExportAccountData returns everything held about the current user, as a ZIP archive with one JSON
+// file per section, or as a single JSON document with ?format=json
+func ExportAccountData(accountRepo *repositories.AccountRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "zip" && format != "json" {
+			writeJSONError(w, http.StatusBadRequest, "invalid_format", "Format must be zip or json", nil)
+			return
+		}
+
+		sections, err := accountRepo.ExportData(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		exportedAt := time.Now().UTC()
+		filename := fmt.Sprintf("event-connect-export-%d-%s", userID, exportedAt.Format("20060102"))
+
+		if format == "json" {
+			export := map[string]interface{}{"exportedAt": exportedAt}
+			for _, section := range sections {
+				export[section.Name] = section.Data
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+			json.NewEncoder(w).Encode(export)
+			return
+		}
+
+		// Build the archive in memory so that a failure can still be reported as an error
+		var archive bytes.Buffer
+		zipWriter := zip.NewWriter(&archive)
+		for _, section := range sections {
+			var data bytes.Buffer
+			if err := json.Indent(&data, section.Data, "", "  "); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			file, err := zipWriter.CreateHeader(&zip.FileHeader{Name: section.Name + ".json", Method: zip.Deflate, Modified: exportedAt})
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if _, err := file.Write(data.Bytes()); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := zipWriter.Close(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		w.Header().Set("Content-Length", strconv.Itoa(archive.Len()))
+		w.Write(archive.Bytes())
+	}
+}
+
+// DeleteAccount deletes the current user's account after they confirm their password, and second
+// factor when enabled. Comments are anonymised, raffle places are given up and team memberships are
+// removed straight away; the rest of the personal data is purged once the grace period ends. Until
+// then the account can be restored with the link emailed to the user.
+func DeleteAccount(accountRepo *repositories.AccountRepository, userRepo *repositories.UserRepository,
+	userTokenRepo *repositories.UserTokenRepository, totpRepo *repositories.TOTPRepository, loginAttemptRepo *repositories.LoginAttemptRepository, notifier *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Password string `json:"password"`
+			secondFactorRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !reauthenticate(w, r, userRepo, totpRepo, loginAttemptRepo, userTokenRepo, userID, requestBody.Password, requestBody.secondFactorRequest) {
+			return
+		}
+
+		user, err := userRepo.GetUserByID(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		memberships, promotions, err := accountRepo.DeleteAccount(userID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrAccountNotFound) {
+				writeJSONError(w, http.StatusNotFound, "account_not_found", "Account not found", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d deleted their account", userID)
+
+		// Places won in a raffle went to the next person on the waitlist
+		for _, promotion := range promotions {
+			notifyPromotedEntrant(notifier, promotion.UserID, promotion.EventID)
+		}
+
+		for _, membership := range memberships {
+			link := "/event-details.html?eventId=" + strconv.Itoa(int(membership.EventID))
+			body := "A member of your team for event ID " + strconv.Itoa(int(membership.EventID)) + " has deleted their account and is no longer in the team."
+			for _, teammateID := range membership.Teammates {
+				if err := notifier.Notify(teammateID, models.NotificationTeamChanged, "Your team has changed", body, link); err != nil {
+					log.Printf("Error notifying user %d of team change: %v", teammateID, err)
+				}
+			}
+		}
+
+		sendAccountRestoreEmail(userTokenRepo, user)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RestoreAccount handles the link from an account deletion email and redirects to the login page with the outcome
+func RestoreAccount(accountRepo *repositories.AccountRepository, userTokenRepo *repositories.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		userID, err := userTokenRepo.ConsumeToken(models.UserTokenAccountRestore, auth.HashToken(token))
+		if err != nil {
+			http.Redirect(w, r, "/login.html?restored=false", http.StatusSeeOther)
+			return
+		}
+
+		if err := accountRepo.RestoreAccount(userID); err != nil {
+			if errors.Is(err, repositories.ErrAccountNotFound) {
+				http.Redirect(w, r, "/login.html?restored=false", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d restored their account", userID)
+
+		http.Redirect(w, r, "/login.html?restored=true", http.StatusSeeOther)
+	}
+}
+
+// sendAccountRestoreEmail confirms an account deletion and emails a link to restore the account during the grace period
+func sendAccountRestoreEmail(userTokenRepo *repositories.UserTokenRepository, user *models.User) {
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating account restore token: %v", err)
+		return
+	}
+	if err := userTokenRepo.CreateToken(user.ID, models.UserTokenAccountRestore, tokenHash, time.Now().Add(accountDeletionGracePeriod)); err != nil {
+		return
+	}
+
+	days := strconv.Itoa(int(accountDeletionGracePeriod.Hours() / 24))
+	link := appURL("/account/restore?token=" + url.QueryEscape(token))
+	body := "Hi " + user.Username + ",\n\nYour account has been deleted. Your comments have been anonymised and you have been removed from your raffles and teams.\n\n"
+	body += "The rest of your personal data will be permanently deleted in " + days + " days. "
+	body += "If you change your mind before then, you can restore your account with the link below:\n\n" + link + "\n\n"
+	body += "Best regards,\nThe Event Team"
+	if err := sendEmail([]string{user.Email}, "Your account has been deleted", body); err != nil {
+		log.Printf("Error sending account deletion email to user %d: %v", user.ID, err)
+	}
+}
+
+// ScheduleAccountPurge permanently deletes the personal data of accounts whose grace period has ended,
+// including their avatar
+func ScheduleAccountPurge(accountRepo *repositories.AccountRepository, userRepo *repositories.UserRepository, avatarStore storage.BlobStore) {
+	ticker := time.NewTicker(24 * time.Hour) // Run the task every 24 hours
+	defer ticker.Stop()
+
+	for range ticker.C {
+		userIDs, err := accountRepo.GetAccountsDueForPurge(time.Now().Add(-accountDeletionGracePeriod))
+		if err != nil {
+			log.Printf("Error fetching accounts due for purge: %v", err)
+			continue
+		}
+
+		purged := 0
+		for _, userID := range userIDs {
+			avatarKey, err := userRepo.GetAvatarKey(userID)
+			if err != nil {
+				log.Printf("Error fetching avatar of account %d: %v", userID, err)
+				continue
+			}
+			if err := accountRepo.PurgeAccount(userID); err != nil {
+				log.Printf("Error purging account %d: %v", userID, err)
+				continue
+			}
+			deleteAvatarBlobs(avatarStore, avatarKey)
+			purged++
+		}
+		log.Printf("Purged %d deleted accounts", purged)
+	}
+}
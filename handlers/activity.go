@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"event-connect/geo"
 	"event-connect/models"
 	"event-connect/repositories"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 func CreateActivity(activityRepo *repositories.ActivityRepository) http.HandlerFunc {
@@ -51,22 +55,85 @@ func GetUserActivities(activityRepo *repositories.ActivityRepository) http.Handl
 	}
 }
 
-func GetUserLocationsForEvent(activityRepo *repositories.ActivityRepository) http.HandlerFunc {
+// AttendeeLocation is a registered user's fuzzed location as shown on the event map
+type AttendeeLocation struct {
+	ID        uint    `json:"id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// GetUserLocationsForEvent returns where the users registered for an event are, to other registered
+// users. Individual locations are fuzzed and only shown for users who share their location with the
+// viewer and are among enough others in the same area; everyone is counted in heatmap cells of at
+// least the k-anonymity threshold.
+func GetUserLocationsForEvent(activityRepo *repositories.ActivityRepository, fuzzer *geo.LocationFuzzer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		eventID := r.URL.Query().Get("eventId")
-		if eventID == "" {
-			http.Error(w, "Missing eventId parameter", http.StatusBadRequest)
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
 			return
 		}
 
-		userLocations, err := activityRepo.GetUserLocationsForEvent(eventID)
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		if !principal.HasRole(models.RoleAdmin) {
+			registered, err := activityRepo.IsRegistered(principal.UserID, uint(eventID))
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !registered {
+				writeJSONError(w, http.StatusForbidden, "not_registered", "Register for the event to see where other attendees are", nil)
+				return
+			}
+		}
+
+		userLocations, err := activityRepo.GetUserLocationsForEvent(uint(eventID), principal.UserID)
 		if err != nil {
 			log.Printf("Error fetching user locations for event: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
+		latitudes := make([]float64, len(userLocations))
+		longitudes := make([]float64, len(userLocations))
+		for i, location := range userLocations {
+			latitudes[i], longitudes[i] = location.Latitude, location.Longitude
+		}
+
+		crowded := fuzzer.Crowded(latitudes, longitudes)
+		attendees := []AttendeeLocation{}
+		for i, location := range userLocations {
+			if !crowded[i] || !locationVisible(location, principal.UserID) {
+				continue
+			}
+			latitude, longitude := fuzzer.Fuzz(location.UserID, location.Latitude, location.Longitude)
+			attendees = append(attendees, AttendeeLocation{ID: location.UserID, Latitude: latitude, Longitude: longitude})
+		}
+
+		heatmap, hidden := fuzzer.Heatmap(latitudes, longitudes)
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(userLocations)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"attendees": attendees,
+			"heatmap":   heatmap,
+			"hidden":    hidden,
+		})
+	}
+}
+
+// locationVisible reports whether a user's location may be shown on the event map to the viewer.
+// Locations shared with teammates only are left to the heatmap for everyone else.
+func locationVisible(location models.UserLocation, viewerID uint) bool {
+	switch location.LocationVisibility {
+	case models.VisibilityPublic:
+		return true
+	case models.VisibilityTeammates:
+		return location.IsTeammate || location.UserID == viewerID
+	default:
+		return false
 	}
 }
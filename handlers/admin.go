@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"event-connect/models"
+	"event-connect/repositories"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// *************************** Role Management ***************************
+
+func GetUserRoles(roleRepo *repositories.RoleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseUint(mux.Vars(r)["userId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		roles, err := roleRepo.GetRoles(uint(userID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"userId": userID, "roles": roles})
+	}
+}
+
+// GrantUserRole gives a user a role. The new role is included in the user's tokens from their next refresh.
+func GrantUserRole(roleRepo *repositories.RoleRepository, userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, role, ok := roleRequestParams(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		if err := roleRepo.GrantRole(userID, role); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeUserRoles(w, roleRepo, userID)
+	}
+}
+
+// RevokeUserRole removes a role from a user. Admins cannot revoke their own admin role so that
+// the last admin cannot lock everyone out.
+func RevokeUserRole(roleRepo *repositories.RoleRepository, userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		userID, role, ok := roleRequestParams(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		if role == models.RoleUser {
+			writeJSONError(w, http.StatusBadRequest, "invalid_role", "The user role cannot be revoked", nil)
+			return
+		}
+		if role == models.RoleAdmin && userID == principal.UserID {
+			writeJSONError(w, http.StatusConflict, "cannot_revoke_self", "Admins cannot revoke their own admin role", nil)
+			return
+		}
+
+		if err := roleRepo.RevokeRole(userID, role); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeUserRoles(w, roleRepo, userID)
+	}
+}
+
+// roleRequestParams reads and validates the user ID and role path parameters, writing the error
+// response and returning false when they are invalid
+func roleRequestParams(w http.ResponseWriter, r *http.Request, userRepo *repositories.UserRepository) (uint, string, bool) {
+	params := mux.Vars(r)
+	userID, err := strconv.ParseUint(params["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	role := params["role"]
+	if !models.IsRole(role) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_role", "Unknown role", map[string]interface{}{"roles": models.Roles})
+		return 0, "", false
+	}
+
+	if _, err := userRepo.GetUserByID(uint(userID)); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return 0, "", false
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, "", false
+	}
+
+	return uint(userID), role, true
+}
+
+func writeUserRoles(w http.ResponseWriter, roleRepo *repositories.RoleRepository, userID uint) {
+	roles, err := roleRepo.GetRoles(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"userId": userID, "roles": roles})
+}
+
+// *************************** Event Organisers ***************************
+
+func GetEventOrganisers(roleRepo *repositories.RoleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		organisers, err := roleRepo.GetEventOrganisers(uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"eventId": eventID, "organisers": organisers})
+	}
+}
+
+// AddEventOrganiser assigns an organiser to manage an event
+func AddEventOrganiser(roleRepo *repositories.RoleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, userID, ok := organiserRequestParams(w, r)
+		if !ok {
+			return
+		}
+
+		roles, err := roleRepo.GetRoles(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		isOrganiser := false
+		for _, role := range roles {
+			if role == models.RoleOrganiser {
+				isOrganiser = true
+			}
+		}
+		if !isOrganiser {
+			writeJSONError(w, http.StatusConflict, "not_organiser", "The user must hold the organiser role before managing events", nil)
+			return
+		}
+
+		if err := roleRepo.AddEventOrganiser(userID, eventID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RemoveEventOrganiser(roleRepo *repositories.RoleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, userID, ok := organiserRequestParams(w, r)
+		if !ok {
+			return
+		}
+
+		if err := roleRepo.RemoveEventOrganiser(userID, eventID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func organiserRequestParams(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	params := mux.Vars(r)
+	eventID, err := strconv.ParseUint(params["eventId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userID, err := strconv.ParseUint(params["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return uint(eventID), uint(userID), true
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"event-connect/avatar"
+	"event-connect/models"
+	"event-connect/repositories"
+	"event-connect/storage"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxAvatarRequestBytes allows for the multipart encoding around an upload of the largest accepted size
+const maxAvatarRequestBytes = avatar.MaxUploadBytes + 64<<10
+
+// maxConcurrentAvatarProcessing is the most uploads decoded at once, since each can take up to 64 MB
+const maxConcurrentAvatarProcessing = 2
+
+// avatarProcessing holds a slot for every upload being decoded
+var avatarProcessing = make(chan struct{}, maxConcurrentAvatarProcessing)
+
+// UploadAvatar replaces the current user's profile photo with a JPEG, PNG or WebP image sent as
+// the "avatar" field of a multipart form. The image is re-encoded into square thumbnails, which
+// drops its metadata, and the previous photo is deleted.
+func UploadAvatar(userRepo *repositories.UserRepository, avatarStore storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		tooLarge := fmt.Sprintf("Photos must be smaller than %d MB", avatar.MaxUploadBytes>>20)
+		r.Body = http.MaxBytesReader(w, r.Body, maxAvatarRequestBytes)
+		file, _, err := r.FormFile("avatar")
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "avatar_too_large", tooLarge, nil)
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "invalid_avatar", "Send the photo as the avatar field of a multipart form", nil)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, avatar.MaxUploadBytes+1))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_avatar", "The photo could not be read", nil)
+			return
+		}
+		if len(data) > avatar.MaxUploadBytes {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "avatar_too_large", tooLarge, nil)
+			return
+		}
+
+		avatarProcessing <- struct{}{}
+		thumbnails, err := avatar.Process(data)
+		<-avatarProcessing
+		if err != nil {
+			switch err {
+			case avatar.ErrUnsupportedFormat:
+				writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_image", "Photos must be JPEG, PNG or WebP images", nil)
+			case avatar.ErrTooLarge:
+				writeJSONError(w, http.StatusUnprocessableEntity, "image_too_large",
+					fmt.Sprintf("Photos can have at most %.1f megapixels", float64(avatar.MaxPixels)/1e6), nil)
+			case avatar.ErrTooSmall:
+				writeJSONError(w, http.StatusUnprocessableEntity, "image_too_small",
+					fmt.Sprintf("Photos must be at least %d pixels wide and high", avatar.MinDimension), nil)
+			default:
+				log.Printf("Error processing avatar for user %d: %v", userID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Every upload gets a new key, so cached copies of the previous photo are never served in its place
+		key, err := newAvatarKey(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, size := range avatar.Sizes {
+			if err := avatarStore.Put(avatarBlobKey(key, size), bytes.NewReader(thumbnails[size]), "image/jpeg"); err != nil {
+				log.Printf("Error storing avatar for user %d: %v", userID, err)
+				deleteAvatarBlobs(avatarStore, key)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		previous, err := userRepo.SetAvatarKey(userID, key)
+		if err != nil {
+			deleteAvatarBlobs(avatarStore, key)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		deleteAvatarBlobs(avatarStore, previous)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]*models.Avatar{"avatar": avatarURLs(avatarStore, key)})
+	}
+}
+
+// DeleteAvatar removes the current user's profile photo
+func DeleteAvatar(userRepo *repositories.UserRepository, avatarStore storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		previous, err := userRepo.SetAvatarKey(userID, "")
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		deleteAvatarBlobs(avatarStore, previous)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newAvatarKey returns a new, unguessable key for a user's avatar
+func newAvatarKey(userID uint) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("avatars/%d/%s", userID, hex.EncodeToString(buf)), nil
+}
+
+// avatarBlobKey returns the key of the thumbnail of an avatar at a size
+func avatarBlobKey(key string, size int) string {
+	return fmt.Sprintf("%s_%d.jpg", key, size)
+}
+
+// avatarURLs returns the URLs of an avatar's thumbnails, or nil when there is no avatar
+func avatarURLs(avatarStore storage.BlobStore, key string) *models.Avatar {
+	if key == "" {
+		return nil
+	}
+	return &models.Avatar{
+		Large:  avatarStore.URL(avatarBlobKey(key, avatar.SizeLarge)),
+		Medium: avatarStore.URL(avatarBlobKey(key, avatar.SizeMedium)),
+		Small:  avatarStore.URL(avatarBlobKey(key, avatar.SizeSmall)),
+	}
+}
+
+// resolveTeamAvatars fills in the avatar URLs of team members
+func resolveTeamAvatars(avatarStore storage.BlobStore, teams []models.Team) {
+	for i := range teams {
+		for j := range teams[i].Members {
+			member := &teams[i].Members[j]
+			member.Avatar = avatarURLs(avatarStore, member.AvatarKey)
+			member.AvatarKey = ""
+		}
+	}
+}
+
+// absoluteURL turns a URL served by the application into one that works outside it, such as in an email
+func absoluteURL(url string) string {
+	if strings.HasPrefix(url, "/") {
+		return appURL(url)
+	}
+	return url
+}
+
+// deleteAvatarBlobs deletes every thumbnail of an avatar. Failures are only logged, since the
+// avatar is no longer referenced and an orphaned file does no harm.
+func deleteAvatarBlobs(avatarStore storage.BlobStore, key string) {
+	if key == "" {
+		return
+	}
+	for _, size := range avatar.Sizes {
+		if err := avatarStore.Delete(avatarBlobKey(key, size)); err != nil {
+			log.Printf("Error deleting avatar %s: %v", avatarBlobKey(key, size), err)
+		}
+	}
+}
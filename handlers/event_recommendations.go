@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"event-connect/recommend"
+	"event-connect/repositories"
+	"event-connect/skiddle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// minSharedEngagements is the fewest users an event must have in common with another before the
+// overlap is shown, so that no single user's registrations can be read from it
+const minSharedEngagements = 3
+
+// maxEventCandidates is how many events from each source are considered for recommendations
+const maxEventCandidates = 20
+
+// kmPerMile converts the distance preference to the miles Skiddle searches in
+const kmPerMile = 1.609344
+
+// GetEventRecommendations ranks upcoming events for the current user. Candidates are the events that
+// users with a similar history engaged with, the events popular with users living nearby, and the
+// upcoming events near the user. Events the user already registered for or entered are left out.
+func GetEventRecommendations(activityRepo *repositories.ActivityRepository, userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		limit := 20
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > 50 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		user, err := userRepo.GetUserProfile(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		engaged, err := activityRepo.GetEngagedEventIDs(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		radiusKm := float64(user.DistancePreference)
+		if radiusKm == 0 {
+			radiusKm = recommend.DefaultRadiusKm
+		}
+
+		candidates := make(map[uint]*recommend.EventCandidate)
+		candidate := func(eventID uint) *recommend.EventCandidate {
+			if candidates[eventID] == nil {
+				candidates[eventID] = &recommend.EventCandidate{Event: recommend.Event{ID: eventID}}
+			}
+			return candidates[eventID]
+		}
+
+		if len(engaged) > 0 {
+			similar, err := activityRepo.GetEventsEngagedBySimilarUsers(userID, minSharedEngagements, maxEventCandidates)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			for _, engagement := range similar {
+				candidate(engagement.EventID).SimilarUsers = engagement.Users
+			}
+		}
+
+		// Without a location, popularity among all users is the best there is
+		popularRadiusKm := 0.0
+		if recommend.HasLocation(user) {
+			popularRadiusKm = radiusKm
+		}
+		popular, err := activityRepo.GetPopularEventsNearby(userID, user.Latitude, user.Longitude, popularRadiusKm, minSharedEngagements, maxEventCandidates)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		for _, engagement := range popular {
+			candidate(engagement.EventID).NearbyUsers = engagement.Users
+		}
+
+		details := make(map[uint]map[string]interface{})
+		if recommend.HasLocation(user) {
+			nearby, err := searchSkiddleEvents(user.Latitude, user.Longitude, radiusKm)
+			if err != nil {
+				// Recommendations from history are still worth returning
+				log.Printf("Error searching events near user %d: %v", userID, err)
+			}
+			for _, event := range nearby {
+				eventID := skiddleEventID(event)
+				if eventID == 0 || engaged[eventID] {
+					continue
+				}
+				candidate(eventID)
+				details[eventID] = event
+			}
+		}
+
+		var missing []uint
+		for eventID := range candidates {
+			if details[eventID] == nil {
+				missing = append(missing, eventID)
+			}
+		}
+		for eventID, event := range fetchSkiddleEvents(missing) {
+			details[eventID] = event
+		}
+
+		var upcoming []recommend.EventCandidate
+		for eventID, c := range candidates {
+			event := details[eventID]
+			if event == nil || !isUpcoming(event) {
+				continue
+			}
+			c.Event = skiddleEventForScoring(eventID, event)
+			upcoming = append(upcoming, *c)
+		}
+
+		recommendations := recommend.Events(user, upcoming, len(engaged) > 0, radiusKm)
+		if len(recommendations) > limit {
+			recommendations = recommendations[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"recommendations": recommendations,
+		})
+	}
+}
+
+// AlsoRegisteredEvent is an upcoming event that people who engaged with another event also engaged with
+type AlsoRegisteredEvent struct {
+	Event map[string]interface{} `json:"event"`
+	Users int                    `json:"users"`
+}
+
+// GetAlsoRegisteredEvents returns the upcoming events that people who registered for, or entered the
+// raffle of, an event also registered for or entered, most shared first
+func GetAlsoRegisteredEvents(activityRepo *repositories.ActivityRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		engagements, err := activityRepo.GetCoEngagedEvents(uint(eventID), minSharedEngagements, maxEventCandidates)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		eventIDs := make([]uint, len(engagements))
+		for i, engagement := range engagements {
+			eventIDs[i] = engagement.EventID
+		}
+		details := fetchSkiddleEvents(eventIDs)
+
+		events := []AlsoRegisteredEvent{}
+		for _, engagement := range engagements {
+			event := details[engagement.EventID]
+			if event == nil || !isUpcoming(event) {
+				continue
+			}
+			events = append(events, AlsoRegisteredEvent{Event: event, Users: engagement.Users})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+// searchSkiddleEvents finds the upcoming events within radiusKm of a location
+func searchSkiddleEvents(latitude, longitude, radiusKm float64) ([]map[string]interface{}, error) {
+	url := skiddle.EventSearchURL(map[string]string{
+		"latitude":    fmt.Sprintf("%.6f", latitude),
+		"longitude":   fmt.Sprintf("%.6f", longitude),
+		"radius":      fmt.Sprintf("%.0f", radiusKm/kmPerMile),
+		"order":       "date",
+		"description": "1",
+		"limit":       strconv.Itoa(maxEventCandidates),
+		"minDate":     time.Now().Format("2006-01-02"),
+	})
+
+	var result struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := getSkiddleJSON(url, &result); err != nil {
+		return nil, err
+	}
+
+	events := make([]map[string]interface{}, len(result.Results))
+	for i, event := range result.Results {
+		events[i] = skiddleEventSummary(event)
+	}
+	return events, nil
+}
+
+// skiddleEventSummary picks the fields the frontend shows from a Skiddle event
+func skiddleEventSummary(event map[string]interface{}) map[string]interface{} {
+	minAge := event["minage"]
+	if minAge == nil {
+		minAge = event["MinAge"]
+	}
+	return map[string]interface{}{
+		"id":          event["id"],
+		"eventname":   event["eventname"],
+		"date":        event["date"],
+		"venue":       event["venue"],
+		"description": event["description"],
+		"entryprice":  event["entryprice"],
+		"minage":      minAge,
+		"link":        event["link"],
+		"imageurl":    event["imageurl"],
+	}
+}
+
+// skiddleEventForScoring extracts what the recommender needs from a Skiddle event
+func skiddleEventForScoring(eventID uint, event map[string]interface{}) recommend.Event {
+	scored := recommend.Event{ID: eventID, Details: event}
+	scored.Name, _ = event["eventname"].(string)
+	scored.Description, _ = event["description"].(string)
+	if venue, ok := event["venue"].(map[string]interface{}); ok {
+		latitude, hasLatitude := venue["latitude"].(float64)
+		longitude, hasLongitude := venue["longitude"].(float64)
+		scored.Latitude, scored.Longitude = latitude, longitude
+		scored.HasVenue = hasLatitude && hasLongitude && (latitude != 0 || longitude != 0)
+	}
+	return scored
+}
+
+// skiddleEventID reads an event's ID, which Skiddle returns as a string
+func skiddleEventID(event map[string]interface{}) uint {
+	switch id := event["id"].(type) {
+	case string:
+		parsed, _ := strconv.ParseUint(id, 10, 64)
+		return uint(parsed)
+	case float64:
+		return uint(id)
+	}
+	return 0
+}
+
+// isUpcoming reports whether an event takes place today or later
+func isUpcoming(event map[string]interface{}) bool {
+	date, _ := event["date"].(string)
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return false
+	}
+	return !day.Before(time.Now().Truncate(24 * time.Hour))
+}
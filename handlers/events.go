@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"event-connect/auth"
 	"event-connect/models"
 	"event-connect/repositories"
 	"event-connect/skiddle"
@@ -191,14 +190,13 @@ func (h *EventHandler) RegisterEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := auth.GetUserIDFromToken(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
 	activity := &models.Activity{
-		UserID:       uint(userID),
+		UserID:       userID,
 		EventID:      uint(eventID),
 		ActivityType: "event_registered",
 		Timestamp:    time.Now(),
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeQuery answers a statement run against a fakeDB with the rows it returns. Statements run with
+// Exec report as many affected rows as the rows returned.
+type fakeQuery func(query string, args []driver.Value) ([][]driver.Value, error)
+
+// fakeDB is a database for handler tests whose statements are answered by a function, so that
+// handlers can be run against repositories without a database server
+type fakeDB struct {
+	mu         sync.Mutex
+	query      fakeQuery
+	statements []string
+}
+
+// newFakeDB returns a database answered by query, with every statement it runs recorded
+func newFakeDB(t *testing.T, query fakeQuery) (*sql.DB, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{query: query}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	return db, fake
+}
+
+// ran reports how many of the statements run so far contain fragment
+func (f *fakeDB) ran(fragment string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+	for _, statement := range f.statements {
+		if strings.Contains(statement, fragment) {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) ([][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.statements = append(f.statements, query)
+	return f.query(query, values)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	panic("fakeStmt: Exec without a context")
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	panic("fakeStmt: Query without a context")
+}
+
+func (s fakeStmt) ExecContext(_ context.Context, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (s fakeStmt) QueryContext(_ context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	next int
+}
+
+// Columns names the columns by position; repositories scan them in order
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = "column"
+	}
+	return columns
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// testLogger returns a logger for repositories under test that discards what they log
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
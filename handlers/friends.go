@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"event-connect/models"
+	"event-connect/repositories"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetFriends returns the current user's friends
+func GetFriends(friendRepo *repositories.FriendRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		friends, err := friendRepo.GetFriends(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(friends)
+	}
+}
+
+// GetFriendRequests returns the friend requests the current user has received and sent
+func GetFriendRequests(friendRepo *repositories.FriendRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		requests, err := friendRepo.GetFriendRequests(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(requests)
+	}
+}
+
+// SendFriendRequest asks another user to be the current user's friend. If they have already asked
+// the current user, the two become friends straight away.
+func SendFriendRequest(friendRepo *repositories.FriendRepository, blockRepo *repositories.BlockRepository, userRepo *repositories.UserRepository, notifier *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			UserID uint `json:"userId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.UserID == 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if requestBody.UserID == userID {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_friend", "You can't send a friend request to yourself", nil)
+			return
+		}
+
+		addressee, err := userRepo.GetUserProfile(requestBody.UserID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// A block looks the same as a missing user so that nobody can tell they have been blocked
+		blocked, err := blockRepo.IsBlocked(userID, addressee.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found", nil)
+			return
+		}
+
+		accepted, err := friendRepo.SendFriendRequest(userID, addressee.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrAlreadyFriends):
+				writeJSONError(w, http.StatusConflict, "already_friends", "You are already friends", nil)
+			case errors.Is(err, repositories.ErrFriendRequestAlreadySent):
+				writeJSONError(w, http.StatusConflict, "request_already_sent", "You have already sent this user a friend request", nil)
+			default:
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if accepted {
+			notifyFriendRequestAccepted(userRepo, notifier, userID, addressee.ID)
+		} else {
+			notifyFriendRequest(userRepo, notifier, userID, addressee.ID)
+		}
+
+		status := models.FriendshipPending
+		if accepted {
+			status = models.FriendshipAccepted
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+	}
+}
+
+// AcceptFriendRequest accepts a friend request sent to the current user
+func AcceptFriendRequest(friendRepo *repositories.FriendRepository, userRepo *repositories.UserRepository, notifier *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+		requesterID, ok := friendIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := friendRepo.AcceptFriendRequest(userID, requesterID); err != nil {
+			writeFriendRequestError(w, err)
+			return
+		}
+		notifyFriendRequestAccepted(userRepo, notifier, userID, requesterID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeclineFriendRequest declines a friend request sent to the current user
+func DeclineFriendRequest(friendRepo *repositories.FriendRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+		requesterID, ok := friendIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := friendRepo.DeclineFriendRequest(userID, requesterID); err != nil {
+			writeFriendRequestError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RemoveFriend removes a friend, or cancels a friend request, of the current user
+func RemoveFriend(friendRepo *repositories.FriendRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+		friendID, ok := friendIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := friendRepo.RemoveFriend(userID, friendID); err != nil {
+			if errors.Is(err, repositories.ErrFriendNotFound) {
+				writeJSONError(w, http.StatusNotFound, "friend_not_found", "This user isn't your friend", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetFriendsAttendingEvent returns the current user's friends who have registered for an event
+func GetFriendsAttendingEvent(friendRepo *repositories.FriendRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		friends, err := friendRepo.GetFriendsRegisteredForEvent(userID, uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(friends)
+	}
+}
+
+func friendIDFromPath(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	friendID, err := strconv.ParseUint(mux.Vars(r)["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(friendID), true
+}
+
+func writeFriendRequestError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repositories.ErrFriendRequestNotFound) {
+		writeJSONError(w, http.StatusNotFound, "request_not_found", "Friend request not found", nil)
+		return
+	}
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// notifyFriendRequest tells a user someone has asked to be their friend
+func notifyFriendRequest(userRepo *repositories.UserRepository, notifier *Notifier, requesterID, addresseeID uint) {
+	requester, err := userRepo.GetUserProfile(requesterID)
+	if err != nil {
+		log.Printf("Error fetching friend request sender %d: %v", requesterID, err)
+		return
+	}
+
+	link := fmt.Sprintf("/other-user-profile.html?userId=%d", requesterID)
+	err = notifier.Notify(addresseeID, models.NotificationFriendRequest, "New friend request",
+		requester.Username+" would like to be your friend", link)
+	if err != nil {
+		log.Printf("Error notifying user %d of friend request: %v", addresseeID, err)
+	}
+}
+
+// notifyFriendRequestAccepted tells the sender of a friend request it was accepted
+func notifyFriendRequestAccepted(userRepo *repositories.UserRepository, notifier *Notifier, accepterID, requesterID uint) {
+	accepter, err := userRepo.GetUserProfile(accepterID)
+	if err != nil {
+		log.Printf("Error fetching user %d who accepted friend request: %v", accepterID, err)
+		return
+	}
+
+	link := fmt.Sprintf("/other-user-profile.html?userId=%d", accepterID)
+	err = notifier.Notify(requesterID, models.NotificationFriendRequest, "Friend request accepted",
+		accepter.Username+" accepted your friend request", link)
+	if err != nil {
+		log.Printf("Error notifying user %d of accepted friend request: %v", requesterID, err)
+	}
+}
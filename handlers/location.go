@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"event-connect/geo"
+	"event-connect/models"
+	"net/http"
+	"strings"
+)
+
+// maxLocationMismatchKm is how far submitted coordinates can be from the place named in the location
+// before they are replaced with the coordinates of that place
+const maxLocationMismatchKm = 50
+
+// resolveLocation makes a user's location text and coordinates agree. Coordinates are derived from the
+// text when they are missing or inconsistent with it, and a display name is derived from coordinates
+// when there is no text. It returns geo.ErrLocationNotFound when neither can be resolved.
+func resolveLocation(geocoder geo.Geocoder, user *models.User) error {
+	hasCoordinates := user.Latitude != 0 || user.Longitude != 0
+
+	if strings.TrimSpace(user.Location) == "" {
+		if !hasCoordinates {
+			return geo.ErrLocationNotFound
+		}
+		place, err := geocoder.ReverseGeocode(user.Latitude, user.Longitude)
+		if err != nil {
+			return err
+		}
+		user.Location = place.Name
+		return nil
+	}
+
+	place, err := geocoder.Geocode(user.Location)
+	if err == geo.ErrLocationNotFound && hasCoordinates {
+		// Smaller places missing from the dataset are accepted when their coordinates are near a known place
+		_, err = geocoder.ReverseGeocode(user.Latitude, user.Longitude)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if !hasCoordinates || geo.DistanceKm(user.Latitude, user.Longitude, place.Latitude, place.Longitude) > maxLocationMismatchKm {
+		user.Latitude, user.Longitude = place.Latitude, place.Longitude
+	}
+	return nil
+}
+
+// writeLocationError responds to a profile whose location couldn't be resolved
+func writeLocationError(w http.ResponseWriter) {
+	writeJSONError(w, http.StatusUnprocessableEntity, "invalid_location", "We couldn't find that location, please enter a UK town, city or postcode",
+		map[string]string{"location": "could not be resolved"})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"event-connect/geo"
+	"event-connect/models"
+	"event-connect/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	leedsLat, leedsLon           = 53.8008, -1.5491
+	headingleyLat, headingleyLon = 53.8190, -1.5790
+	manchesterLat, manchesterLon = 53.4808, -2.2426
+	atSeaLat, atSeaLon           = 50.0, -30.0
+)
+
+func newTestGeocoder(t *testing.T) *geo.OfflineGeocoder {
+	t.Helper()
+
+	geocoder, err := geo.NewOfflineGeocoder()
+	if err != nil {
+		t.Fatalf("NewOfflineGeocoder: %v", err)
+	}
+	return geocoder
+}
+
+func TestResolveLocation(t *testing.T) {
+	geocoder := newTestGeocoder(t)
+
+	tests := []struct {
+		name             string
+		location         string
+		latitude         float64
+		longitude        float64
+		wantLocation     string
+		wantLat, wantLon float64
+		wantErr          error
+	}{
+		{name: "coordinates from the location", location: "Leeds", wantLocation: "Leeds", wantLat: leedsLat, wantLon: leedsLon},
+		{
+			name: "nearby coordinates are kept", location: "Leeds", latitude: headingleyLat, longitude: headingleyLon,
+			wantLocation: "Leeds", wantLat: headingleyLat, wantLon: headingleyLon,
+		},
+		{
+			name: "distant coordinates are replaced", location: "Leeds", latitude: atSeaLat, longitude: atSeaLon,
+			wantLocation: "Leeds", wantLat: leedsLat, wantLon: leedsLon,
+		},
+		{
+			name: "location from the coordinates", latitude: manchesterLat, longitude: manchesterLon,
+			wantLocation: "Manchester", wantLat: manchesterLat, wantLon: manchesterLon,
+		},
+		{
+			name: "unknown place near a known one", location: "Headingley", latitude: headingleyLat, longitude: headingleyLon,
+			wantLocation: "Headingley", wantLat: headingleyLat, wantLon: headingleyLon,
+		},
+		{name: "no location or coordinates", wantErr: geo.ErrLocationNotFound},
+		{name: "unknown place without coordinates", location: "Atlantis", wantErr: geo.ErrLocationNotFound},
+		{name: "unknown place far from any known one", location: "Atlantis", latitude: atSeaLat, longitude: atSeaLon, wantErr: geo.ErrLocationNotFound},
+		{name: "coordinates far from any known place", latitude: atSeaLat, longitude: atSeaLon, wantErr: geo.ErrLocationNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := models.User{Location: tt.location, Latitude: tt.latitude, Longitude: tt.longitude}
+			err := resolveLocation(geocoder, &user)
+			if err != tt.wantErr {
+				t.Fatalf("resolveLocation() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if user.Location != tt.wantLocation || user.Latitude != tt.wantLat || user.Longitude != tt.wantLon {
+				t.Errorf("resolveLocation() gave %q at %v, %v, want %q at %v, %v",
+					user.Location, user.Latitude, user.Longitude, tt.wantLocation, tt.wantLat, tt.wantLon)
+			}
+		})
+	}
+}
+
+func TestCreateUserRejectsUnresolvableLocation(t *testing.T) {
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) ([][]driver.Value, error) {
+		if strings.Contains(query, "SELECT EXISTS") {
+			return [][]driver.Value{{false}}, nil
+		}
+		return nil, nil
+	})
+	handler := CreateUser(repositories.NewUserRepository(db, testLogger()), repositories.NewTokenRepository(db, testLogger()),
+		repositories.NewRoleRepository(db, testLogger()), repositories.NewUserTokenRepository(db, testLogger()), newTestGeocoder(t))
+
+	body := `{"username": "ada", "email": "ada@example.com", "password": "a long password", "age": 30, "gender": "female", "location": "Atlantis"}`
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)))
+
+	var apiError APIError
+	json.NewDecoder(rec.Body).Decode(&apiError)
+	if rec.Code != http.StatusUnprocessableEntity || apiError.Error != "invalid_location" {
+		t.Errorf("CreateUser() = %d %q, want 422 invalid_location", rec.Code, apiError.Error)
+	}
+	if fake.ran("INSERT INTO users") != 0 {
+		t.Error("CreateUser created an account with an unresolvable location")
+	}
+}
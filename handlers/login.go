@@ -3,9 +3,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"event-connect/auth" // Import the auth package correctly
+	"event-connect/models"
 	"event-connect/repositories"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // LoginRequest represents the request body for the login endpoint
@@ -16,31 +22,207 @@ type LoginRequest struct {
 
 // LoginResponse represents the response body for the login endpoint
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
 }
 
-func Login(userRepo *repositories.UserRepository, w http.ResponseWriter, r *http.Request) {
+// RefreshRequest represents the request body for the token refresh and logout endpoints
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func Login(userRepo *repositories.UserRepository, tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository,
+	loginAttemptRepo *repositories.LoginAttemptRepository, userTokenRepo *repositories.UserTokenRepository, totpRepo *repositories.TOTPRepository,
+	w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Throttle repeated failures before checking the password so locked accounts can't be guessed
+	wait, err := loginThrottle(loginAttemptRepo, req.Username, clientIP(r))
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		recordLoginAttempt(loginAttemptRepo, r, req.Username, false, models.LoginThrottled)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many failed login attempts, please try again later", nil)
+		return
+	}
+
 	// Fetch the user from the database using the UserRepository
 	user, err := userRepo.GetUserByUsernameAndPassword(req.Username, req.Password)
 	if err != nil {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		if !errors.Is(err, repositories.ErrInvalidCredentials) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		recordLoginAttempt(loginAttemptRepo, r, req.Username, false, models.LoginInvalidCredentials)
+		go lockAccountIfNeeded(loginAttemptRepo, userRepo, userTokenRepo, req.Username)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid username or password", nil)
+		return
+	}
+	if refuseInactiveLogin(w, r, userRepo, loginAttemptRepo, user) {
+		return
+	}
+
+	// Accounts with two-factor authentication get a challenge to complete with a code instead of a session
+	mfaEnabled, err := totpRepo.IsEnabled(user.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if mfaEnabled {
+		challengeToken, err := auth.GenerateMFAChallenge(user.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MFAChallengeResponse{
+			MFARequired:    true,
+			ChallengeToken: challengeToken,
+			ExpiresIn:      int(auth.MFAChallengeTTL.Seconds()),
+		})
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateJWT(user.ID)
+	recordLoginAttempt(loginAttemptRepo, r, req.Username, true, models.LoginSucceeded)
+
+	// Start a new session with an access and refresh token
+	resp, err := issueSession(tokenRepo, roleRepo, user.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	resp := LoginResponse{Token: token}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// issueSession starts a new refresh token family for a user and issues its first tokens
+func issueSession(tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository, userID uint) (*LoginResponse, error) {
+	roles, err := roleRepo.GetRoles(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	familyID, err := auth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tokenRepo.CreateSession(userID, familyID, refreshHash, time.Now().Add(auth.RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	accessToken, _, err := auth.GenerateAccessToken(userID, familyID, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a rotated refresh token.
+// Roles are looked up again so that grants and revocations take effect on the next refresh.
+func RefreshToken(tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		newRefreshToken, newRefreshHash, err := auth.GenerateRefreshToken()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, familyID, err := tokenRepo.RotateRefreshToken(auth.HashToken(req.RefreshToken), newRefreshHash, time.Now().Add(auth.RefreshTokenTTL))
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrInvalidRefreshToken), errors.Is(err, repositories.ErrRefreshTokenExpired),
+				errors.Is(err, repositories.ErrRefreshTokenReused):
+				http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			default:
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		roles, err := roleRepo.GetRoles(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		accessToken, _, err := auth.GenerateAccessToken(userID, familyID, roles)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LoginResponse{
+			Token:        accessToken,
+			RefreshToken: newRefreshToken,
+			ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		})
+	}
+}
+
+// Logout revokes the current access token and every refresh token of its session
+func Logout(tokenRepo *repositories.TokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		if err := tokenRepo.RevokeAccessToken(principal.TokenID, principal.ExpiresAt); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if principal.SessionID != "" {
+			if err := tokenRepo.RevokeFamily(principal.SessionID); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ScheduleTokenPruning(tokenRepo *repositories.TokenRepository, userTokenRepo *repositories.UserTokenRepository, identityRepo *repositories.IdentityRepository) {
+	ticker := time.NewTicker(24 * time.Hour) // Run the task every 24 hours
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := tokenRepo.PruneExpiredTokens(time.Now()); err != nil {
+			log.Printf("Error pruning expired tokens: %v", err)
+		}
+		if err := userTokenRepo.PruneTokens(time.Now()); err != nil {
+			log.Printf("Error pruning expired user tokens: %v", err)
+		}
+		if err := identityRepo.PruneLoginStates(time.Now()); err != nil {
+			log.Printf("Error pruning expired sign in states: %v", err)
+		}
+	}
+}
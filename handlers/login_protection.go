@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/repositories"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// backoffThreshold is how many failed logins an account can have before each retry is delayed
+	backoffThreshold = 3
+
+	// maxBackoff caps the delay between login attempts on an account
+	maxBackoff = 5 * time.Minute
+
+	// maxLoginFailures is how many failed logins lock an account
+	maxLoginFailures = 10
+
+	// lockoutDuration is how long an account stays locked after its last failed login
+	lockoutDuration = 30 * time.Minute
+
+	// maxIPLoginFailures is how many failed logins an IP address can make within ipFailureWindow
+	maxIPLoginFailures = 50
+
+	// ipFailureWindow is the period over which failed logins per IP address are counted
+	ipFailureWindow = 15 * time.Minute
+
+	// accountUnlockTTL is how long the link in a lockout email stays valid
+	accountUnlockTTL = 24 * time.Hour
+
+	// loginAttemptRetention is how long login attempts are kept for auditing
+	loginAttemptRetention = 90 * 24 * time.Hour
+)
+
+// loginThrottle decides whether a login attempt may go ahead. It returns how long the client must
+// wait before trying again, or zero when the attempt is allowed. Failures are tracked per username
+// whether or not the account exists so that throttling doesn't reveal which usernames are taken.
+func loginThrottle(loginAttemptRepo *repositories.LoginAttemptRepository, username, ipAddress string) (time.Duration, error) {
+	now := time.Now()
+
+	ipFailures, err := loginAttemptRepo.RecentFailuresByIP(ipAddress, now.Add(-ipFailureWindow))
+	if err != nil {
+		return 0, err
+	}
+	if ipFailures >= maxIPLoginFailures {
+		return ipFailureWindow, nil
+	}
+
+	failures, lastFailure, err := loginAttemptRepo.RecentFailures(username, now.Add(-lockoutDuration))
+	if err != nil {
+		return 0, err
+	}
+	if failures < backoffThreshold {
+		return 0, nil
+	}
+
+	// Locked accounts wait out the lockout from their last failure; others back off exponentially
+	wait := lockoutDuration
+	if failures < maxLoginFailures {
+		wait = time.Duration(math.Pow(2, float64(failures-backoffThreshold))) * time.Second
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+	}
+
+	if remaining := lastFailure.Add(wait).Sub(now); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// recordLoginAttempt stores a login attempt for auditing and throttling
+func recordLoginAttempt(loginAttemptRepo *repositories.LoginAttemptRepository, r *http.Request, username string, success bool, reason string) {
+	attempt := &models.LoginAttempt{
+		Username:  username,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+	}
+	if err := loginAttemptRepo.RecordAttempt(attempt); err != nil {
+		log.Printf("Error recording login attempt: %v", err)
+	}
+}
+
+// lockAccountIfNeeded emails the account owner an unlock link when failed logins have locked the account.
+// Concurrent failures can push the count past the limit together, so the email is claimed in the
+// database and sent once per lockout.
+func lockAccountIfNeeded(loginAttemptRepo *repositories.LoginAttemptRepository, userRepo *repositories.UserRepository,
+	userTokenRepo *repositories.UserTokenRepository, username string) {
+	now := time.Now()
+	failures, _, err := loginAttemptRepo.RecentFailures(username, now.Add(-lockoutDuration))
+	if err != nil || failures < maxLoginFailures {
+		return
+	}
+
+	userID, err := userRepo.GetUserIDByUsername(username)
+	if err != nil {
+		return
+	}
+	claimed, err := userRepo.ClaimLockoutNotice(userID, now, now.Add(-lockoutDuration))
+	if err != nil || !claimed {
+		return
+	}
+	user, err := userRepo.GetUserByID(userID)
+	if err != nil {
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating account unlock token: %v", err)
+		return
+	}
+	if err := userTokenRepo.CreateToken(userID, models.UserTokenAccountUnlock, tokenHash, time.Now().Add(accountUnlockTTL)); err != nil {
+		return
+	}
+
+	link := appURL("/account/unlock?token=" + url.QueryEscape(token))
+	body := "Hi " + user.Username + ",\n\nThere have been " + strconv.Itoa(maxLoginFailures) + " failed attempts to log in to your account, "
+	body += "so it has been locked for " + strconv.Itoa(int(lockoutDuration.Minutes())) + " minutes.\n\n"
+	body += "If this was you, you can unlock your account straight away with the link below:\n\n" + link + "\n\n"
+	body += "If it wasn't you, consider resetting your password. You can review recent login attempts on your profile.\n\n"
+	body += "Best regards,\nThe Event Team"
+	if err := sendEmail([]string{user.Email}, "Your account has been locked", body); err != nil {
+		log.Printf("Error sending account lockout email to user %d: %v", userID, err)
+	}
+}
+
+// UnlockAccount handles the link from a lockout email and redirects to the login page with the outcome
+func UnlockAccount(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository, loginAttemptRepo *repositories.LoginAttemptRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		userID, err := userTokenRepo.ConsumeToken(models.UserTokenAccountUnlock, auth.HashToken(token))
+		if err != nil {
+			http.Redirect(w, r, "/login.html?unlocked=false", http.StatusSeeOther)
+			return
+		}
+
+		user, err := userRepo.GetUserByID(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// A successful entry resets the failure count for the account
+		recordLoginAttempt(loginAttemptRepo, r, user.Username, true, models.LoginUnlocked)
+		http.Redirect(w, r, "/login.html?unlocked=true", http.StatusSeeOther)
+	}
+}
+
+// GetLoginAttempts lets the authenticated user review recent login attempts against their account
+func GetLoginAttempts(loginAttemptRepo *repositories.LoginAttemptRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		limit := 50
+		if l := r.URL.Query().Get("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed < 1 || parsed > 200 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		attempts, err := loginAttemptRepo.GetAttempts(userID, limit)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(attempts)
+	}
+}
+
+func ScheduleLoginAttemptPruning(loginAttemptRepo *repositories.LoginAttemptRepository) {
+	ticker := time.NewTicker(24 * time.Hour) // Run the task every 24 hours
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := loginAttemptRepo.PruneAttempts(time.Now().Add(-loginAttemptRetention)); err != nil {
+			log.Printf("Error pruning login attempts: %v", err)
+		}
+	}
+}
+
+// trustedProxyHeader names the header a reverse proxy in front of the application puts the client's
+// address in, such as X-Forwarded-For or X-Real-IP. Set it with TRUSTED_PROXY_HEADER only when every
+// request comes through that proxy, since clients can send the header themselves.
+var trustedProxyHeader = os.Getenv("TRUSTED_PROXY_HEADER")
+
+// clientIP returns the IP address the request was made from
+func clientIP(r *http.Request) string {
+	if trustedProxyHeader != "" {
+		// The proxy appends the address it saw to any list the client sent, so the last entry is the one to trust
+		values := strings.Split(r.Header.Get(trustedProxyHeader), ",")
+		if ip := net.ParseIP(strings.TrimSpace(values[len(values)-1])); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,18 +1,12 @@
 package handlers
 
 import (
-	"context"
 	"event-connect/auth"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 )
 
-type contextKey string
-
-const userIDKey contextKey = "userID"
-
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -24,27 +18,23 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header value
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		// Strip the "Bearer " prefix from the token string
-		authHeader = strings.TrimPrefix(authHeader, "Bearer ")
-
-		// Verify the token
-		userID, err := auth.VerifyToken(authHeader)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
+// currentPrincipal returns the principal stored by the auth middleware, writing a
+// 401 response when the request is not authenticated
+func currentPrincipal(w http.ResponseWriter, r *http.Request) (*auth.Principal, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Authentication required", nil)
+		return nil, false
+	}
+	return principal, true
+}
 
-		// Add the user ID to the request context
-		ctx := context.WithValue(r.Context(), userIDKey, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+// currentUserID returns the ID of the authenticated user, writing a 401 response
+// when the request is not authenticated
+func currentUserID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return 0, false
+	}
+	return principal.UserID, true
 }
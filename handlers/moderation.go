@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"event-connect/models"
+	"event-connect/repositories"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// *************************** Blocking ***************************
+
+// GetBlockedUsers returns the users the current user has blocked
+func GetBlockedUsers(blockRepo *repositories.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		blocked, err := blockRepo.GetBlockedUsers(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocked)
+	}
+}
+
+// BlockUser blocks another user for the current user. Their comments are hidden from the current
+// user, neither is recommended to the other, they are never placed in the same team and any
+// friendship between them ends. The blocked user isn't told.
+func BlockUser(blockRepo *repositories.BlockRepository, userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+		blockedID, ok := moderatedUserID(w, r, userRepo)
+		if !ok {
+			return
+		}
+		if blockedID == userID {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_block", "You can't block yourself", nil)
+			return
+		}
+
+		if err := blockRepo.BlockUser(userID, blockedID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// UnblockUser removes a block the current user placed on another user
+func UnblockUser(blockRepo *repositories.BlockRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+		blockedID, err := strconv.ParseUint(mux.Vars(r)["userId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := blockRepo.UnblockUser(userID, uint(blockedID)); err != nil {
+			if errors.Is(err, repositories.ErrBlockNotFound) {
+				writeJSONError(w, http.StatusNotFound, "block_not_found", "You haven't blocked this user", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// *************************** Reporting ***************************
+
+// ReportUser adds a report of another user to the moderator queue
+func ReportUser(reportRepo *repositories.ReportRepository, userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			UserID  uint   `json:"userId"`
+			Reason  string `json:"reason"`
+			Details string `json:"details"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		requestBody.Reason = strings.ToLower(strings.TrimSpace(requestBody.Reason))
+		requestBody.Details = strings.TrimSpace(requestBody.Details)
+
+		fieldErrors := map[string]string{}
+		switch {
+		case requestBody.UserID == 0:
+			fieldErrors["userId"] = "is required"
+		case requestBody.UserID == userID:
+			fieldErrors["userId"] = "can't be yourself"
+		}
+		switch {
+		case !models.IsReportReason(requestBody.Reason):
+			fieldErrors["reason"] = "must be one of " + strings.Join(models.ReportReasons, ", ")
+		case requestBody.Reason == models.ReportOther && requestBody.Details == "":
+			fieldErrors["details"] = "is required when the reason is other"
+		}
+		if len(requestBody.Details) > models.MaxReportDetailsLength {
+			fieldErrors["details"] = "must be at most " + strconv.Itoa(models.MaxReportDetailsLength) + " characters"
+		}
+		if len(fieldErrors) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors)
+			return
+		}
+
+		if _, err := userRepo.GetUserByID(requestBody.UserID); err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		reportID, err := reportRepo.CreateReport(userID, requestBody.UserID, requestBody.Reason, requestBody.Details)
+		if err != nil {
+			if errors.Is(err, repositories.ErrReportAlreadyOpen) {
+				writeJSONError(w, http.StatusConflict, "report_already_open", "You have already reported this user and a moderator will review it", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d reported user %d for %s", userID, requestBody.UserID, requestBody.Reason)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": reportID, "status": models.ReportOpen})
+	}
+}
+
+// GetReports returns the moderator queue: open reports by default, oldest first, or the reports with
+// the status in the status parameter. Results are paged with limit and offset.
+func GetReports(reportRepo *repositories.ReportRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		status := query.Get("status")
+		if status == "" {
+			status = models.ReportOpen
+		}
+		if status != models.ReportOpen && status != models.ReportActioned && status != models.ReportDismissed {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+
+		limit := 50
+		if l := query.Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		offset := 0
+		if o := query.Get("offset"); o != "" {
+			var err error
+			offset, err = strconv.Atoi(o)
+			if err != nil || offset < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+		}
+
+		reports, err := reportRepo.GetReports(status, limit, offset)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports)
+	}
+}
+
+// ResolveReport closes an open report, either as actioned or dismissed, with an optional note.
+// Suspending the reported account is a separate admin action.
+func ResolveReport(reportRepo *repositories.ReportRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		reportID, err := strconv.ParseUint(mux.Vars(r)["reportId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestBody struct {
+			Status string `json:"status"`
+			Note   string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if requestBody.Status != models.ReportActioned && requestBody.Status != models.ReportDismissed {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid",
+				map[string]string{"status": "must be one of " + models.ReportActioned + ", " + models.ReportDismissed})
+			return
+		}
+
+		_, err = reportRepo.ResolveReport(uint(reportID), principal.UserID, requestBody.Status, strings.TrimSpace(requestBody.Note))
+		if err != nil {
+			switch {
+			case errors.Is(err, repositories.ErrReportNotFound):
+				writeJSONError(w, http.StatusNotFound, "report_not_found", "Report not found", nil)
+			case errors.Is(err, repositories.ErrReportAlreadyResolved):
+				writeJSONError(w, http.StatusConflict, "report_already_resolved", "This report has already been resolved", nil)
+			default:
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// *************************** Suspensions ***************************
+
+// GetUserSuspension returns whether a user's account is suspended, and why
+func GetUserSuspension(userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := moderatedUserID(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		suspension, err := userRepo.GetSuspension(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"userId": userID, "suspended": suspension != nil, "suspension": suspension})
+	}
+}
+
+// SuspendUser suspends a user's account. Every session of the user is revoked straight away and they
+// can't sign in again, with a password or a provider, until the suspension is lifted.
+func SuspendUser(userRepo *repositories.UserRepository, tokenRepo *repositories.TokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+		userID, ok := moderatedUserID(w, r, userRepo)
+		if !ok {
+			return
+		}
+		if userID == principal.UserID {
+			writeJSONError(w, http.StatusConflict, "cannot_suspend_self", "Admins cannot suspend their own account", nil)
+			return
+		}
+
+		var requestBody struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		requestBody.Reason = strings.TrimSpace(requestBody.Reason)
+		if requestBody.Reason == "" {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", map[string]string{"reason": "is required"})
+			return
+		}
+
+		if err := userRepo.SuspendUser(userID, requestBody.Reason); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := tokenRepo.RevokeAllForUser(userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Admin %d suspended user %d", principal.UserID, userID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// UnsuspendUser lifts the suspension of a user's account so they can sign in again
+func UnsuspendUser(userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+		userID, ok := moderatedUserID(w, r, userRepo)
+		if !ok {
+			return
+		}
+
+		if err := userRepo.UnsuspendUser(userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Admin %d lifted the suspension of user %d", principal.UserID, userID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// refuseInactiveLogin rejects a login by a suspended or deleted account, writing the error response
+// and returning true when the account can't be used. A deleted account looks like wrong credentials.
+func refuseInactiveLogin(w http.ResponseWriter, r *http.Request, userRepo *repositories.UserRepository,
+	loginAttemptRepo *repositories.LoginAttemptRepository, user *models.User) bool {
+	deleted, err := userRepo.IsDeleted(user.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	if deleted {
+		recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginInvalidCredentials)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid username or password", nil)
+		return true
+	}
+
+	suspension, err := userRepo.GetSuspension(user.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	if suspension == nil {
+		return false
+	}
+
+	recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginSuspended)
+	writeJSONError(w, http.StatusForbidden, "account_suspended", "Your account has been suspended", nil)
+	return true
+}
+
+// moderatedUserID reads the user ID path parameter and checks the user exists, writing the error
+// response and returning false when it doesn't
+func moderatedUserID(w http.ResponseWriter, r *http.Request, userRepo *repositories.UserRepository) (uint, bool) {
+	userID, err := strconv.ParseUint(mux.Vars(r)["userId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	if _, err := userRepo.GetUserByID(uint(userID)); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found", nil)
+			return 0, false
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return uint(userID), true
+}
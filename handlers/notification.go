@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"event-connect/models"
+	"event-connect/repositories"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// notificationRetention is how long read notifications are kept before being pruned
+const notificationRetention = 30 * 24 * time.Hour
+
+// *************************** Notifier ***************************
+
+// Notifier delivers notifications in-app and by email according to each user's preferences
+type Notifier struct {
+	notificationRepo *repositories.NotificationRepository
+}
+
+// NewNotifier creates a new instance of Notifier
+func NewNotifier(notificationRepo *repositories.NotificationRepository) *Notifier {
+	return &Notifier{notificationRepo: notificationRepo}
+}
+
+// Notify delivers a notification of the given type to a user
+func (n *Notifier) Notify(userID uint, notificationType, title, body, link string) error {
+	pref, err := n.notificationRepo.GetPreference(userID, notificationType)
+	if err != nil {
+		return err
+	}
+
+	if pref.InApp {
+		notification := &models.Notification{
+			UserID: userID,
+			Type:   notificationType,
+			Title:  title,
+			Body:   body,
+			Link:   link,
+		}
+		if err := n.notificationRepo.CreateNotification(notification); err != nil {
+			return err
+		}
+	}
+
+	if pref.Email {
+		email, verified, err := n.notificationRepo.GetUserEmail(userID)
+		if err != nil {
+			return err
+		}
+		if !verified && models.RequireVerifiedEmail {
+			return nil
+		}
+		if err := sendEmail([]string{email}, title, body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// *************************** Handler Functions ***************************
+
+func GetNotifications(notificationRepo *repositories.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var err error
+		query := r.URL.Query()
+		limit := 20
+		if l := query.Get("limit"); l != "" {
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+		offset := 0
+		if o := query.Get("offset"); o != "" {
+			offset, err = strconv.Atoi(o)
+			if err != nil || offset < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+		}
+		unreadOnly := query.Get("unread") == "true"
+
+		notifications, err := notificationRepo.GetNotifications(userID, unreadOnly, limit, offset)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(notifications)
+	}
+}
+
+func GetUnreadNotificationCount(notificationRepo *repositories.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		count, err := notificationRepo.UnreadCount(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"unread": count})
+	}
+}
+
+func MarkNotificationRead(notificationRepo *repositories.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		notificationID, err := strconv.ParseUint(mux.Vars(r)["notificationId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+
+		err = notificationRepo.MarkRead(userID, uint(notificationID))
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotificationNotFound) {
+				http.Error(w, "Notification not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func MarkAllNotificationsRead(notificationRepo *repositories.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		updated, err := notificationRepo.MarkAllRead(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"updated": updated})
+	}
+}
+
+func GetNotificationPreferences(notificationRepo *repositories.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		preferences, err := notificationRepo.GetPreferences(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(preferences)
+	}
+}
+
+func UpdateNotificationPreferences(notificationRepo *repositories.NotificationRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var preferences []models.NotificationPreference
+		if err := json.NewDecoder(r.Body).Decode(&preferences); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		for _, pref := range preferences {
+			if !models.IsNotificationType(pref.Type) {
+				http.Error(w, "Unknown notification type: "+pref.Type, http.StatusBadRequest)
+				return
+			}
+		}
+
+		for _, pref := range preferences {
+			if err := notificationRepo.SetPreference(userID, pref); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		updated, err := notificationRepo.GetPreferences(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+// *************************** Scheduled Jobs ***************************
+
+func ScheduleNotificationPruning(notificationRepo *repositories.NotificationRepository) {
+	ticker := time.NewTicker(24 * time.Hour) // Run the task every 24 hours
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pruned, err := notificationRepo.PruneReadNotifications(time.Now().Add(-notificationRetention))
+		if err != nil {
+			log.Printf("Error pruning read notifications: %v", err)
+			continue
+		}
+		log.Printf("Pruned %d read notifications", pruned)
+	}
+}
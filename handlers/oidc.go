@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/oidc"
+	"event-connect/repositories"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// oidcStateTTL is how long a user has to finish signing in at the provider
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	// errOIDCEmailNotVerified is returned when the provider hasn't verified the account's email address
+	errOIDCEmailNotVerified = errors.New("email not verified")
+	// errOIDCAccountEmailNotVerified is returned when the matching user hasn't verified their email address
+	errOIDCAccountEmailNotVerified = errors.New("account email not verified")
+)
+
+// oidcStateCookie names the cookie that ties a sign in to the browser that started it, so that a
+// callback URL from someone else's sign in can't log this browser in to their account
+func oidcStateCookie(provider string) string {
+	return "oidc_state_" + provider
+}
+
+// OIDCCallbackURL returns the URL a provider redirects back to after the user signs in
+func OIDCCallbackURL(provider string) string {
+	return appURL("/auth/oidc/" + url.PathEscape(provider) + "/callback")
+}
+
+// GetOIDCProviders lists the providers users can sign in with
+func GetOIDCProviders(providers map[string]*oidc.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names := []string{}
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"providers": names})
+	}
+}
+
+// OIDCLogin sends the user to a provider to sign in. The state, nonce and PKCE verifier are stored
+// so the callback can check that the response belongs to a sign in started here, and the hash of
+// the state is set in a cookie so that it must also come back to the same browser.
+func OIDCLogin(providers map[string]*oidc.Provider, identityRepo *repositories.IdentityRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["provider"]
+		provider, ok := providers[name]
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "unknown_provider", "Sign in with this provider is not available", nil)
+			return
+		}
+
+		state, stateHash, err := auth.GenerateOpaqueToken()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		nonce, err := oidc.RandomString()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		codeVerifier, codeChallenge, err := oidc.NewPKCE()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, codeChallenge)
+		if err != nil {
+			log.Printf("Error starting sign in with %s: %v", name, err)
+			redirectOIDCFailure(w, r, "unavailable")
+			return
+		}
+
+		loginState := models.OIDCLoginState{Provider: name, Nonce: nonce, CodeVerifier: codeVerifier}
+		if err := identityRepo.SaveLoginState(stateHash, loginState, time.Now().Add(oidcStateTTL)); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie(name),
+			Value:    stateHash,
+			Path:     "/auth/oidc/" + url.PathEscape(name),
+			MaxAge:   int(oidcStateTTL.Seconds()),
+			Secure:   strings.HasPrefix(appURL("/"), "https://"),
+			HttpOnly: true,
+			// Lax still sends the cookie on the provider's top-level redirect back to the callback
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// OIDCCallback completes a sign in when the provider redirects back. The user is matched by their
+// account at the provider, or linked by verified email address, or a new account is created.
+// Tokens are passed to the login page in the URL fragment so that they are never sent to a server.
+func OIDCCallback(providers map[string]*oidc.Provider, identityRepo *repositories.IdentityRepository, userRepo *repositories.UserRepository,
+	tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository, totpRepo *repositories.TOTPRepository,
+	loginAttemptRepo *repositories.LoginAttemptRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["provider"]
+		provider, ok := providers[name]
+		if !ok {
+			redirectOIDCFailure(w, r, "unavailable")
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("error") != "" {
+			redirectOIDCFailure(w, r, "cancelled")
+			return
+		}
+
+		// The state must belong to a sign in this browser started
+		stateHash := auth.HashToken(query.Get("state"))
+		cookie, err := r.Cookie(oidcStateCookie(name))
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie(name), Path: "/auth/oidc/" + url.PathEscape(name), MaxAge: -1, HttpOnly: true})
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+			redirectOIDCFailure(w, r, "expired")
+			return
+		}
+
+		loginState, err := identityRepo.ConsumeLoginState(stateHash)
+		if err != nil {
+			if !errors.Is(err, repositories.ErrInvalidLoginState) {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			redirectOIDCFailure(w, r, "expired")
+			return
+		}
+		if loginState.Provider != name {
+			redirectOIDCFailure(w, r, "expired")
+			return
+		}
+
+		token, err := provider.Exchange(r.Context(), query.Get("code"), loginState.CodeVerifier)
+		if err != nil {
+			log.Printf("Error exchanging authorization code with %s: %v", name, err)
+			redirectOIDCFailure(w, r, "failed")
+			return
+		}
+		idToken, err := provider.VerifyIDToken(r.Context(), token.IDToken, loginState.Nonce)
+		if err != nil {
+			log.Printf("Error verifying ID token from %s: %v", name, err)
+			redirectOIDCFailure(w, r, "failed")
+			return
+		}
+
+		userID, err := resolveOIDCUser(identityRepo, userRepo, name, idToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, errOIDCEmailNotVerified):
+				redirectOIDCFailure(w, r, "email_not_verified")
+			case errors.Is(err, errOIDCAccountEmailNotVerified):
+				redirectOIDCFailure(w, r, "account_email_not_verified")
+			default:
+				log.Printf("Error signing in user from %s: %v", name, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		user, err := userRepo.GetUserByID(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Deleted and suspended accounts can't sign in through a provider either
+		deleted, err := userRepo.IsDeleted(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if deleted {
+			recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginInvalidCredentials)
+			redirectOIDCFailure(w, r, "account_deleted")
+			return
+		}
+
+		suspension, err := userRepo.GetSuspension(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if suspension != nil {
+			recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginSuspended)
+			redirectOIDCFailure(w, r, "account_suspended")
+			return
+		}
+
+		// Two-factor authentication still applies when signing in through a provider
+		mfaEnabled, err := totpRepo.IsEnabled(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if mfaEnabled {
+			challengeToken, err := auth.GenerateMFAChallenge(userID)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/login.html#"+url.Values{"challengeToken": {challengeToken}}.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		recordLoginAttempt(loginAttemptRepo, r, user.Username, true, models.LoginSingleSignOn)
+
+		session, err := issueSession(tokenRepo, roleRepo, userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		fragment := url.Values{
+			"token":        {session.Token},
+			"refreshToken": {session.RefreshToken},
+			"expiresIn":    {strconv.Itoa(session.ExpiresIn)},
+		}
+		http.Redirect(w, r, "/login.html#"+fragment.Encode(), http.StatusSeeOther)
+	}
+}
+
+// GetLinkedIdentities lists the provider accounts the current user can sign in with
+func GetLinkedIdentities(identityRepo *repositories.IdentityRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		identities, err := identityRepo.GetIdentities(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(identities)
+	}
+}
+
+// resolveOIDCUser finds or creates the user for an account at a provider. An existing user is only
+// linked by email when both the provider and this application have verified the address, so that
+// nobody can take over an account by registering its email address unverified on either side.
+func resolveOIDCUser(identityRepo *repositories.IdentityRepository, userRepo *repositories.UserRepository, provider string, idToken *oidc.IDToken) (uint, error) {
+	userID, err := identityRepo.GetUserIDByIdentity(provider, idToken.Subject)
+	if err == nil {
+		identityRepo.RecordIdentityLogin(provider, idToken.Subject, idToken.Email)
+		return userID, nil
+	}
+	if !errors.Is(err, repositories.ErrIdentityNotFound) {
+		return 0, err
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return 0, errOIDCEmailNotVerified
+	}
+
+	userID, err = userRepo.GetUserIDByEmail(idToken.Email)
+	if err == nil {
+		user, err := userRepo.GetUserProfile(userID)
+		if err != nil {
+			return 0, err
+		}
+		if user.EmailVerifiedAt == nil {
+			return 0, errOIDCAccountEmailNotVerified
+		}
+		if err := identityRepo.LinkIdentity(userID, provider, idToken.Subject, idToken.Email); err != nil {
+			return 0, err
+		}
+		go sendIdentityLinkedEmail(user, provider)
+		return userID, nil
+	}
+	if !errors.Is(err, repositories.ErrUserNotFound) {
+		return 0, err
+	}
+
+	user, err := createOIDCUser(userRepo, idToken)
+	if err != nil {
+		return 0, err
+	}
+	if err := identityRepo.LinkIdentity(user.ID, provider, idToken.Subject, idToken.Email); err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// createOIDCUser creates an account for someone signing in through a provider for the first time.
+// The account gets an unguessable password; the user can set one with a password reset.
+func createOIDCUser(userRepo *repositories.UserRepository, idToken *oidc.IDToken) (*models.User, error) {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := availableUsername(userRepo, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username: username,
+		Email:    idToken.Email,
+		Password: string(hashedPassword),
+		LastName: idToken.FamilyName,
+	}
+	if idToken.GivenName != "" {
+		user.FirstName = &idToken.GivenName
+	}
+
+	if err := userRepo.CreateUser(user); err != nil {
+		return nil, err
+	}
+	// The provider has already verified the address
+	if err := userRepo.MarkEmailVerified(user.ID, user.Email); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Created user %d from sign in with a provider", user.ID)
+	return user, nil
+}
+
+// availableUsername derives an unused username from the provider's preferred username or email address
+func availableUsername(userRepo *repositories.UserRepository, idToken *oidc.IDToken) (string, error) {
+	base := idToken.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(idToken.Email, "@", 2)[0]
+	}
+
+	var cleaned strings.Builder
+	for _, c := range strings.ToLower(base) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '.' || c == '-' {
+			cleaned.WriteRune(c)
+		}
+	}
+	base = cleaned.String()
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 30 {
+		base = base[:30]
+	}
+
+	candidate := base
+	for i := 0; i < 10; i++ {
+		_, err := userRepo.GetUserIDByUsername(candidate)
+		if err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				return candidate, nil
+			}
+			return "", err
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, suffix.Int64())
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
+
+// sendIdentityLinkedEmail tells a user that a provider account can now sign in to their account
+func sendIdentityLinkedEmail(user *models.User, provider string) {
+	body := "Hi " + user.Username + ",\n\nYour account can now be signed in to with " + provider + ", because it uses the same verified email address.\n\n"
+	body += "If this wasn't you, reset your password and contact us straight away.\n\n"
+	body += "Best regards,\nThe Event Team"
+	if err := sendEmail([]string{user.Email}, "A new sign in method was added to your account", body); err != nil {
+		log.Printf("Error sending identity linked email to user %d: %v", user.ID, err)
+	}
+}
+
+// redirectOIDCFailure sends the user back to the login page with the reason a sign in failed
+func redirectOIDCFailure(w http.ResponseWriter, r *http.Request, reason string) {
+	http.Redirect(w, r, "/login.html?signInError="+url.QueryEscape(reason), http.StatusSeeOther)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/repositories"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// maxPasswordResetsPerHour limits how many reset emails an account can be sent in an hour
+const maxPasswordResetsPerHour = 3
+
+// minPasswordLength is the shortest password accepted when setting a new password
+const minPasswordLength = 8
+
+// forgotPasswordMessage is returned for every forgot password request so that responses
+// don't reveal whether an email address belongs to an account
+const forgotPasswordMessage = "If an account exists for that email address, a password reset link has been sent"
+
+// ForgotPassword emails a single-use password reset link to the account with the posted email address,
+// answering the same way whether or not such an account exists
+func ForgotPassword(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var requestBody struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || strings.TrimSpace(requestBody.Email) == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Look up the account and send the email in the background so that the response is the
+		// same, in content and timing, whether or not the address belongs to an account
+		go sendPasswordReset(userRepo, userTokenRepo, strings.TrimSpace(requestBody.Email))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": forgotPasswordMessage})
+	}
+}
+
+func sendPasswordReset(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository, email string) {
+	userID, err := userRepo.GetUserIDByEmail(email)
+	if err != nil {
+		if !errors.Is(err, repositories.ErrUserNotFound) {
+			log.Printf("Error looking up account for password reset: %v", err)
+		}
+		return
+	}
+
+	recent, err := userTokenRepo.CountRecentTokens(userID, models.UserTokenPasswordReset, time.Now().Add(-time.Hour))
+	if err != nil {
+		return
+	}
+	if recent >= maxPasswordResetsPerHour {
+		log.Printf("Password reset rate limit reached for user %d", userID)
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating password reset token: %v", err)
+		return
+	}
+	if err := userTokenRepo.CreateToken(userID, models.UserTokenPasswordReset, tokenHash, time.Now().Add(passwordResetTTL)); err != nil {
+		return
+	}
+
+	link := appURL("/reset-password.html?token=" + url.QueryEscape(token))
+	body := "Hi,\n\nWe received a request to reset your password. Use the link below to choose a new one:\n\n" + link + "\n\n"
+	body += "The link expires in 1 hour and can only be used once. If you didn't ask to reset your password, you can ignore this email.\n\n"
+	body += "Best regards,\nThe Event Team"
+	if err := sendEmail([]string{email}, "Reset your password", body); err != nil {
+		log.Printf("Error sending password reset email to user %d: %v", userID, err)
+	}
+}
+
+// ResetPassword sets a new password using an emailed reset token and signs the user out everywhere
+func ResetPassword(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository, tokenRepo *repositories.TokenRepository,
+	loginAttemptRepo *repositories.LoginAttemptRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var requestBody struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Token == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Validate the password before consuming the token so a rejected password can be retried
+		if len(requestBody.Password) < minPasswordLength {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_password", "Password must be at least 8 characters", nil)
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(requestBody.Password), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := userTokenRepo.ConsumeToken(models.UserTokenPasswordReset, auth.HashToken(requestBody.Token))
+		if err != nil {
+			if errors.Is(err, repositories.ErrInvalidToken) {
+				writeJSONError(w, http.StatusBadRequest, "invalid_token", "This password reset link is invalid or has expired", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := userRepo.UpdatePassword(userID, string(hashedPassword)); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Sign out every existing session; whoever knew the old password may still hold one
+		if err := tokenRepo.RevokeAllForUser(userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Choosing a new password also lifts any lockout on the account
+		if user, err := userRepo.GetUserByID(userID); err == nil {
+			recordLoginAttempt(loginAttemptRepo, r, user.Username, true, models.LoginPasswordReset)
+		}
+
+		go sendPasswordChangedEmail(userRepo, userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset. Please log in with your new password."})
+	}
+}
+
+func sendPasswordChangedEmail(userRepo *repositories.UserRepository, userID uint) {
+	user, err := userRepo.GetUserByID(userID)
+	if err != nil {
+		return
+	}
+
+	body := "Hi " + user.Username + ",\n\nThe password for your account was just changed and all of your sessions were signed out.\n\n"
+	body += "If you didn't make this change, reset your password straight away.\n\n"
+	body += "Best regards,\nThe Event Team"
+	if err := sendEmail([]string{user.Email}, "Your password was changed", body); err != nil {
+		log.Printf("Error sending password changed email to user %d: %v", userID, err)
+	}
+}
+
+// appURL returns an absolute link to a page of the application, based on APP_BASE_URL
+func appURL(path string) string {
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+	return strings.TrimRight(baseURL, "/") + path
+}
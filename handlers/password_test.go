@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"event-connect/auth"
+	"event-connect/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendPasswordResetRateLimit(t *testing.T) {
+	// Without an API key no email leaves the test
+	t.Setenv("SENDGRID_API_KEY", "")
+
+	tests := []struct {
+		name   string
+		email  string
+		recent int64
+		sent   bool
+	}{
+		{name: "first reset of the hour", email: "ada@example.com", recent: 0, sent: true},
+		{name: "last reset allowed in the hour", email: "ada@example.com", recent: maxPasswordResetsPerHour - 1, sent: true},
+		{name: "limit reached", email: "ada@example.com", recent: maxPasswordResetsPerHour},
+		{name: "no account for the address", email: "nobody@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t, func(query string, args []driver.Value) ([][]driver.Value, error) {
+				switch {
+				case strings.Contains(query, "FROM users WHERE LOWER(email)"):
+					if args[0] == "ada@example.com" {
+						return [][]driver.Value{{int64(7)}}, nil
+					}
+					return nil, nil
+				case strings.Contains(query, "SELECT COUNT(*) FROM user_tokens"):
+					return [][]driver.Value{{tt.recent}}, nil
+				}
+				return nil, nil
+			})
+
+			sendPasswordReset(repositories.NewUserRepository(db, testLogger()), repositories.NewUserTokenRepository(db, testLogger()), tt.email)
+
+			if sent := fake.ran("INSERT INTO user_tokens") == 1; sent != tt.sent {
+				t.Errorf("reset token issued = %v, want %v", sent, tt.sent)
+			}
+		})
+	}
+}
+
+func TestResetPasswordConsumesTokenOnce(t *testing.T) {
+	tokenHash := auth.HashToken("reset-token")
+	used := false
+	db, fake := newFakeDB(t, func(query string, args []driver.Value) ([][]driver.Value, error) {
+		if strings.Contains(query, "UPDATE user_tokens SET used_at = $1") && strings.Contains(query, "token_hash = $2") {
+			if args[1] != tokenHash || used {
+				return nil, nil
+			}
+			used = true
+			return [][]driver.Value{{int64(7), nil}}, nil
+		}
+		return nil, nil
+	})
+	handler := ResetPassword(repositories.NewUserRepository(db, testLogger()), repositories.NewUserTokenRepository(db, testLogger()),
+		repositories.NewTokenRepository(db, testLogger()), repositories.NewLoginAttemptRepository(db, testLogger()))
+
+	reset := func(token, password string) (int, string) {
+		body := `{"token": "` + token + `", "password": "` + password + `"}`
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(body)))
+
+		var apiError APIError
+		json.NewDecoder(rec.Body).Decode(&apiError)
+		return rec.Code, apiError.Error
+	}
+
+	// A rejected password leaves the token for another try
+	if status, code := reset("reset-token", "short"); status != http.StatusUnprocessableEntity || code != "invalid_password" {
+		t.Errorf("reset with a short password = %d %q, want 422 invalid_password", status, code)
+	}
+	if used {
+		t.Fatal("reset with a short password consumed the token")
+	}
+
+	if status, _ := reset("reset-token", "a new password"); status != http.StatusOK {
+		t.Fatalf("reset = %d, want 200", status)
+	}
+	if fake.ran("UPDATE users SET password") != 1 || fake.ran("UPDATE token_families SET revoked_at") != 1 {
+		t.Error("reset didn't update the password and sign out every session")
+	}
+
+	if status, code := reset("reset-token", "another password"); status != http.StatusBadRequest || code != "invalid_token" {
+		t.Errorf("second reset with the same token = %d %q, want 400 invalid_token", status, code)
+	}
+	if status, code := reset("unknown-token", "another password"); status != http.StatusBadRequest || code != "invalid_token" {
+		t.Errorf("reset with an unknown token = %d %q, want 400 invalid_token", status, code)
+	}
+	if fake.ran("UPDATE users SET password") != 1 {
+		t.Error("a rejected token changed the password")
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"event-connect/geo"
+	"event-connect/models"
+	"event-connect/repositories"
+	"event-connect/storage"
+	"log"
+	"net/http"
+)
+
+// patchableProfileFields are the profile fields, by JSON name, that PATCH /profile can change
+var patchableProfileFields = map[string]bool{
+	"username":           true,
+	"email":              true,
+	"firstName":          true,
+	"lastName":           true,
+	"bio":                true,
+	"interests":          true,
+	"location":           true,
+	"latitude":           true,
+	"longitude":          true,
+	"age":                true,
+	"gender":             true,
+	"instagramUsername":  true,
+	"facebookUsername":   true,
+	"snapchatUsername":   true,
+	"ageMin":             true,
+	"ageMax":             true,
+	"distancePreference": true,
+}
+
+// PatchUserProfile applies a JSON Merge Patch (RFC 7396) to the current user's profile: fields present
+// in the body are replaced, null clears a field and omitted fields are left unchanged. The patched
+// profile is validated as a whole and every invalid field is reported.
+func PatchUserProfile(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository, geocoder geo.Geocoder, avatarStore storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var patch map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_patch", "The request body must be a JSON object", nil)
+			return
+		}
+
+		fieldErrors := map[string]string{}
+		for field := range patch {
+			if !patchableProfileFields[field] {
+				fieldErrors[field] = "cannot be changed"
+			}
+		}
+		if len(fieldErrors) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors)
+			return
+		}
+
+		current, err := userRepo.GetUserProfile(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		user, fieldErrors := applyProfilePatch(current, patch)
+		if len(fieldErrors) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors)
+			return
+		}
+
+		// Coordinates are only re-derived when the location changes
+		_, locationPatched := patch["location"]
+		_, latitudePatched := patch["latitude"]
+		_, longitudePatched := patch["longitude"]
+		if locationPatched || latitudePatched || longitudePatched {
+			if locationPatched && !latitudePatched && !longitudePatched {
+				user.Latitude, user.Longitude = 0, 0
+			}
+			if err := resolveLocation(geocoder, user); err != nil {
+				if err != geo.ErrLocationNotFound {
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				fieldErrors["location"] = "could not be resolved"
+			}
+		}
+
+		fieldErrors, err = validateUserProfile(userRepo, user, fieldErrors)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		// Fields saved before validation existed aren't reported unless the patch touches them
+		for field := range fieldErrors {
+			if !profileFieldPatched(patch, field) {
+				delete(fieldErrors, field)
+			}
+		}
+		if len(fieldErrors) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors)
+			return
+		}
+
+		if err := userRepo.UpdateUserProfileAndPreferences(user); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// A new email address has to be verified again
+		if user.Email != current.Email {
+			user.EmailVerifiedAt = nil
+			go func() {
+				if err := sendVerificationEmail(userTokenRepo, userID, user.Username, user.Email); err != nil {
+					log.Printf("Error sending verification email to user %d: %v", userID, err)
+				}
+			}()
+		}
+
+		user.Avatar = avatarURLs(avatarStore, user.AvatarKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+// applyProfilePatch merges patch into a copy of the user. It returns an error for each field whose
+// value has the wrong type.
+func applyProfilePatch(current *models.User, patch map[string]json.RawMessage) (*models.User, map[string]string) {
+	fieldErrors := map[string]string{}
+
+	patched := *current
+	for field, value := range patch {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			clearProfileField(&patched, field)
+			continue
+		}
+
+		// Each field is decoded on its own so that every type error can be reported
+		single, _ := json.Marshal(map[string]json.RawMessage{field: value})
+		if err := json.Unmarshal(single, &patched); err != nil {
+			fieldErrors[field] = "has the wrong type"
+		}
+	}
+	return &patched, fieldErrors
+}
+
+// profileFieldPatched reports whether a patch changes a field, or a field validated together with it
+func profileFieldPatched(patch map[string]json.RawMessage, field string) bool {
+	related := map[string][]string{
+		"ageMin":    {"ageMax"},
+		"ageMax":    {"ageMin"},
+		"latitude":  {"location", "longitude"},
+		"longitude": {"location", "latitude"},
+	}
+	if _, ok := patch[field]; ok {
+		return true
+	}
+	for _, other := range related[field] {
+		if _, ok := patch[other]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// clearProfileField resets a field to its empty value, as requested by a null in a merge patch.
+// Required fields cleared this way are reported by validation.
+func clearProfileField(user *models.User, field string) {
+	switch field {
+	case "username":
+		user.Username = ""
+	case "email":
+		user.Email = ""
+	case "firstName":
+		user.FirstName = nil
+	case "lastName":
+		user.LastName = ""
+	case "bio":
+		user.Bio = ""
+	case "interests":
+		user.Interests = ""
+	case "location":
+		user.Location = ""
+	case "latitude":
+		user.Latitude = 0
+	case "longitude":
+		user.Longitude = 0
+	case "age":
+		user.Age = 0
+	case "gender":
+		user.Gender = ""
+	case "instagramUsername":
+		user.InstagramUsername = ""
+	case "facebookUsername":
+		user.FacebookUsername = ""
+	case "snapchatUsername":
+		user.SnapchatUsername = ""
+	case "ageMin":
+		user.AgeMin = 0
+	case "ageMax":
+		user.AgeMax = 0
+	case "distancePreference":
+		user.DistancePreference = 0
+	}
+}
+
+// validateUserProfile normalises and validates a profile, adding to fieldErrors, and checks that a
+// new username or email address isn't already used by another account
+func validateUserProfile(userRepo *repositories.UserRepository, user *models.User, fieldErrors map[string]string) (map[string]string, error) {
+	models.NormaliseProfile(user)
+	for field, message := range models.ValidateProfile(user) {
+		if _, ok := fieldErrors[field]; !ok {
+			fieldErrors[field] = message
+		}
+	}
+
+	if _, invalid := fieldErrors["username"]; !invalid {
+		otherID, err := userRepo.GetUserIDByUsername(user.Username)
+		if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+			return nil, err
+		}
+		if err == nil && otherID != user.ID {
+			fieldErrors["username"] = "is already taken"
+		}
+	}
+	if _, invalid := fieldErrors["email"]; !invalid {
+		taken, err := userRepo.IsEmailTaken(user.Email, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			fieldErrors["email"] = "is already used by another account"
+		}
+	}
+
+	return fieldErrors, nil
+}
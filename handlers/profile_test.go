@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/repositories"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profileRow returns the columns GetUserProfile reads for a user, in order
+func profileRow(user models.User) []driver.Value {
+	var firstName driver.Value
+	if user.FirstName != nil {
+		firstName = *user.FirstName
+	}
+	return []driver.Value{
+		int64(user.ID), user.Username, user.Email, firstName, user.LastName, user.Bio, user.Interests, user.Location,
+		user.Latitude, user.Longitude, int64(user.Age), user.Gender, user.InstagramUsername, user.FacebookUsername, user.SnapchatUsername,
+		int64(user.AgeMin), int64(user.AgeMax), int64(user.DistancePreference), nil, "", time.Time{}, time.Time{},
+	}
+}
+
+// patchProfile runs PATCH /profile for user 7 against a fake database holding current. Usernames and
+// email addresses starting with "taken" belong to another account. It returns the response and the
+// arguments of every statement that saved the profile.
+func patchProfile(t *testing.T, current models.User, body string) (*httptest.ResponseRecorder, [][]driver.Value) {
+	t.Helper()
+	t.Setenv("SENDGRID_API_KEY", "")
+
+	var saves [][]driver.Value
+	db, _ := newFakeDB(t, func(query string, args []driver.Value) ([][]driver.Value, error) {
+		switch {
+		case strings.Contains(query, "COALESCE(age_min, 0)"):
+			return [][]driver.Value{profileRow(current)}, nil
+		case strings.Contains(query, "SELECT id FROM users WHERE username"):
+			if strings.HasPrefix(args[0].(string), "taken") {
+				return [][]driver.Value{{int64(9)}}, nil
+			}
+		case strings.Contains(query, "SELECT EXISTS"):
+			return [][]driver.Value{{strings.HasPrefix(args[0].(string), "taken")}}, nil
+		case strings.Contains(query, "UPDATE users SET"):
+			saves = append(saves, args)
+		}
+		return nil, nil
+	})
+	handler := PatchUserProfile(repositories.NewUserRepository(db, testLogger()), repositories.NewUserTokenRepository(db, testLogger()), newTestGeocoder(t), nil)
+
+	req := httptest.NewRequest(http.MethodPatch, "/profile", strings.NewReader(body))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: current.ID}))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec, saves
+}
+
+func testProfile() models.User {
+	firstName := "Ada"
+	return models.User{
+		ID: 7, Username: "ada", Email: "ada@example.com", FirstName: &firstName, LastName: "Lovelace", Bio: "Mathematician",
+		Location: "Leeds", Latitude: leedsLat, Longitude: leedsLon, Age: 30, Gender: "female", InstagramUsername: "ada",
+		AgeMin: 25, AgeMax: 35, DistancePreference: 50,
+	}
+}
+
+func TestPatchUserProfile(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  func(user *models.User)
+	}{
+		{
+			name:  "omitted fields are unchanged",
+			patch: `{"bio": "Analyst"}`,
+			want:  func(user *models.User) { user.Bio = "Analyst" },
+		},
+		{
+			name:  "null clears a field",
+			patch: `{"firstName": null, "bio": null, "instagramUsername": null}`,
+			want: func(user *models.User) {
+				user.FirstName, user.Bio, user.InstagramUsername = nil, "", ""
+			},
+		},
+		{
+			name:  "a new location moves the coordinates",
+			patch: `{"location": "Manchester"}`,
+			want: func(user *models.User) {
+				user.Location, user.Latitude, user.Longitude = "Manchester", manchesterLat, manchesterLon
+			},
+		},
+		{
+			name:  "preferences are saved with the profile",
+			patch: `{"ageMin": 20, "distancePreference": 100, "lastName": "King"}`,
+			want: func(user *models.User) {
+				user.AgeMin, user.DistancePreference, user.LastName = 20, 100, "King"
+			},
+		},
+		{
+			name:  "an empty patch changes nothing",
+			patch: `{}`,
+			want:  func(user *models.User) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, saves := patchProfile(t, testProfile(), tt.patch)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("PatchUserProfile() = %d %s, want 200", rec.Code, rec.Body.String())
+			}
+
+			want := testProfile()
+			tt.want(&want)
+			var got models.User
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("PatchUserProfile() = %+v, want %+v", got, want)
+			}
+
+			// The profile and preferences are saved together in one statement
+			if len(saves) != 1 {
+				t.Fatalf("PatchUserProfile saved the profile in %d statements, want 1", len(saves))
+			}
+			if prefs := saves[0][16:]; !reflect.DeepEqual(prefs, []driver.Value{int64(want.AgeMin), int64(want.AgeMax), int64(want.DistancePreference)}) {
+				t.Errorf("PatchUserProfile saved preferences %v, want %d, %d, %d", prefs, want.AgeMin, want.AgeMax, want.DistancePreference)
+			}
+		})
+	}
+}
+
+func TestPatchUserProfileRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		status int
+		code   string
+		fields map[string]string
+	}{
+		{
+			name:   "not a JSON object",
+			patch:  `["bio"]`,
+			status: http.StatusBadRequest,
+			code:   "invalid_patch",
+		},
+		{
+			name:   "unknown and read-only fields",
+			patch:  `{"nickname": "ada", "password": "secret", "id": 1, "bio": "Analyst"}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: map[string]string{"nickname": "cannot be changed", "password": "cannot be changed", "id": "cannot be changed"},
+		},
+		{
+			name:   "values of the wrong type",
+			patch:  `{"age": "thirty", "bio": 5, "firstName": "Augusta"}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: map[string]string{"age": "has the wrong type", "bio": "has the wrong type"},
+		},
+		{
+			name:   "every invalid field is reported",
+			patch:  `{"age": 12, "gender": "robot", "ageMin": 40, "instagramUsername": "not valid!"}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: map[string]string{
+				"age":               "must be between 18 and 120",
+				"gender":            "must be one of " + strings.Join(models.Genders, ", "),
+				"ageMax":            "must not be less than ageMin",
+				"instagramUsername": "must be at most 30 letters, numbers, dots or underscores",
+			},
+		},
+		{
+			name:   "clearing a required field",
+			patch:  `{"username": null, "email": null}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: map[string]string{"username": "must be 3 to 30 letters, numbers, dots, dashes or underscores", "email": "must be a valid email address"},
+		},
+		{
+			name:   "username and email address of another account",
+			patch:  `{"username": "taken", "email": "taken@example.com"}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: map[string]string{"username": "is already taken", "email": "is already used by another account"},
+		},
+		{
+			name:   "a location that can't be found",
+			patch:  `{"location": "Atlantis"}`,
+			status: http.StatusUnprocessableEntity,
+			code:   "validation_failed",
+			fields: map[string]string{"location": "could not be resolved"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, saves := patchProfile(t, testProfile(), tt.patch)
+
+			var apiError struct {
+				Error   string            `json:"error"`
+				Details map[string]string `json:"details"`
+			}
+			json.NewDecoder(rec.Body).Decode(&apiError)
+			if rec.Code != tt.status || apiError.Error != tt.code {
+				t.Errorf("PatchUserProfile() = %d %q, want %d %q", rec.Code, apiError.Error, tt.status, tt.code)
+			}
+			if !reflect.DeepEqual(apiError.Details, tt.fields) {
+				t.Errorf("PatchUserProfile() reported %v, want %v", sortedFields(apiError.Details), sortedFields(tt.fields))
+			}
+			if len(saves) != 0 {
+				t.Error("PatchUserProfile saved a rejected patch")
+			}
+		})
+	}
+}
+
+// sortedFields lists field errors in a stable order for test failures
+func sortedFields(fields map[string]string) []string {
+	list := []string{}
+	for field, message := range fields {
+		list = append(list, field+": "+message)
+	}
+	sort.Strings(list)
+	return list
+}
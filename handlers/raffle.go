@@ -2,50 +2,611 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"event-connect/draw"
 	"event-connect/models"
 	"event-connect/repositories"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
-func EnterRaffle(raffleRepo *repositories.RaffleRepository, getUserIDFromToken func(*http.Request) (int, error)) http.HandlerFunc {
+// raffleDrawCheckInterval is how often the draw job looks for raffles whose entries have closed
+const raffleDrawCheckInterval = 15 * time.Minute
+
+func EnterRaffle(raffleRepo *repositories.RaffleRepository, userRepo *repositories.UserRepository, activityRepo *repositories.ActivityRepository,
+	friendRepo *repositories.FriendRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		// The body is optional, as it only names a friend to be in a team with
 		var requestBody struct {
-			EventID   string  `json:"eventId"`
-			Age       int     `json:"age"`
-			Gender    string  `json:"gender"`
-			Latitude  float64 `json:"latitude"`
-			Longitude float64 `json:"longitude"`
+			// TeamWithUserID names a friend to be placed in the same team as
+			TeamWithUserID *uint `json:"teamWithUserId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && err != io.EOF {
+			log.Printf("Error decoding request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		raffleEntry, ok := raffleEntryFromProfile(w, raffleRepo, userRepo, activityRepo, uint(eventID), userID)
+		if !ok {
+			return
+		}
+		if !checkTeamWithFriend(w, friendRepo, userID, requestBody.TeamWithUserID) {
+			return
+		}
+		raffleEntry.TeamWithUserID = requestBody.TeamWithUserID
+
+		if err := raffleRepo.EnterRaffle(raffleEntry); err != nil {
+			log.Printf("Error entering raffle: %v", err)
+			switch {
+			case errors.Is(err, repositories.ErrRaffleClosed), errors.Is(err, repositories.ErrDuplicateRaffleEntry):
+				http.Error(w, err.Error(), http.StatusConflict)
+			case errors.Is(err, repositories.ErrEmailDomainTaken):
+				writeJSONError(w, http.StatusForbidden, "not_eligible", "Someone with the same email domain has already entered this raffle", nil)
+			default:
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// raffleEntryFromProfile snapshots the entry fields from the user's profile after checking the
+// profile is complete, the user meets the event's minimum age and passes the raffle's eligibility
+// rules. It writes the error response and returns false when the user cannot enter.
+func raffleEntryFromProfile(w http.ResponseWriter, raffleRepo *repositories.RaffleRepository, userRepo *repositories.UserRepository,
+	activityRepo *repositories.ActivityRepository, eventID, userID uint) (*models.RaffleEntry, bool) {
+	user, err := userRepo.GetUserProfile(userID)
+	if err != nil {
+		log.Printf("Error fetching profile for raffle entry: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if models.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		writeJSONError(w, http.StatusForbidden, "email_unverified",
+			"Verify your email address before entering the raffle", nil)
+		return nil, false
+	}
+
+	if missing := missingRaffleProfileFields(user); len(missing) > 0 {
+		writeJSONError(w, http.StatusUnprocessableEntity, "profile_incomplete",
+			"Complete your profile before entering the raffle", map[string][]string{"missingFields": missing})
+		return nil, false
+	}
+
+	eventDetails, err := fetchEventDetails(eventID)
+	if err != nil {
+		log.Printf("Error fetching event details for raffle entry: %v", err)
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if minAge := eventMinAge(eventDetails); user.Age < minAge {
+		writeJSONError(w, http.StatusForbidden, "age_restricted",
+			"You do not meet the minimum age for this event", map[string]int{"minAge": minAge})
+		return nil, false
+	}
+
+	failure, err := checkRaffleEligibility(raffleRepo, activityRepo, user, eventID, eventDetails)
+	if err != nil {
+		log.Printf("Error checking raffle eligibility: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if failure != nil {
+		writeJSONError(w, http.StatusForbidden, "not_eligible", failure.Reason, failure)
+		return nil, false
+	}
+
+	return &models.RaffleEntry{
+		EventID:   eventID,
+		UserID:    userID,
+		Age:       user.Age,
+		Gender:    user.Gender,
+		Latitude:  user.Latitude,
+		Longitude: user.Longitude,
+	}, true
+}
+
+// checkTeamWithFriend checks that the user an entrant asked to be in a team with is their friend.
+// It writes the error response and returns false when they aren't.
+func checkTeamWithFriend(w http.ResponseWriter, friendRepo *repositories.FriendRepository, userID uint, teamWithUserID *uint) bool {
+	if teamWithUserID == nil {
+		return true
+	}
+
+	friends := false
+	if *teamWithUserID != userID {
+		var err error
+		friends, err = friendRepo.AreFriends(userID, *teamWithUserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return false
+		}
+	}
+	if !friends {
+		writeJSONError(w, http.StatusUnprocessableEntity, "not_friends",
+			"You can only ask to be in the same team as one of your friends", map[string]uint{"teamWithUserId": *teamWithUserID})
+		return false
+	}
+	return true
+}
+
+// missingRaffleProfileFields lists the profile fields a user must fill in before entering a raffle
+func missingRaffleProfileFields(user *models.User) []string {
+	var missing []string
+	if user.Age <= 0 {
+		missing = append(missing, "age")
+	}
+	if strings.TrimSpace(user.Gender) == "" {
+		missing = append(missing, "gender")
+	}
+	if user.Latitude == 0 && user.Longitude == 0 {
+		missing = append(missing, "location")
+	}
+	return missing
+}
+
+// eventMinAge reads the minimum age from Skiddle event details, which report it as
+// either a number or a string under "MinAge" or "minage"
+func eventMinAge(eventDetails map[string]interface{}) int {
+	for _, key := range []string{"MinAge", "minage"} {
+		switch value := eventDetails[key].(type) {
+		case float64:
+			return int(value)
+		case string:
+			if minAge, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				return minAge
+			}
+		}
+	}
+	return 0
+}
+
+func AmendRaffleEntry(raffleRepo *repositories.RaffleRepository, userRepo *repositories.UserRepository, activityRepo *repositories.ActivityRepository,
+	friendRepo *repositories.FriendRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		// The friend to be in a team with is only changed when the body names one, or null to clear it
+		var requestBody map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Amending refreshes the entry from the user's current profile
+		entry, ok := raffleEntryFromProfile(w, raffleRepo, userRepo, activityRepo, uint(eventID), userID)
+		if !ok {
+			return
+		}
+
+		if teamWith, ok := requestBody["teamWithUserId"]; ok {
+			if err := json.Unmarshal(teamWith, &entry.TeamWithUserID); err != nil {
+				http.Error(w, "Invalid teamWithUserId", http.StatusBadRequest)
+				return
+			}
+			if !checkTeamWithFriend(w, friendRepo, userID, entry.TeamWithUserID) {
+				return
+			}
+		} else {
+			current, err := raffleRepo.GetEntry(uint(eventID), userID)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if current != nil {
+				entry.TeamWithUserID = current.TeamWithUserID
+			}
+		}
+
+		if err := raffleRepo.AmendEntry(entry); err != nil {
+			writeRaffleEntryChangeError(w, err)
+			return
+		}
+
+		updated, err := raffleRepo.GetEntry(uint(eventID), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+	}
+}
+
+func WithdrawRaffleEntry(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := raffleRepo.WithdrawEntry(uint(eventID), userID); err != nil {
+			writeRaffleEntryChangeError(w, err)
+			return
 		}
 
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeRaffleEntryChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrRaffleEntryNotFound):
+		http.Error(w, "Raffle entry not found", http.StatusNotFound)
+	case errors.Is(err, repositories.ErrRaffleEntryLocked):
+		http.Error(w, "Raffle entries can no longer be changed once the draw has happened or teams are formed", http.StatusConflict)
+	default:
+		log.Printf("Error changing raffle entry: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// *************************** Raffle Draw ***************************
+
+var (
+	// errRaffleNotConfigured is returned when drawing an event that has no raffle
+	errRaffleNotConfigured = errors.New("raffle not configured")
+	// errRaffleStillOpen is returned when drawing a raffle before its entries close
+	errRaffleStillOpen = errors.New("raffle entries are still open")
+	// errRaffleSeedNotCommitted is returned when drawing a raffle without a published seed hash
+	errRaffleSeedNotCommitted = errors.New("raffle seed not committed")
+)
+
+// DrawRaffle selects the winners of an event's raffle once its entries have closed using the
+// committed seed, ranks everyone else on the waitlist and notifies all entrants of the result
+func DrawRaffle(raffleRepo *repositories.RaffleRepository, notifier *Notifier, eventID uint) error {
+	raffle, err := raffleRepo.GetRaffle(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch raffle: %w", err)
+	}
+	if raffle == nil {
+		return errRaffleNotConfigured
+	}
+	if raffle.DrawnAt != nil {
+		return repositories.ErrRaffleAlreadyDrawn
+	}
+	if time.Now().Before(raffle.ClosesAt) {
+		return errRaffleStillOpen
+	}
+
+	// A seed chosen at draw time could be picked to favour someone, so raffles configured before
+	// seeds were committed wait until saving their settings again commits one
+	if raffle.Seed == "" || raffle.SeedHash == "" {
+		return errRaffleSeedNotCommitted
+	}
+
+	entries, err := raffleRepo.FetchEntries(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch raffle entries: %w", err)
+	}
+
+	userIDs := make([]uint, len(entries))
+	for i, entry := range entries {
+		userIDs[i] = entry.UserID
+	}
+	winners, waitlist := draw.Select(raffle.Seed, userIDs, raffle.Places)
+
+	record := &models.RaffleDraw{
+		EventID:   eventID,
+		Algorithm: draw.Algorithm,
+		Seed:      raffle.Seed,
+		SeedHash:  raffle.SeedHash,
+		Places:    raffle.Places,
+		Entries:   draw.SortEntrants(userIDs),
+		Winners:   winners,
+		Waitlist:  waitlist,
+		DrawnAt:   time.Now(),
+	}
+	if err := raffleRepo.RecordDraw(record); err != nil {
+		return err
+	}
+	log.Printf("Drew raffle for event ID %d: %d winners, %d waitlisted", eventID, len(winners), len(waitlist))
+
+	notifyRaffleResults(notifier, eventID, winners, waitlist)
+	return nil
+}
+
+func notifyRaffleResults(notifier *Notifier, eventID uint, winners, waitlist []uint) {
+	link := "/event-details.html?eventId=" + strconv.Itoa(int(eventID))
+	subject := "Raffle results for Event ID: " + strconv.Itoa(int(eventID))
+
+	for _, userID := range winners {
+		body := "Congratulations! You have won a place in the raffle for this event.\n\nIf you can no longer attend, please decline your place so it can go to someone on the waitlist.\n\nBest regards,\nThe Event Team"
+		if err := notifier.Notify(userID, models.NotificationRaffleResult, subject, body, link); err != nil {
+			log.Printf("Error notifying raffle winner %d for event ID %d: %v", userID, eventID, err)
+		}
+	}
+
+	for i, userID := range waitlist {
+		body := "Unfortunately you did not win a place in the raffle for this event this time.\n\nYou are number " + strconv.Itoa(i+1) + " on the waitlist and will be notified if a place becomes available.\n\nBest regards,\nThe Event Team"
+		if err := notifier.Notify(userID, models.NotificationRaffleResult, subject, body, link); err != nil {
+			log.Printf("Error notifying waitlisted entrant %d for event ID %d: %v", userID, eventID, err)
+		}
+	}
+}
+
+func ScheduleRaffleDraws(raffleRepo *repositories.RaffleRepository, notifier *Notifier) {
+	ticker := time.NewTicker(raffleDrawCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		raffles, err := raffleRepo.FetchRafflesDueForDraw(time.Now())
+		if err != nil {
+			log.Printf("Error fetching raffles due for draw: %v", err)
+			continue
+		}
+
+		for _, raffle := range raffles {
+			if err := DrawRaffle(raffleRepo, notifier, raffle.EventID); err != nil {
+				log.Printf("Error drawing raffle for event ID %d: %v", raffle.EventID, err)
+			}
+		}
+	}
+}
+
+// *************************** Handler Functions ***************************
+
+func GetRaffle(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		raffle, err := raffleRepo.GetRaffle(uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if raffle == nil {
+			http.Error(w, "Raffle not found", http.StatusNotFound)
+			return
+		}
+
+		entryCount, err := raffleRepo.CountEntries(uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := struct {
+			*models.Raffle
+			Open       bool `json:"open"`
+			EntryCount int  `json:"entryCount"`
+		}{
+			Raffle:     raffle,
+			Open:       raffle.IsOpen(time.Now()),
+			EntryCount: entryCount,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func UpdateRaffleSettings(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		var requestBody struct {
+			Places   int       `json:"places"`
+			ClosesAt time.Time `json:"closesAt"`
+		}
 		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			log.Printf("Error decoding request body: %v", err)
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		if requestBody.Places < 1 {
+			http.Error(w, "places must be at least 1", http.StatusBadRequest)
+			return
+		}
+		if requestBody.ClosesAt.IsZero() {
+			http.Error(w, "closesAt is required", http.StatusBadRequest)
+			return
+		}
 
-		eventID, err := strconv.ParseUint(requestBody.EventID, 10, 64)
+		raffle := &models.Raffle{
+			EventID:  uint(eventID),
+			Places:   requestBody.Places,
+			ClosesAt: requestBody.ClosesAt,
+		}
+		if err := raffleRepo.SaveRaffle(raffle); err != nil {
+			if errors.Is(err, repositories.ErrRaffleAlreadyDrawn) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		saved, err := raffleRepo.GetRaffle(uint(eventID))
 		if err != nil {
-			log.Printf("Error parsing eventId: %v", err)
-			http.Error(w, "Invalid eventId", http.StatusBadRequest)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		raffleEntry := &models.RaffleEntry{
-			EventID:   uint(eventID),
-			Age:       requestBody.Age,
-			Gender:    requestBody.Gender,
-			Latitude:  requestBody.Latitude,
-			Longitude: requestBody.Longitude,
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(saved)
+	}
+}
+
+func TriggerRaffleDraw(raffleRepo *repositories.RaffleRepository, notifier *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
 		}
 
-		if err := raffleRepo.EnterRaffle(raffleEntry, getUserIDFromToken, r); err != nil {
-			log.Printf("Error entering raffle: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = DrawRaffle(raffleRepo, notifier, uint(eventID))
+		if err != nil {
+			switch {
+			case errors.Is(err, errRaffleNotConfigured):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, repositories.ErrRaffleAlreadyDrawn), errors.Is(err, errRaffleStillOpen),
+				errors.Is(err, errRaffleSeedNotCommitted):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				log.Printf("Error drawing raffle for event ID %d: %v", eventID, err)
+				http.Error(w, "Failed to draw raffle", http.StatusInternalServerError)
+			}
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		// Respond with the draw record rather than the entries, which hold the entrants' personal details
+		record, err := raffleRepo.GetDraw(uint(eventID))
+		if err != nil || record == nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+	}
+}
+
+func GetRaffleDraw(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		record, err := raffleRepo.GetDraw(uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if record == nil {
+			http.Error(w, "Raffle has not been drawn", http.StatusNotFound)
+			return
+		}
+
+		response := struct {
+			*models.RaffleDraw
+			Verified     bool   `json:"verified"`
+			Verification string `json:"verification"`
+		}{
+			RaffleDraw:   record,
+			Verified:     draw.Verify(record.Seed, record.SeedHash, record.Entries, record.Places, record.Winners, record.Waitlist),
+			Verification: draw.Description,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func GetRaffleEntry(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := raffleRepo.GetEntry(uint(eventID), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if entry == nil {
+			http.Error(w, "Raffle entry not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+func DeclineRafflePlace(raffleRepo *repositories.RaffleRepository, notifier *Notifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		promoted, err := raffleRepo.DeclinePlace(uint(eventID), userID)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNoPlaceToDecline) {
+				http.Error(w, "You do not hold a place in this raffle", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if promoted != nil {
+			notifyPromotedEntrant(notifier, *promoted, uint(eventID))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// notifyPromotedEntrant tells a waitlisted entrant they have been given a place someone else gave up
+func notifyPromotedEntrant(notifier *Notifier, userID, eventID uint) {
+	link := "/event-details.html?eventId=" + strconv.Itoa(int(eventID))
+	subject := "Raffle results for Event ID: " + strconv.Itoa(int(eventID))
+	body := "Good news! A place has become available and you have been promoted from the waitlist.\n\nBest regards,\nThe Event Team"
+	if err := notifier.Notify(userID, models.NotificationRaffleResult, subject, body, link); err != nil {
+		log.Printf("Error notifying promoted entrant %d for event ID %d: %v", userID, eventID, err)
 	}
 }
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"event-connect/eligibility"
+	"event-connect/models"
+	"event-connect/repositories"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// checkRaffleEligibility evaluates the event's raffle rules against a user
+func checkRaffleEligibility(raffleRepo *repositories.RaffleRepository, activityRepo *repositories.ActivityRepository,
+	user *models.User, eventID uint, eventDetails map[string]interface{}) (*eligibility.Failure, error) {
+	rules, err := raffleRepo.GetRules(eventID)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	registered, err := activityRepo.IsRegistered(user.ID, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := eligibilityEvent(raffleRepo, eventID, eventDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := eligibility.Candidate{
+		UserID:             user.ID,
+		Age:                user.Age,
+		Latitude:           user.Latitude,
+		Longitude:          user.Longitude,
+		Email:              user.Email,
+		RegisteredForEvent: registered,
+	}
+	return eligibility.Evaluate(rules, candidate, event), nil
+}
+
+// eligibilityEvent gathers the event data rules are evaluated against
+func eligibilityEvent(raffleRepo *repositories.RaffleRepository, eventID uint, eventDetails map[string]interface{}) (eligibility.Event, error) {
+	event := eligibility.Event{}
+	if venue, ok := eventDetails["venue"].(map[string]interface{}); ok {
+		latitude, latOK := venue["latitude"].(float64)
+		longitude, lonOK := venue["longitude"].(float64)
+		if latOK && lonOK {
+			event.VenueLatitude, event.VenueLongitude, event.HasVenue = latitude, longitude, true
+		}
+	}
+
+	domains, err := raffleRepo.EntryEmailDomains(eventID)
+	if err != nil {
+		return event, err
+	}
+	event.TakenEmailDomains = domains
+	return event, nil
+}
+
+// *************************** Handler Functions ***************************
+
+func GetRaffleRules(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		rules, err := raffleRepo.GetRules(uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+func UpdateRaffleRules(raffleRepo *repositories.RaffleRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		var rules []eligibility.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := eligibility.Validate(rules); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_rules", err.Error(), nil)
+			return
+		}
+
+		if err := raffleRepo.SaveRules(uint(eventID), rules); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+	}
+}
+
+// PreviewRaffleRules reports how many of the users registered for the event would qualify under the
+// posted rule set, or under the event's stored rules when the request body is empty
+func PreviewRaffleRules(raffleRepo *repositories.RaffleRepository, userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+
+		var rules []eligibility.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err == io.EOF {
+			rules, err = raffleRepo.GetRules(uint(eventID))
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		} else if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := eligibility.Validate(rules); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_rules", err.Error(), nil)
+			return
+		}
+
+		eventDetails, err := fetchEventDetails(uint(eventID))
+		if err != nil {
+			log.Printf("Error fetching event details for rule preview: %v", err)
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		}
+
+		event, err := eligibilityEvent(raffleRepo, uint(eventID), eventDetails)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		users, err := userRepo.GetUsersRegisteredForEvent(uint(eventID))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		qualifying := 0
+		failuresByRule := make([]int, len(rules))
+		for _, user := range users {
+			candidate := eligibility.Candidate{
+				UserID:             user.ID,
+				Age:                user.Age,
+				Latitude:           user.Latitude,
+				Longitude:          user.Longitude,
+				Email:              user.Email,
+				RegisteredForEvent: true,
+			}
+			if failure := eligibility.Evaluate(rules, candidate, event); failure != nil {
+				failuresByRule[failure.Index]++
+				continue
+			}
+			qualifying++
+		}
+
+		response := struct {
+			Rules           []eligibility.Rule `json:"rules"`
+			RegisteredUsers int                `json:"registeredUsers"`
+			Qualifying      int                `json:"qualifying"`
+			FailuresByRule  []int              `json:"failuresByRule"`
+		}{
+			Rules:           rules,
+			RegisteredUsers: len(users),
+			Qualifying:      qualifying,
+			FailuresByRule:  failuresByRule,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"event-connect/models"
+	"event-connect/recommend"
+	"event-connect/repositories"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GetUserRecommendations returns other users the current user might want to meet, best match first,
+// with the reasons for each match. The user's age and distance preferences apply unless they are
+// overridden with the minAge, maxAge and maxDistanceKm parameters, and results can be narrowed with
+// gender, interest and eventId. Results are paged with limit and offset.
+func GetUserRecommendations(userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := userRepo.GetUserProfile(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		filters := recommend.Filters{
+			MinAge:        user.AgeMin,
+			MaxAge:        user.AgeMax,
+			MaxDistanceKm: float64(user.DistancePreference),
+			Gender:        strings.ToLower(strings.TrimSpace(query.Get("gender"))),
+			Interest:      query.Get("interest"),
+		}
+
+		parameterErrors := map[string]string{}
+		intParameter := func(name string, min, max int, value *int) {
+			if v := query.Get(name); v != "" {
+				parsed, err := strconv.Atoi(v)
+				if err != nil || parsed < min || parsed > max {
+					parameterErrors[name] = "must be a whole number between " + strconv.Itoa(min) + " and " + strconv.Itoa(max)
+					return
+				}
+				*value = parsed
+			}
+		}
+
+		intParameter("minAge", models.MinUserAge, models.MaxUserAge, &filters.MinAge)
+		intParameter("maxAge", models.MinUserAge, models.MaxUserAge, &filters.MaxAge)
+		maxDistanceKm := int(filters.MaxDistanceKm)
+		intParameter("maxDistanceKm", 1, models.MaxDistancePreference, &maxDistanceKm)
+		filters.MaxDistanceKm = float64(maxDistanceKm)
+		eventID := 0
+		intParameter("eventId", 1, math.MaxInt32, &eventID)
+		filters.EventID = uint(eventID)
+		limit := 20
+		intParameter("limit", 1, 100, &limit)
+		offset := 0
+		intParameter("offset", 0, math.MaxInt32, &offset)
+
+		if filters.Gender != "" && !models.IsGender(filters.Gender) {
+			parameterErrors["gender"] = "must be one of " + strings.Join(models.Genders, ", ")
+		}
+		if filters.MinAge != 0 && filters.MaxAge != 0 && filters.MinAge > filters.MaxAge {
+			parameterErrors["maxAge"] = "must not be less than minAge"
+		}
+		if len(parameterErrors) > 0 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_parameters", "Some parameters are invalid", parameterErrors)
+			return
+		}
+
+		candidates, err := userRepo.GetRecommendedUsers(userID, filters)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		recommendations := recommend.Users(user, candidates, filters)
+		total := len(recommendations)
+		if offset > total {
+			offset = total
+		}
+		if offset+limit < total {
+			recommendations = recommendations[offset : offset+limit]
+		} else {
+			recommendations = recommendations[offset:]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"recommendations": recommendations,
+			"total":           total,
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"encoding/json"
+	"event-connect/models"
+	"event-connect/repositories"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reminderCheckInterval is how often the reminder job looks for upcoming events
+const reminderCheckInterval = 15 * time.Minute
+
+// DefaultReminderWindows are used when EVENT_REMINDER_WINDOWS is not set
+var DefaultReminderWindows = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 2 * time.Hour}
+
+// ParseReminderWindows parses a comma-separated list of durations such as "168h,24h,2h"
+func ParseReminderWindows(value string) ([]time.Duration, error) {
+	if strings.TrimSpace(value) == "" {
+		return DefaultReminderWindows, nil
+	}
+
+	var windows []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		window, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder window %q: %w", part, err)
+		}
+		if window <= 0 {
+			return nil, fmt.Errorf("reminder window %q must be positive", part)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// *************************** Scheduled Jobs ***************************
+
+func ScheduleEventReminders(reminderRepo *repositories.ReminderRepository, teamRepo *repositories.TeamRepository, notifier *Notifier, windows []time.Duration) {
+	ticker := time.NewTicker(reminderCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sendEventReminders(reminderRepo, teamRepo, notifier, windows)
+	}
+}
+
+// eventStartTimeTTL is how long a stored event start time is trusted before Skiddle is asked again,
+// so that rescheduled events are noticed
+const eventStartTimeTTL = 6 * time.Hour
+
+// reminderEvent is what a reminder run knows about an event. details is only fetched once a reminder is due.
+type reminderEvent struct {
+	startTime time.Time
+	details   map[string]interface{}
+}
+
+func sendEventReminders(reminderRepo *repositories.ReminderRepository, teamRepo *repositories.TeamRepository, notifier *Notifier, windows []time.Duration) {
+	// Check the smallest window first so that a late registration only receives the most relevant reminder
+	sorted := append([]time.Duration(nil), windows...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	now := time.Now()
+	registrations, err := reminderRepo.FetchRegistrations(now.UTC(), formatReminderWindow(sorted[0]))
+	if err != nil {
+		log.Printf("Error fetching registrations for reminders: %v", err)
+		return
+	}
+
+	// Each event is looked up at most once per run; nil marks an event that couldn't be looked up
+	events := make(map[uint]*reminderEvent)
+	for _, registration := range registrations {
+		event, cached := events[registration.EventID]
+		if !cached {
+			event, err = loadReminderEvent(reminderRepo, registration.EventID, now)
+			if err != nil {
+				log.Printf("Error determining start time for event ID %d: %v", registration.EventID, err)
+			}
+			events[registration.EventID] = event
+		}
+		if event == nil {
+			continue
+		}
+
+		window, due := dueReminderWindow(sorted, event.startTime.Sub(now))
+		if !due {
+			continue
+		}
+		if event.details == nil {
+			// Check the start time against the latest details before sending anything
+			if err := refreshReminderEvent(reminderRepo, registration.EventID, event, now); err != nil {
+				log.Printf("Error fetching event details for event ID %d: %v", registration.EventID, err)
+				events[registration.EventID] = nil
+				continue
+			}
+			if window, due = dueReminderWindow(sorted, event.startTime.Sub(now)); !due {
+				continue
+			}
+		}
+
+		label := formatReminderWindow(window)
+		claimed, err := reminderRepo.ClaimReminder(registration.UserID, registration.EventID, label)
+		if err != nil {
+			log.Printf("Error claiming %s reminder for event ID %d for user %d: %v", label, registration.EventID, registration.UserID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = sendEventReminder(teamRepo, notifier, registration, event.details, event.startTime, label)
+		if err != nil {
+			log.Printf("Error sending %s reminder for event ID %d to user %d: %v", label, registration.EventID, registration.UserID, err)
+			reminderRepo.ReleaseReminder(registration.UserID, registration.EventID, label)
+		}
+	}
+}
+
+// dueReminderWindow returns the smallest of the sorted windows that an event starting after
+// untilStart falls within, and false when the event has started or no window has been reached
+func dueReminderWindow(sorted []time.Duration, untilStart time.Duration) (time.Duration, bool) {
+	if untilStart <= 0 {
+		return 0, false
+	}
+	for _, window := range sorted {
+		if untilStart <= window {
+			return window, true
+		}
+	}
+	return 0, false
+}
+
+// loadReminderEvent returns the start time of an event, using the one stored by an earlier run
+// while it is fresh and otherwise fetching the event's details from Skiddle
+func loadReminderEvent(reminderRepo *repositories.ReminderRepository, eventID uint, now time.Time) (*reminderEvent, error) {
+	startsAt, refreshedAt, found, err := reminderRepo.GetEventStartTime(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if found && now.Sub(refreshedAt) < eventStartTimeTTL {
+		return &reminderEvent{startTime: startsAt}, nil
+	}
+
+	event := &reminderEvent{}
+	if err := refreshReminderEvent(reminderRepo, eventID, event, now); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// refreshReminderEvent fetches an event's details from Skiddle and stores its start time for later runs
+func refreshReminderEvent(reminderRepo *repositories.ReminderRepository, eventID uint, event *reminderEvent, now time.Time) error {
+	details, err := fetchEventDetails(eventID)
+	if err != nil {
+		return err
+	}
+	startTime, err := eventStartTime(details)
+	if err != nil {
+		return err
+	}
+
+	event.details = details
+	event.startTime = startTime
+	if err := reminderRepo.SaveEventStartTime(eventID, startTime.UTC(), now.UTC()); err != nil {
+		log.Printf("Error saving start time for event ID %d: %v", eventID, err)
+	}
+	return nil
+}
+
+func sendEventReminder(teamRepo *repositories.TeamRepository, notifier *Notifier, registration models.Activity, eventDetails map[string]interface{}, startTime time.Time, label string) error {
+	eventName, _ := eventDetails["eventname"].(string)
+	if eventName == "" {
+		eventName = "Event ID " + strconv.Itoa(int(registration.EventID))
+	}
+
+	subject := "Reminder: " + eventName + " starts in " + label
+	body := "Hi,\n\nThis is a reminder that " + eventName + " starts in " + label + ".\n\n"
+	body += "When: " + startTime.Format("Monday 2 January 2006, 15:04") + "\n"
+	if venue := formatVenue(eventDetails); venue != "" {
+		body += "Where: " + venue + "\n"
+	}
+
+	teams, err := teamRepo.FetchUserTeams(registration.UserID)
+	if err != nil {
+		return err
+	}
+	for _, team := range teams {
+		if team.EventID != registration.EventID {
+			continue
+		}
+		body += "\nYour team:\n"
+		for _, member := range team.Members {
+			body += "- " + member.Username + "\n"
+		}
+	}
+	body += "\nBest regards,\nThe Event Team"
+
+	link := "/event-details.html?eventId=" + strconv.Itoa(int(registration.EventID))
+	return notifier.Notify(registration.UserID, models.NotificationEventReminder, subject, body, link)
+}
+
+// eventStartTime determines when an event starts from its Skiddle details
+func eventStartTime(eventDetails map[string]interface{}) (time.Time, error) {
+	if startDate, ok := eventDetails["startdate"].(string); ok && startDate != "" {
+		if start, err := time.Parse(time.RFC3339, startDate); err == nil {
+			return start, nil
+		}
+	}
+
+	dateStr, ok := eventDetails["date"].(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("event date not found")
+	}
+
+	doorsOpen := "00:00"
+	if openingTimes, ok := eventDetails["openingtimes"].(map[string]interface{}); ok {
+		if doors, ok := openingTimes["doorsopen"].(string); ok && doors != "" {
+			doorsOpen = doors
+		}
+	}
+
+	return time.ParseInLocation("2006-01-02 15:04", dateStr+" "+doorsOpen, time.Local)
+}
+
+// formatVenue renders the venue name and address of an event
+func formatVenue(eventDetails map[string]interface{}) string {
+	venue, ok := eventDetails["venue"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	var parts []string
+	for _, key := range []string{"name", "address", "town", "postcode"} {
+		if value, ok := venue[key].(string); ok && value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatReminderWindow renders a reminder window as a human readable label such as "1 week" or "2 hours"
+func formatReminderWindow(window time.Duration) string {
+	units := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+
+	for _, unit := range units {
+		if window >= unit.duration && window%unit.duration == 0 {
+			count := int(window / unit.duration)
+			if count == 1 {
+				return "1 " + unit.name
+			}
+			return strconv.Itoa(count) + " " + unit.name + "s"
+		}
+	}
+	return window.String()
+}
+
+// *************************** Handler Functions ***************************
+
+func GetReminderSettings(reminderRepo *repositories.ReminderRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		optOut, err := reminderRepo.GetOptOut(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"optOut": optOut})
+	}
+}
+
+func UpdateReminderSettings(reminderRepo *repositories.ReminderRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			OptOut *bool `json:"optOut"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.OptOut == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := reminderRepo.SetOptOut(userID, *requestBody.OptOut); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"optOut": *requestBody.OptOut})
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"event-connect/skiddle"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxConcurrentSkiddleRequests is the most requests made to Skiddle at once across all handlers
+const maxConcurrentSkiddleRequests = 4
+
+// eventDetailsTTL is how long fetched event details are reused before Skiddle is asked again
+const eventDetailsTTL = 10 * time.Minute
+
+// maxCachedEvents bounds the number of events whose details are kept
+const maxCachedEvents = 1000
+
+var skiddleClient = &http.Client{Timeout: 10 * time.Second}
+
+// skiddleRequests holds a slot for every request to Skiddle in flight
+var skiddleRequests = make(chan struct{}, maxConcurrentSkiddleRequests)
+
+// cachedEventDetails are the details of an event as fetched from Skiddle
+type cachedEventDetails struct {
+	details   map[string]interface{}
+	expiresAt time.Time
+}
+
+var eventDetailsCache = struct {
+	sync.Mutex
+	events map[uint]cachedEventDetails
+}{events: make(map[uint]cachedEventDetails)}
+
+// fetchEventDetails returns the details of an event from Skiddle. Details are cached for a while, so
+// callers must not modify them.
+func fetchEventDetails(eventID uint) (map[string]interface{}, error) {
+	now := time.Now()
+	eventDetailsCache.Lock()
+	cached, ok := eventDetailsCache.events[eventID]
+	eventDetailsCache.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.details, nil
+	}
+
+	var result map[string]interface{}
+	if err := getSkiddleJSON(skiddle.EventDetailsURL(eventID), &result); err != nil {
+		return nil, err
+	}
+	eventDetails, ok := result["results"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid event details response")
+	}
+
+	eventDetailsCache.Lock()
+	if len(eventDetailsCache.events) >= maxCachedEvents {
+		for cachedID, cached := range eventDetailsCache.events {
+			if !now.Before(cached.expiresAt) {
+				delete(eventDetailsCache.events, cachedID)
+			}
+		}
+		if len(eventDetailsCache.events) >= maxCachedEvents {
+			eventDetailsCache.events = make(map[uint]cachedEventDetails)
+		}
+	}
+	eventDetailsCache.events[eventID] = cachedEventDetails{details: eventDetails, expiresAt: now.Add(eventDetailsTTL)}
+	eventDetailsCache.Unlock()
+
+	return eventDetails, nil
+}
+
+// fetchSkiddleEvents fetches the summaries of several events, a few at a time. Events that can't be
+// fetched are logged and left out.
+func fetchSkiddleEvents(eventIDs []uint) map[uint]map[string]interface{} {
+	pending := make(chan uint, len(eventIDs))
+	for _, eventID := range eventIDs {
+		pending <- eventID
+	}
+	close(pending)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	events := make(map[uint]map[string]interface{})
+	for i := 0; i < maxConcurrentSkiddleRequests && i < len(eventIDs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for eventID := range pending {
+				details, err := fetchEventDetails(eventID)
+				if err != nil {
+					log.Printf("Error fetching details of event %d: %v", eventID, err)
+					continue
+				}
+
+				mu.Lock()
+				events[eventID] = skiddleEventSummary(details)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return events
+}
+
+// getSkiddleJSON decodes the response of a Skiddle API request into v, waiting for a free slot first
+func getSkiddleJSON(url string, v interface{}) error {
+	skiddleRequests <- struct{}{}
+	defer func() { <-skiddleRequests }()
+
+	resp, err := skiddleClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("skiddle returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
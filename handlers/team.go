@@ -2,84 +2,68 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"event-connect/geo"
 	"event-connect/models"
-	
 	"event-connect/repositories"
 	"event-connect/emailUtil"
-	"event-connect/skiddle"
+	"event-connect/storage"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
-func haversineDistance(lon1, lat1, lon2, lat2 float64) float64 {
-	const earthRadius = 6371 // Radius of the Earth in kilometers
+// maxTeamSize is the most members a team can have
+const maxTeamSize = 4
 
-	lat1 = degToRad(lat1)
-	lon1 = degToRad(lon1)
-	lat2 = degToRad(lat2)
-	lon2 = degToRad(lon2)
-
-	dlat := lat2 - lat1
-	dlon := lon2 - lon1
-
-	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	distance := earthRadius * c
-	return distance
-}
-
-func degToRad(deg float64) float64 {
-	return deg * math.Pi / 180
-}
-
-func groupEntries(entries []models.User) []models.Team {
+// groupEntries places the entries in teams. Entrants who asked to be in the same team as a friend
+// who is also taking part are kept together; otherwise entries are grouped by gender, then by age
+// and location. Two entrants where one has blocked the other are never placed in the same team.
+func groupEntries(entries []models.User, teamWith map[uint]uint, blocks map[uint]map[uint]bool) []models.Team {
 	var teams []models.Team
 
-	// Group entries by gender
-	entriesByGender := make(map[string][]models.User)
-	for _, entry := range entries {
-		entriesByGender[entry.Gender] = append(entriesByGender[entry.Gender], entry)
+	// Group units of entrants that must share a team by the gender of their first member
+	unitsByGender := make(map[string][][]models.User)
+	for _, unit := range friendUnits(entries, teamWith, blocks) {
+		unitsByGender[unit[0].Gender] = append(unitsByGender[unit[0].Gender], unit)
 	}
 
 	// Create teams for each gender
-	for _, genderEntries := range entriesByGender {
-		// Sort entries by age and location (latitude, longitude)
-		sort.Slice(genderEntries, func(i, j int) bool {
-			if genderEntries[i].Age == genderEntries[j].Age {
-				distanceI := haversineDistance(genderEntries[i].Longitude, genderEntries[i].Latitude, 0, 0)
-				distanceJ := haversineDistance(genderEntries[j].Longitude, genderEntries[j].Latitude, 0, 0)
+	for _, genderUnits := range unitsByGender {
+		// Sort units by the age and location (latitude, longitude) of their first member
+		sort.SliceStable(genderUnits, func(i, j int) bool {
+			a, b := genderUnits[i][0], genderUnits[j][0]
+			if a.Age == b.Age {
+				distanceI := geo.DistanceKm(a.Latitude, a.Longitude, 0, 0)
+				distanceJ := geo.DistanceKm(b.Latitude, b.Longitude, 0, 0)
 				return distanceI < distanceJ
 			}
-			return genderEntries[i].Age < genderEntries[j].Age
+			return a.Age < b.Age
 		})
 
+		// Fill teams in order so that members are close in age and location. A unit that doesn't fit in
+		// the current team, because it is too big or has someone blocked, starts the next one.
 		var currentTeam []models.Member
-		for _, entry := range genderEntries {
-			if len(currentTeam) < 4 {
-				currentTeam = append(currentTeam, models.Member{
-					UserID:    entry.ID,
-					Username:  entry.Username,
-					Age:       entry.Age,
-					Gender:    entry.Gender,
-					Latitude:  entry.Latitude,
-					Longitude: entry.Longitude,
-				})
+		for _, unit := range genderUnits {
+			if len(currentTeam)+len(unit) > maxTeamSize || blocked(blocks, teamMemberIDs(currentTeam), userIDs(unit)) {
+				teams = append(teams, models.Team{Members: currentTeam})
+				currentTeam = nil
 			}
+			currentTeam = append(currentTeam, teamMembers(unit)...)
 
-			if len(currentTeam) == 4 {
+			if len(currentTeam) == maxTeamSize {
 				teams = append(teams, models.Team{Members: currentTeam})
 				currentTeam = nil
 			}
 		}
 
+		// Add the remaining members as a team
 		if len(currentTeam) > 0 {
 			teams = append(teams, models.Team{Members: currentTeam})
 		}
@@ -88,7 +72,96 @@ func groupEntries(entries []models.User) []models.Team {
 	return teams
 }
 
-func CreateTeams(teamRepo *repositories.TeamRepository, eventID uint) error {
+// friendUnits splits the entries into units that must be placed in the same team: an entrant and
+// the friend they asked to be with, when that friend is also taking part. A request that would make
+// a unit bigger than a team, or put someone with a user they blocked, is ignored.
+func friendUnits(entries []models.User, teamWith map[uint]uint, blocks map[uint]map[uint]bool) [][]models.User {
+	unitOf := make(map[uint]int)
+	for i, entry := range entries {
+		unitOf[entry.ID] = i
+	}
+	units := make([][]models.User, len(entries))
+	for i, entry := range entries {
+		units[i] = []models.User{entry}
+	}
+
+	for _, entry := range entries {
+		friendID, ok := teamWith[entry.ID]
+		if !ok {
+			continue
+		}
+		if _, taking := unitOf[friendID]; !taking {
+			continue
+		}
+
+		from, to := unitOf[entry.ID], unitOf[friendID]
+		if from == to || len(units[from])+len(units[to]) > maxTeamSize || blocked(blocks, userIDs(units[from]), userIDs(units[to])) {
+			continue
+		}
+		if to > from {
+			from, to = to, from
+		}
+		// Merge into the unit that came first so the order of the entries is kept
+		for _, member := range units[from] {
+			unitOf[member.ID] = to
+		}
+		units[to] = append(units[to], units[from]...)
+		units[from] = nil
+	}
+
+	var merged [][]models.User
+	for _, unit := range units {
+		if len(unit) > 0 {
+			merged = append(merged, unit)
+		}
+	}
+	return merged
+}
+
+// blocked reports whether anyone in one group has blocked, or been blocked by, anyone in the other
+func blocked(blocks map[uint]map[uint]bool, group, other []uint) bool {
+	for _, userID := range group {
+		for _, otherUserID := range other {
+			if blocks[userID][otherUserID] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func userIDs(users []models.User) []uint {
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func teamMemberIDs(members []models.Member) []uint {
+	ids := make([]uint, len(members))
+	for i, member := range members {
+		ids[i] = member.UserID
+	}
+	return ids
+}
+
+func teamMembers(entries []models.User) []models.Member {
+	members := make([]models.Member, len(entries))
+	for i, entry := range entries {
+		members[i] = models.Member{
+			UserID:    entry.ID,
+			Username:  entry.Username,
+			Age:       entry.Age,
+			Gender:    entry.Gender,
+			Latitude:  entry.Latitude,
+			Longitude: entry.Longitude,
+		}
+	}
+	return members
+}
+
+func CreateTeams(teamRepo *repositories.TeamRepository, notifier *Notifier, avatarStore storage.BlobStore, eventID uint) error {
 	log.Printf("Creating teams for event ID: %d", eventID)
 
 	// Fetch raffle entries for the given event ID
@@ -98,8 +171,17 @@ func CreateTeams(teamRepo *repositories.TeamRepository, eventID uint) error {
 	}
 	log.Printf("Fetched %d raffle entries for event ID: %d", len(entries), eventID)
 
+	teamWith, err := teamRepo.FetchTeamPreferences(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch team preferences: %w", err)
+	}
+	blocks, err := teamRepo.FetchTeamBlocks(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch blocked users: %w", err)
+	}
+
 	// Group entries into teams
-	teams := groupEntries(entries)
+	teams := groupEntries(entries, teamWith, blocks)
 	log.Printf("Created %d teams for event ID: %d", len(teams), eventID)
 
 	// Insert teams into the database
@@ -109,12 +191,12 @@ func CreateTeams(teamRepo *repositories.TeamRepository, eventID uint) error {
 	}
 	log.Printf("Inserted teams into the database for event ID: %d", eventID)
 
-	// Send emails to team members
-	err = sendTeamEmails(teamRepo, teams)
+	// Notify team members
+	err = notifyTeamMembers(teamRepo, notifier, avatarStore, eventID, teams)
 	if err != nil {
-		return fmt.Errorf("failed to send team emails: %w", err)
+		return fmt.Errorf("failed to notify team members: %w", err)
 	}
-	log.Printf("Sent team emails for event ID: %d", eventID)
+	log.Printf("Notified team members for event ID: %d", eventID)
 
 	return nil
 }
@@ -148,8 +230,16 @@ func GetUserTeams(teamRepo *repositories.TeamRepository) http.HandlerFunc {
 	}
 }
 
-func GetTeamsForEvent(teamRepo *repositories.TeamRepository) http.HandlerFunc {
+// GetTeamsForEvent returns the teams of an event. Organisers of the event and admins see every team,
+// and anyone else only the teams they are in. Members are shown as their public profiles, so their
+// other fields are only shown to teammates when allowed, and email addresses never are.
+func GetTeamsForEvent(teamRepo *repositories.TeamRepository, roleRepo *repositories.RoleRepository, avatarStore storage.BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := currentPrincipal(w, r)
+		if !ok {
+			return
+		}
+
 		params := mux.Vars(r)
 		eventIDStr := params["eventId"]
 		eventID, err := strconv.ParseUint(eventIDStr, 10, 64)
@@ -158,18 +248,72 @@ func GetTeamsForEvent(teamRepo *repositories.TeamRepository) http.HandlerFunc {
 			return
 		}
 
-		teams, err := teamRepo.GetTeamsForEvent(uint(eventID))
+		organiser := principal.HasRole(models.RoleAdmin)
+		if !organiser && principal.HasRole(models.RoleOrganiser) {
+			organiser, err = roleRepo.IsEventOrganiser(principal.UserID, uint(eventID))
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		members, err := teamRepo.GetTeamMemberProfiles(uint(eventID))
 		if err != nil {
 			http.Error(w, "Failed to fetch teams for event", http.StatusInternalServerError)
 			return
 		}
 
+		teams := []models.EventTeam{}
+		for _, team := range eventTeams(members) {
+			viewerInTeam := false
+			for _, member := range team {
+				if member.User.ID == principal.UserID {
+					viewerInTeam = true
+				}
+			}
+			if !viewerInTeam && !organiser {
+				continue
+			}
+
+			eventTeam := models.EventTeam{ID: team[0].TeamID}
+			for _, member := range team {
+				viewer := models.ViewerOther
+				if member.User.ID == principal.UserID {
+					viewer = models.ViewerSelf
+				} else if viewerInTeam {
+					viewer = models.ViewerTeammate
+				}
+				member.User.Avatar = avatarURLs(avatarStore, member.User.AvatarKey)
+				profile := models.NewPublicProfile(&member.User, member.Privacy, viewer)
+				profile.Email = ""
+				eventTeam.Members = append(eventTeam.Members, profile)
+			}
+			teams = append(teams, eventTeam)
+		}
+
+		if len(teams) == 0 && !organiser {
+			writeJSONError(w, http.StatusForbidden, "not_in_team", "Only members of a team and organisers of the event can see its teams", nil)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(teams)
 	}
 }
 
-func TriggerCreateTeams(teamRepo *repositories.TeamRepository) http.HandlerFunc {
+// eventTeams splits the members of an event's teams, which are ordered by team, into one slice per team
+func eventTeams(members []models.TeamMemberProfile) [][]models.TeamMemberProfile {
+	var teams [][]models.TeamMemberProfile
+	for i, member := range members {
+		if i == 0 || member.TeamID != members[i-1].TeamID {
+			teams = append(teams, nil)
+		}
+		teams[len(teams)-1] = append(teams[len(teams)-1], member)
+	}
+	return teams
+}
+
+func TriggerCreateTeams(teamRepo *repositories.TeamRepository, notifier *Notifier, avatarStore storage.BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		eventIDStr := params["eventId"]
@@ -179,7 +323,7 @@ func TriggerCreateTeams(teamRepo *repositories.TeamRepository) http.HandlerFunc
 			return
 		}
 
-		err = CreateTeams(teamRepo, uint(eventID))
+		err = CreateTeams(teamRepo, notifier, avatarStore, uint(eventID))
 		if err != nil {
 			http.Error(w, "Failed to create teams", http.StatusInternalServerError)
 			return
@@ -190,16 +334,16 @@ func TriggerCreateTeams(teamRepo *repositories.TeamRepository) http.HandlerFunc
 	}
 }
 
-func ScheduleTeamCreation(teamRepo *repositories.TeamRepository) {
+func ScheduleTeamCreation(teamRepo *repositories.TeamRepository, notifier *Notifier, avatarStore storage.BlobStore) {
 	ticker := time.NewTicker(24 * time.Hour) // Run the task every 24 hours
 	defer ticker.Stop()
 
 	for range ticker.C {
-		createTeamsForUpcomingEvents(teamRepo)
+		createTeamsForUpcomingEvents(teamRepo, notifier, avatarStore)
 	}
 }
 
-func createTeamsForUpcomingEvents(teamRepo *repositories.TeamRepository) {
+func createTeamsForUpcomingEvents(teamRepo *repositories.TeamRepository, notifier *Notifier, avatarStore storage.BlobStore) {
 	log.Printf("Checking raffle entries...")
 
 	eventIDs, err := teamRepo.FetchEventIDsFromRaffleEntries()
@@ -243,8 +387,19 @@ func createTeamsForUpcomingEvents(teamRepo *repositories.TeamRepository) {
 
 			log.Printf("Fetched %d raffle entries for event ID %d", len(entries), eventID)
 
+			teamWith, err := teamRepo.FetchTeamPreferences(eventID)
+			if err != nil {
+				log.Printf("Error fetching team preferences for event ID %d: %v", eventID, err)
+				continue
+			}
+			blocks, err := teamRepo.FetchTeamBlocks(eventID)
+			if err != nil {
+				log.Printf("Error fetching blocked users for event ID %d: %v", eventID, err)
+				continue
+			}
+
 			// Create teams using the fetched users
-			teams := groupEntries(entries)
+			teams := groupEntries(entries, teamWith, blocks)
 			log.Printf("Created %d teams for event ID %d", len(teams), eventID)
 
 			// Insert teams into the database
@@ -254,66 +409,87 @@ func createTeamsForUpcomingEvents(teamRepo *repositories.TeamRepository) {
 				continue
 			}
 
+			err = notifyTeamMembers(teamRepo, notifier, avatarStore, eventID, teams)
+			if err != nil {
+				log.Printf("Error notifying team members for event ID %d: %v", eventID, err)
+			}
+
 			log.Printf("Teams created successfully for event ID %d", eventID)
 		} else {
 			log.Printf("Event ID %d is not exactly 1 week away", eventID)
 		}
 	}
 }
-func fetchEventDetails(eventID uint) (map[string]interface{}, error) {
-    url := skiddle.EventDetailsURL(eventID)
-    resp, err := http.Get(url)
-    if err != nil {
-        return nil, err
-    }
-    defer resp.Body.Close()
-
-    var result map[string]interface{}
-    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-        return nil, err
-    }
-
-    eventDetails, ok := result["results"].(map[string]interface{})
-    if !ok {
-        return nil, fmt.Errorf("invalid event details response")
-    }
+// notifyTeamMembers tells every member of each team who their teammates are. Each member's details
+// are shown as their teammates are allowed to see them. A failure for one member doesn't stop the
+// others from being notified; every failure is logged and returned together.
+func notifyTeamMembers(teamRepo *repositories.TeamRepository, notifier *Notifier, avatarStore storage.BlobStore, eventID uint, teams []models.Team) error {
+	members, err := teamRepo.GetTeamMemberProfiles(eventID)
+	if err != nil {
+		log.Printf("Error fetching team members for event ID %d: %v", eventID, err)
+		return fmt.Errorf("fetching team members: %w", err)
+	}
+	profiles := make(map[uint]models.PublicProfile)
+	for _, member := range members {
+		member.User.Avatar = avatarURLs(avatarStore, member.User.AvatarKey)
+		profiles[member.User.ID] = models.NewPublicProfile(&member.User, member.Privacy, models.ViewerTeammate)
+	}
 
-    return eventDetails, nil
-}
-func sendTeamEmails(teamRepo *repositories.TeamRepository, teams []models.Team) error {
+	var errs []error
 	for _, team := range teams {
-		var teamMemberEmails []string
+		// Construct the notification message
+		subject := "Your Team for Event ID: " + strconv.Itoa(int(eventID))
+		body := "Dear team members,\n\nYour team for the event has been created. The members of your team are:\n\n"
 		var teamMemberSocials []string
 		for _, member := range team.Members {
-			user, err := teamRepo.GetUserByID(member.UserID)
-			if err != nil {
-				return err
+			profile, ok := profiles[member.UserID]
+			if !ok {
+				continue
 			}
 
-			teamMemberEmails = append(teamMemberEmails, user.Email)
-			teamMemberSocials = append(teamMemberSocials, "Instagram: "+user.InstagramUsername+", Facebook: "+user.FacebookUsername+", Snapchat: "+user.SnapchatUsername)
-		}
+			body += "- " + profile.Username + " ("
+			if profile.Age != nil {
+				body += "Age: " + strconv.Itoa(*profile.Age) + ", "
+			}
+			body += "Gender: " + profile.Gender + ")"
+			if profile.Avatar != nil {
+				body += " Photo: " + absoluteURL(profile.Avatar.Medium)
+			}
+			body += "\n"
 
-		// Construct the email message
-		emailSubject := "Your Team for Event ID: " + strconv.Itoa(int(team.EventID))
-		emailBody := "Dear team members,\n\nYour team for the event has been created. The members of your team are:\n\n"
-		for _, member := range team.Members {
-			emailBody += "- " + member.Username + " (Age: " + strconv.Itoa(member.Age) + ", Gender: " + member.Gender + ")\n"
+			// Usernames a member keeps private are left out
+			var socials []string
+			if profile.InstagramUsername != "" {
+				socials = append(socials, "Instagram: "+profile.InstagramUsername)
+			}
+			if profile.FacebookUsername != "" {
+				socials = append(socials, "Facebook: "+profile.FacebookUsername)
+			}
+			if profile.SnapchatUsername != "" {
+				socials = append(socials, "Snapchat: "+profile.SnapchatUsername)
+			}
+			if len(socials) > 0 {
+				teamMemberSocials = append(teamMemberSocials, profile.Username+" - "+strings.Join(socials, ", "))
+			}
 		}
-		emailBody += "\nYour team's social media usernames are:\n\n"
+		body += "\nYour team's social media usernames are:\n\n"
 		for _, social := range teamMemberSocials {
-			emailBody += "- " + social + "\n"
+			body += "- " + social + "\n"
 		}
-		emailBody += "\nBest regards,\nThe Event Team"
+		body += "\nBest regards,\nThe Event Team"
 
-		// Send the email
-		err := sendEmail(teamMemberEmails, emailSubject, emailBody)
-		if err != nil {
-			return err
+		// Notify every member of the team
+		link := "/event-details.html?eventId=" + strconv.Itoa(int(eventID))
+		for _, member := range team.Members {
+			err := notifier.Notify(member.UserID, models.NotificationTeamFormed, subject, body, link)
+			if err != nil {
+				log.Printf("Error notifying user %d of their team for event ID %d: %v", member.UserID, eventID, err)
+				errs = append(errs, fmt.Errorf("notifying user %d: %w", member.UserID, err))
+			}
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 func sendEmail(recipients []string, subject, body string) error {
     // Create HTML content (you can make this more sophisticated if needed)
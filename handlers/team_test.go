@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"event-connect/models"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// entrant returns a raffle entry for the tests, with the gender left blank unless given
+func entrant(id uint, age int, gender ...string) models.User {
+	entry := models.User{ID: id, Age: age}
+	if len(gender) > 0 {
+		entry.Gender = gender[0]
+	}
+	return entry
+}
+
+// teamIDs returns the member IDs of each team, sorted so that teams can be compared regardless of
+// the order genders are grouped in
+func teamIDs(teams []models.Team) [][]uint {
+	ids := make([][]uint, len(teams))
+	for i, team := range teams {
+		ids[i] = teamMemberIDs(team.Members)
+		sort.Slice(ids[i], func(a, b int) bool { return ids[i][a] < ids[i][b] })
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a][0] < ids[b][0] })
+	return ids
+}
+
+// unitIDs returns the member IDs of each friend unit, in order
+func unitIDs(units [][]models.User) [][]uint {
+	ids := make([][]uint, len(units))
+	for i, unit := range units {
+		ids[i] = userIDs(unit)
+	}
+	return ids
+}
+
+func TestGroupEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []models.User
+		teamWith map[uint]uint
+		want     [][]uint
+	}{
+		{
+			name:    "fills teams in order of age",
+			entries: []models.User{entrant(6, 25), entrant(2, 21), entrant(4, 23), entrant(1, 20), entrant(5, 24), entrant(3, 22)},
+			want:    [][]uint{{1, 2, 3, 4}, {5, 6}},
+		},
+		{
+			name:    "keeps genders apart",
+			entries: []models.User{entrant(1, 20, "male"), entrant(2, 20, "female"), entrant(3, 21, "male"), entrant(4, 21, "female"), entrant(5, 22, "male")},
+			want:    [][]uint{{1, 3, 5}, {2, 4}},
+		},
+		{
+			name:     "places friends together",
+			entries:  []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22), entrant(4, 23), entrant(5, 40)},
+			teamWith: map[uint]uint{1: 5},
+			want:     [][]uint{{1, 2, 3, 5}, {4}},
+		},
+		{
+			name:     "starts a new team for friends who don't fit and carries on filling it",
+			entries:  []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22), entrant(4, 23), entrant(5, 40), entrant(6, 41)},
+			teamWith: map[uint]uint{4: 5},
+			want:     [][]uint{{1, 2, 3}, {4, 5, 6}},
+		},
+		{
+			name:    "no entries",
+			entries: nil,
+			want:    [][]uint{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := teamIDs(groupEntries(tt.entries, tt.teamWith, nil))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFriendUnits(t *testing.T) {
+	entries := []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22), entrant(4, 23), entrant(5, 24)}
+
+	tests := []struct {
+		name     string
+		teamWith map[uint]uint
+		want     [][]uint
+	}{
+		{
+			name: "everyone alone without requests",
+			want: [][]uint{{1}, {2}, {3}, {4}, {5}},
+		},
+		{
+			name:     "a request joins the friend's unit",
+			teamWith: map[uint]uint{4: 2},
+			want:     [][]uint{{1}, {2, 4}, {3}, {5}},
+		},
+		{
+			name:     "mutual requests make one unit",
+			teamWith: map[uint]uint{1: 3, 3: 1},
+			want:     [][]uint{{1, 3}, {2}, {4}, {5}},
+		},
+		{
+			name:     "a friend who isn't taking part is ignored",
+			teamWith: map[uint]uint{1: 9},
+			want:     [][]uint{{1}, {2}, {3}, {4}, {5}},
+		},
+		{
+			name:     "a request that would make the unit bigger than a team is ignored",
+			teamWith: map[uint]uint{1: 2, 2: 3, 3: 4, 4: 5},
+			want:     [][]uint{{1, 2, 3, 4}, {5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unitIDs(friendUnits(entries, tt.teamWith, nil))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("friendUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// blockPairs returns blocks between each pair of users, recorded both ways as they are fetched
+func blockPairs(pairs ...[2]uint) map[uint]map[uint]bool {
+	blocks := make(map[uint]map[uint]bool)
+	for _, pair := range pairs {
+		for _, users := range [][2]uint{pair, {pair[1], pair[0]}} {
+			if blocks[users[0]] == nil {
+				blocks[users[0]] = make(map[uint]bool)
+			}
+			blocks[users[0]][users[1]] = true
+		}
+	}
+	return blocks
+}
+
+func TestGroupEntriesWithBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []models.User
+		teamWith map[uint]uint
+		blocks   map[uint]map[uint]bool
+		want     [][]uint
+	}{
+		{
+			name:    "a blocked user starts the next team",
+			entries: []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22), entrant(4, 23), entrant(5, 24)},
+			blocks:  blockPairs([2]uint{2, 3}),
+			want:    [][]uint{{1, 2}, {3, 4, 5}},
+		},
+		{
+			name:     "a request for a friend who was blocked is ignored",
+			entries:  []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22)},
+			teamWith: map[uint]uint{1: 2},
+			blocks:   blockPairs([2]uint{2, 1}),
+			want:     [][]uint{{1}, {2, 3}},
+		},
+		{
+			name:     "friends aren't placed with someone either of them blocked",
+			entries:  []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22), entrant(4, 23)},
+			teamWith: map[uint]uint{1: 4},
+			blocks:   blockPairs([2]uint{4, 2}),
+			want:     [][]uint{{1, 4}, {2, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := teamIDs(groupEntries(tt.entries, tt.teamWith, tt.blocks))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupEntries() = %v, want %v", got, tt.want)
+			}
+			for _, team := range got {
+				if blocked(tt.blocks, team, team) {
+					t.Errorf("team %v has users who blocked each other", team)
+				}
+			}
+		})
+	}
+}
+
+func TestFriendUnitsWithBlocks(t *testing.T) {
+	entries := []models.User{entrant(1, 20), entrant(2, 21), entrant(3, 22)}
+
+	// 3 asks to join 1, who is already with 2, whom 3 blocked
+	got := unitIDs(friendUnits(entries, map[uint]uint{1: 2, 3: 1}, blockPairs([2]uint{3, 2})))
+	want := [][]uint{{1, 2}, {3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("friendUnits() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/repositories"
+	"event-connect/totp"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// totpIssuer is the account issuer shown in authenticator apps
+const totpIssuer = "Event Connect"
+
+// recoveryCodeCount is how many recovery codes are issued when two-factor authentication is enabled
+const recoveryCodeCount = 10
+
+// MFAChallengeResponse is returned by the login endpoint when the account requires a second factor
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfaRequired"`
+	ChallengeToken string `json:"challengeToken"`
+	ExpiresIn      int    `json:"expiresIn"`
+}
+
+// secondFactorRequest carries either a TOTP code or a recovery code
+type secondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// LoginWithTwoFactor completes a login started with a password by checking a TOTP or recovery code
+func LoginWithTwoFactor(userRepo *repositories.UserRepository, tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository,
+	totpRepo *repositories.TOTPRepository, loginAttemptRepo *repositories.LoginAttemptRepository, userTokenRepo *repositories.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var requestBody struct {
+			ChallengeToken string `json:"challengeToken"`
+			secondFactorRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		challenge, err := auth.ParseMFAChallenge(requestBody.ChallengeToken)
+		if err != nil {
+			writeJSONError(w, http.StatusUnauthorized, "invalid_challenge", "Your login has expired, please enter your password again", nil)
+			return
+		}
+		used, err := tokenRepo.IsRevoked(challenge.TokenID, "")
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if used {
+			writeJSONError(w, http.StatusUnauthorized, "invalid_challenge", "Your login has expired, please enter your password again", nil)
+			return
+		}
+
+		user, err := userRepo.GetUserByID(challenge.UserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if refuseInactiveLogin(w, r, userRepo, loginAttemptRepo, user) {
+			return
+		}
+
+		// Code guesses count towards the same throttling and lockout as password guesses
+		wait, err := loginThrottle(loginAttemptRepo, user.Username, clientIP(r))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginThrottled)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many failed login attempts, please try again later", nil)
+			return
+		}
+
+		valid, err := verifySecondFactor(totpRepo, user.ID, requestBody.secondFactorRequest)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginInvalidMFACode)
+			go lockAccountIfNeeded(loginAttemptRepo, userRepo, userTokenRepo, user.Username)
+			writeJSONError(w, http.StatusUnauthorized, "invalid_code", "Invalid authentication code", nil)
+			return
+		}
+
+		// Each challenge can only complete one login
+		if err := tokenRepo.RevokeAccessToken(challenge.TokenID, challenge.ExpiresAt); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		recordLoginAttempt(loginAttemptRepo, r, user.Username, true, models.LoginSucceeded)
+
+		resp, err := issueSession(tokenRepo, roleRepo, user.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when no TOTP code is given.
+// Codes are single use: a TOTP code can't be replayed and a recovery code is consumed.
+func verifySecondFactor(totpRepo *repositories.TOTPRepository, userID uint, req secondFactorRequest) (bool, error) {
+	if req.Code == "" && req.RecoveryCode != "" {
+		return totpRepo.UseRecoveryCode(userID, auth.HashToken(normaliseRecoveryCode(req.RecoveryCode)))
+	}
+
+	enrolment, err := totpRepo.GetTOTP(userID)
+	if err != nil || enrolment == nil || enrolment.EnabledAt == nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, req.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return totpRepo.UseStep(userID, step)
+}
+
+// *************************** Handler Functions ***************************
+
+func GetTwoFactorStatus(totpRepo *repositories.TOTPRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		enabled, err := totpRepo.IsEnabled(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		remaining, err := totpRepo.RemainingRecoveryCodes(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"enabled": enabled, "recoveryCodesRemaining": remaining})
+	}
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user to add to their authenticator app.
+// Two-factor authentication is not turned on until a code is confirmed with EnableTwoFactor.
+func EnrollTwoFactor(userRepo *repositories.UserRepository, totpRepo *repositories.TOTPRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := userRepo.GetUserByID(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := totpRepo.StartEnrolment(userID, secret); err != nil {
+			if errors.Is(err, repositories.ErrTwoFactorAlreadyEnabled) {
+				writeJSONError(w, http.StatusConflict, "already_enabled", "Two-factor authentication is already enabled", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"secret":     secret,
+			"otpauthUri": totp.ProvisioningURI(totpIssuer, user.Username, secret),
+		})
+	}
+}
+
+// EnableTwoFactor turns on two-factor authentication once the user confirms a code from their
+// authenticator app, and returns recovery codes that are shown only this once
+func EnableTwoFactor(totpRepo *repositories.TOTPRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		enrolment, err := totpRepo.GetTOTP(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if enrolment == nil {
+			writeJSONError(w, http.StatusConflict, "not_enrolled", "Start enrolment before enabling two-factor authentication", nil)
+			return
+		}
+		if enrolment.EnabledAt != nil {
+			writeJSONError(w, http.StatusConflict, "already_enabled", "Two-factor authentication is already enabled", nil)
+			return
+		}
+
+		step, valid := totp.Validate(enrolment.Secret, requestBody.Code, time.Now())
+		if !valid {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_code", "Invalid authentication code", nil)
+			return
+		}
+
+		codes, hashes, err := generateRecoveryCodes()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := totpRepo.Enable(userID, step, hashes); err != nil {
+			if errors.Is(err, repositories.ErrTwoFactorAlreadyEnabled) {
+				writeJSONError(w, http.StatusConflict, "already_enabled", "Two-factor authentication is already enabled", nil)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": codes})
+	}
+}
+
+// DisableTwoFactor turns off two-factor authentication after the user re-enters their password and a code
+func DisableTwoFactor(userRepo *repositories.UserRepository, totpRepo *repositories.TOTPRepository, loginAttemptRepo *repositories.LoginAttemptRepository,
+	userTokenRepo *repositories.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Password string `json:"password"`
+			secondFactorRequest
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !reauthenticate(w, r, userRepo, totpRepo, loginAttemptRepo, userTokenRepo, userID, requestBody.Password, requestBody.secondFactorRequest) {
+			return
+		}
+
+		if err := totpRepo.Disable(userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after they confirm a current code
+func RegenerateRecoveryCodes(totpRepo *repositories.TOTPRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Code == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		valid, err := verifySecondFactor(totpRepo, userID, secondFactorRequest{Code: requestBody.Code})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_code", "Invalid authentication code", nil)
+			return
+		}
+
+		codes, hashes, err := generateRecoveryCodes()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := totpRepo.RegenerateRecoveryCodes(userID, hashes); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": codes})
+	}
+}
+
+// reauthenticate checks the user's password, and second factor when enabled, before a sensitive change.
+// Failures count towards login throttling and lockout. It writes the error response and returns false on failure.
+func reauthenticate(w http.ResponseWriter, r *http.Request, userRepo *repositories.UserRepository, totpRepo *repositories.TOTPRepository,
+	loginAttemptRepo *repositories.LoginAttemptRepository, userTokenRepo *repositories.UserTokenRepository, userID uint, password string, factor secondFactorRequest) bool {
+	user, err := userRepo.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+
+	wait, err := loginThrottle(loginAttemptRepo, user.Username, clientIP(r))
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many failed attempts, please try again later", nil)
+		return false
+	}
+
+	if _, err := userRepo.GetUserByUsernameAndPassword(user.Username, password); err != nil {
+		if !errors.Is(err, repositories.ErrInvalidCredentials) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return false
+		}
+		recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginInvalidCredentials)
+		go lockAccountIfNeeded(loginAttemptRepo, userRepo, userTokenRepo, user.Username)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Incorrect password", nil)
+		return false
+	}
+
+	enabled, err := totpRepo.IsEnabled(userID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !enabled {
+		return true
+	}
+
+	valid, err := verifySecondFactor(totpRepo, userID, factor)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !valid {
+		recordLoginAttempt(loginAttemptRepo, r, user.Username, false, models.LoginInvalidMFACode)
+		go lockAccountIfNeeded(loginAttemptRepo, userRepo, userTokenRepo, user.Username)
+		writeJSONError(w, http.StatusUnauthorized, "invalid_code", "Invalid authentication code", nil)
+		return false
+	}
+	return true
+}
+
+// generateRecoveryCodes returns new recovery codes formatted for display and the hashes to store
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, auth.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normaliseRecoveryCode strips the formatting from a recovery code as entered by the user
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"event-connect/auth"
+	"errors"
+	"event-connect/geo"
 	"event-connect/models"
 	"event-connect/repositories"
+	"event-connect/storage"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,7 +14,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func CreateUser(userRepo *repositories.UserRepository) http.HandlerFunc {
+func CreateUser(userRepo *repositories.UserRepository, tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository, userTokenRepo *repositories.UserTokenRepository,
+	geocoder geo.Geocoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var user models.User
 		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
@@ -23,6 +26,25 @@ func CreateUser(userRepo *repositories.UserRepository) http.HandlerFunc {
 
 		log.Printf("Request Body: %+v", user)
 
+		fieldErrors, err := validateUserProfile(userRepo, &user, map[string]string{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(fieldErrors) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors)
+			return
+		}
+
+		if err := resolveLocation(geocoder, &user); err != nil {
+			if err == geo.ErrLocationNotFound {
+				writeLocationError(w)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 		if err != nil {
 			log.Printf("Error hashing password: %v", err)
@@ -40,7 +62,13 @@ func CreateUser(userRepo *repositories.UserRepository) http.HandlerFunc {
 
 		log.Printf("Created User: %+v", user)
 
-		token, err := auth.GenerateJWT(user.ID)
+		go func(userID uint, username, email string) {
+			if err := sendVerificationEmail(userTokenRepo, userID, username, email); err != nil {
+				log.Printf("Error sending verification email to user %d: %v", userID, err)
+			}
+		}(user.ID, user.Username, user.Email)
+
+		session, err := issueSession(tokenRepo, roleRepo, user.ID)
 		if err != nil {
 			log.Printf("Error generating token: %v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -50,11 +78,15 @@ func CreateUser(userRepo *repositories.UserRepository) http.HandlerFunc {
 		user.Password = ""
 
 		response := struct {
-			User  models.User `json:"user"`
-			Token string      `json:"token"`
+			User         models.User `json:"user"`
+			Token        string      `json:"token"`
+			RefreshToken string      `json:"refreshToken"`
+			ExpiresIn    int         `json:"expiresIn"`
 		}{
-			User:  user,
-			Token: token,
+			User:         user,
+			Token:        session.Token,
+			RefreshToken: session.RefreshToken,
+			ExpiresIn:    session.ExpiresIn,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -64,14 +96,12 @@ func CreateUser(userRepo *repositories.UserRepository) http.HandlerFunc {
 
 func GetUserInfo(userRepo *repositories.UserRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := auth.GetUserIDFromToken(r)
-		if err != nil {
-			log.Printf("Error getting user ID from token: %v", err)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		userID, ok := currentUserID(w, r)
+		if !ok {
 			return
 		}
 
-		user, err := userRepo.GetUserByID(uint(userID))
+		user, err := userRepo.GetUserByID(userID)
 		if err != nil {
 			log.Printf("Error fetching user info: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -95,32 +125,34 @@ func GetUserInfo(userRepo *repositories.UserRepository) http.HandlerFunc {
 	}
 }
 
-func GetUserProfile(userRepo *repositories.UserRepository, activityRepo *repositories.ActivityRepository, teamRepo *repositories.TeamRepository) http.HandlerFunc {
+func GetUserProfile(userRepo *repositories.UserRepository, activityRepo *repositories.ActivityRepository, teamRepo *repositories.TeamRepository, avatarStore storage.BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := auth.GetUserIDFromToken(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		userID, ok := currentUserID(w, r)
+		if !ok {
 			return
 		}
 
-		user, err := userRepo.GetUserProfile(uint(userID))
+		user, err := userRepo.GetUserProfile(userID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		activities, err := activityRepo.GetUserActivities(uint(userID))
+		activities, err := activityRepo.GetUserActivities(userID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		teams, err := teamRepo.FetchUserTeams(uint(userID))
+		teams, err := teamRepo.FetchUserTeams(userID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		user.Avatar = avatarURLs(avatarStore, user.AvatarKey)
+		resolveTeamAvatars(avatarStore, teams)
+
 		response := map[string]interface{}{
 			"user":       user,
 			"activities": activities,
@@ -132,22 +164,46 @@ func GetUserProfile(userRepo *repositories.UserRepository, activityRepo *reposit
 	}
 }
 
-func UpdateUserProfile(userRepo *repositories.UserRepository) http.HandlerFunc {
+func UpdateUserProfile(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository, geocoder geo.Geocoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := auth.GetUserIDFromToken(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		userID, ok := currentUserID(w, r)
+		if !ok {
 			return
 		}
 
 		var user models.User
-		err = json.NewDecoder(r.Body).Decode(&user)
+		err := json.NewDecoder(r.Body).Decode(&user)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		user.ID = uint(userID)
+		user.ID = userID
+
+		fieldErrors, err := validateUserProfile(userRepo, &user, map[string]string{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(fieldErrors) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors)
+			return
+		}
+
+		if err := resolveLocation(geocoder, &user); err != nil {
+			if err == geo.ErrLocationNotFound {
+				writeLocationError(w)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		current, err := userRepo.GetUserProfile(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		err = userRepo.UpdateUserProfile(&user)
 		if err != nil {
@@ -155,13 +211,29 @@ func UpdateUserProfile(userRepo *repositories.UserRepository) http.HandlerFunc {
 			return
 		}
 
+		// A new email address has to be verified again
+		if user.Email != current.Email {
+			go func() {
+				if err := sendVerificationEmail(userTokenRepo, userID, user.Username, user.Email); err != nil {
+					log.Printf("Error sending verification email to user %d: %v", userID, err)
+				}
+			}()
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"message": "User profile updated successfully"})
 	}
 }
 
-func GetOtherUserProfile(userRepo *repositories.UserRepository) http.HandlerFunc {
+// GetOtherUserProfile returns another user's profile with only the fields their privacy settings
+// allow the current user to see. Teammate-only fields are shown to users who have shared a team.
+func GetOtherUserProfile(userRepo *repositories.UserRepository, teamRepo *repositories.TeamRepository, avatarStore storage.BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		viewerID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
 		userID := r.URL.Query().Get("userId")
 		if userID == "" {
 			http.Error(w, "User ID is required", http.StatusBadRequest)
@@ -176,11 +248,84 @@ func GetOtherUserProfile(userRepo *repositories.UserRepository) http.HandlerFunc
 
 		user, err := userRepo.GetUserProfile(uint(uid))
 		if err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				writeJSONError(w, http.StatusNotFound, "user_not_found", "User not found", nil)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		privacy, err := userRepo.GetProfilePrivacy(user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		viewer := models.ViewerOther
+		if viewerID == user.ID {
+			viewer = models.ViewerSelf
+		} else {
+			teammates, err := teamRepo.AreTeammates(viewerID, user.ID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if teammates {
+				viewer = models.ViewerTeammate
+			}
+		}
+
+		user.Avatar = avatarURLs(avatarStore, user.AvatarKey)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.NewPublicProfile(user, privacy, viewer))
+	}
+}
+
+func GetProfilePrivacy(userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		privacy, err := userRepo.GetProfilePrivacy(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(privacy)
+	}
+}
+
+// UpdateProfilePrivacy sets who can see each sensitive profile field: public, teammates or private
+func UpdateProfilePrivacy(userRepo *repositories.UserRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		var privacy models.ProfilePrivacy
+		if err := json.NewDecoder(r.Body).Decode(&privacy); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if invalid := privacy.InvalidFields(); len(invalid) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_visibility", "Each field must be public, teammates or private", invalid)
+			return
+		}
+
+		if err := userRepo.UpdateProfilePrivacy(userID, privacy); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(user)
+		json.NewEncoder(w).Encode(privacy)
 	}
 }
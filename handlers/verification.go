@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"event-connect/auth"
+	"event-connect/models"
+	"event-connect/repositories"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// emailVerificationTTL is how long an email verification link stays valid
+const emailVerificationTTL = 48 * time.Hour
+
+// verificationResendInterval is the minimum time between verification emails to the same account
+const verificationResendInterval = time.Minute
+
+// maxVerificationEmailsPerDay limits how many verification emails an account can be sent in a day
+const maxVerificationEmailsPerDay = 5
+
+// sendVerificationEmail emails a user a link that verifies their email address
+func sendVerificationEmail(userTokenRepo *repositories.UserTokenRepository, userID uint, username, email string) error {
+	token, tokenHash, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := userTokenRepo.CreateEmailToken(userID, models.UserTokenEmailVerification, tokenHash, email, time.Now().Add(emailVerificationTTL)); err != nil {
+		return err
+	}
+
+	link := appURL("/verify-email?token=" + url.QueryEscape(token))
+	body := "Hi " + username + ",\n\nPlease confirm your email address by opening the link below:\n\n" + link + "\n\n"
+	body += "The link expires in 48 hours. If you didn't create an account, you can ignore this email.\n\n"
+	body += "Best regards,\nThe Event Team"
+	return sendEmail([]string{email}, "Verify your email address", body)
+}
+
+// VerifyEmail handles the link from a verification email and redirects to the login page with the outcome
+func VerifyEmail(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Redirect(w, r, "/login.html?emailVerified=false", http.StatusSeeOther)
+			return
+		}
+
+		userID, email, err := userTokenRepo.ConsumeEmailToken(models.UserTokenEmailVerification, auth.HashToken(token))
+		if err != nil {
+			if !errors.Is(err, repositories.ErrInvalidToken) {
+				log.Printf("Error consuming email verification token: %v", err)
+			}
+			http.Redirect(w, r, "/login.html?emailVerified=false", http.StatusSeeOther)
+			return
+		}
+
+		// The link only verifies the address it was sent to, not whatever the account uses now
+		if err := userRepo.MarkEmailVerified(userID, email); err != nil {
+			if errors.Is(err, repositories.ErrEmailChanged) {
+				http.Redirect(w, r, "/login.html?emailVerified=false", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/login.html?emailVerified=true", http.StatusSeeOther)
+	}
+}
+
+// ResendVerificationEmail sends the authenticated user a new verification link, rate limited per account
+func ResendVerificationEmail(userRepo *repositories.UserRepository, userTokenRepo *repositories.UserTokenRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := currentUserID(w, r)
+		if !ok {
+			return
+		}
+
+		user, err := userRepo.GetUserProfile(userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if user.EmailVerifiedAt != nil {
+			writeJSONError(w, http.StatusConflict, "already_verified", "Your email address is already verified", nil)
+			return
+		}
+
+		recent, err := userTokenRepo.CountRecentTokens(userID, models.UserTokenEmailVerification, time.Now().Add(-verificationResendInterval))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		today, err := userTokenRepo.CountRecentTokens(userID, models.UserTokenEmailVerification, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if recent > 0 || today >= maxVerificationEmailsPerDay {
+			retryAfter := verificationResendInterval
+			if today >= maxVerificationEmailsPerDay {
+				retryAfter = 24 * time.Hour
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			writeJSONError(w, http.StatusTooManyRequests, "rate_limited", "Too many verification emails requested, please try again later", nil)
+			return
+		}
+
+		if err := sendVerificationEmail(userTokenRepo, userID, user.Username, user.Email); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", userID, err)
+			http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
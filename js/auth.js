@@ -0,0 +1,92 @@
+// Access tokens are short-lived. Requests made with these helpers refresh an expired access token
+// with the stored refresh token and are sent once more before the caller sees the response.
+
+// A refresh token can only be used once, so requests that fail together share one refresh
+let refreshingAccessToken = null;
+
+function refreshAccessToken() {
+  if (!refreshingAccessToken) {
+    const refreshToken = localStorage.getItem('refreshToken');
+    refreshingAccessToken = (refreshToken ? fetch('/token/refresh', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken })
+    }) : Promise.reject(new Error('Not logged in')))
+      .then(response => {
+        if (!response.ok) {
+          throw new Error('Session expired');
+        }
+        return response.json();
+      })
+      .then(data => {
+        localStorage.setItem('token', data.token);
+        localStorage.setItem('refreshToken', data.refreshToken);
+      })
+      .finally(() => {
+        refreshingAccessToken = null;
+      });
+  }
+  return refreshingAccessToken;
+}
+
+// authFetch works like fetch but sends the access token, refreshing it and retrying once on a 401
+async function authFetch(url, options = {}) {
+  const send = () => fetch(url, {
+    ...options,
+    headers: { ...options.headers, 'Authorization': `Bearer ${localStorage.getItem('token')}` }
+  });
+
+  const response = await send();
+  if (response.status !== 401) {
+    return response;
+  }
+  try {
+    await refreshAccessToken();
+  } catch (error) {
+    return response;
+  }
+  return send();
+}
+
+// createAuthorizedRequest returns an XMLHttpRequest that sends the access token. When the token has
+// expired it is refreshed and the request is sent once more before the load handler runs.
+function createAuthorizedRequest() {
+  const xhr = new XMLHttpRequest();
+  const open = xhr.open.bind(xhr);
+  const setRequestHeader = xhr.setRequestHeader.bind(xhr);
+  const send = xhr.send.bind(xhr);
+  let method, url, headers = [];
+
+  xhr.open = function(requestMethod, requestURL) {
+    method = requestMethod;
+    url = requestURL;
+    headers = [];
+    open(method, url);
+  };
+  xhr.setRequestHeader = function(name, value) {
+    if (name.toLowerCase() === 'authorization') {
+      return;
+    }
+    headers.push([name, value]);
+    setRequestHeader(name, value);
+  };
+  xhr.send = function(body) {
+    const onload = xhr.onload;
+    let retried = false;
+    xhr.onload = function(event) {
+      if (xhr.status !== 401 || retried) {
+        return onload && onload.call(xhr, event);
+      }
+      retried = true;
+      refreshAccessToken().then(() => {
+        open(method, url);
+        headers.forEach(([name, value]) => setRequestHeader(name, value));
+        setRequestHeader('Authorization', 'Bearer ' + localStorage.getItem('token'));
+        send(body);
+      }, () => onload && onload.call(xhr, event));
+    };
+    setRequestHeader('Authorization', 'Bearer ' + localStorage.getItem('token'));
+    send(body);
+  };
+  return xhr;
+}
@@ -34,7 +34,9 @@ async function loadComments() {
     const eventId = urlParams.get('eventId');
 
     try {
-        const response = await fetch(`http://localhost:8000/events/${eventId}/comments`);
+        // Signed-in users don't see comments by users they blocked
+        const url = `http://localhost:8000/events/${eventId}/comments`;
+        const response = localStorage.getItem('token') ? await authFetch(url) : await fetch(url);
         const comments = await response.json();
         displayComments(comments);
     } catch (error) {
@@ -50,8 +52,12 @@ function displayComments(comments) {
     comments.forEach(comment => {
         const commentElement = document.createElement('div');
         commentElement.classList.add('comment');
+        // Comments by deleted accounts have no author to link to
+        const author = comment.userId
+            ? `<a href="#" onclick="viewUserProfile(${comment.userId})">${comment.username}</a>`
+            : comment.username;
         commentElement.innerHTML = `
-            <p><a href="#" onclick="viewUserProfile(${comment.userId})">${comment.username}</a> - ${comment.createdAt}</p>
+            <p>${author} - ${comment.createdAt}</p>
             <p>${comment.text}</p>
         `;
         commentsContainer.appendChild(commentElement);
@@ -90,12 +96,10 @@ async function submitComment() {
     }
 
     try {
-        const token = localStorage.getItem('token');
-        const response = await fetch(`http://localhost:8000/events/${eventId}/comments`, {
+        const response = await authFetch(`http://localhost:8000/events/${eventId}/comments`, {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json',
-                'Authorization': `Bearer ${token}`
+                'Content-Type': 'application/json'
             },
             body: JSON.stringify({ text: commentText })
         });
@@ -3,17 +3,23 @@ const urlParams = new URLSearchParams(window.location.search);
 const eventId = urlParams.get('eventId');
 
 let userLocations = [];
+let heatmapCells = [];
 let map;
 
 async function getEventDetails(eventId) {
     try {
         const [eventResponse, userLocationsResponse] = await Promise.all([
             fetch(`http://localhost:8000/events/${eventId}`),
-            fetch(`http://localhost:8000/events/${eventId}/user-locations`)
+            authFetch(`http://localhost:8000/events/${eventId}/user-locations`)
         ]);
 
         const eventData = await eventResponse.json();
-        userLocations = await userLocationsResponse.json();
+        // Attendee locations are only shared with other registered attendees
+        if (userLocationsResponse.ok) {
+            const locations = await userLocationsResponse.json();
+            userLocations = locations.attendees;
+            heatmapCells = locations.heatmap;
+        }
 
         console.log('User Locations:', userLocations);
 
@@ -74,7 +80,7 @@ function renderEventDetails(event) {
 }
 
 function initMap() {
-    if (userLocations.length === 0) {
+    if (heatmapCells.length === 0) {
         // Set default center and zoom level if no user locations available
         map = new google.maps.Map(document.getElementById('map'), {
             center: { lat: 0, lng: 0 },
@@ -84,7 +90,7 @@ function initMap() {
     }
 
     const bounds = new google.maps.LatLngBounds();
-    userLocations.forEach(location => {
+    heatmapCells.forEach(location => {
         const latLng = new google.maps.LatLng(location.latitude, location.longitude);
         bounds.extend(latLng);
     });
@@ -96,9 +102,24 @@ function initMap() {
 
     map.fitBounds(bounds);
 
+    plotHeatmap(heatmapCells);
     plotUserLocations(userLocations);
 }
 
+// Each cell is drawn as a circle sized by how many attendees live in the area
+function plotHeatmap(cells) {
+    cells.forEach(cell => {
+        new google.maps.Circle({
+            map: map,
+            center: { lat: cell.latitude, lng: cell.longitude },
+            radius: 1500 * Math.sqrt(cell.count),
+            fillColor: '#00a1c1',
+            fillOpacity: 0.35,
+            strokeWeight: 0
+        });
+    });
+}
+
 function plotUserLocations(userLocations) {
     userLocations.forEach(location => {
         const latLng = new google.maps.LatLng(location.latitude, location.longitude);
@@ -129,12 +150,8 @@ function loadGoogleMapsAPI() {
 
 async function registerEvent(eventId) {
     try {
-        const token = localStorage.getItem('token');
-        const response = await fetch(`http://localhost:8000/events/${eventId}/register`, {
-            method: 'POST',
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
+        const response = await authFetch(`http://localhost:8000/events/${eventId}/register`, {
+            method: 'POST'
         });
 
         if (response.ok) {
@@ -152,22 +169,9 @@ async function registerEvent(eventId) {
 
 async function enterRaffle(eventId) {
     try {
-        const token = localStorage.getItem('token');
-        const userInfo = await getUserInfo();
-
-        const response = await fetch(`http://localhost:8000/events/${eventId}/raffle`, {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json',
-                'Authorization': `Bearer ${token}`
-            },
-            body: JSON.stringify({
-                eventId: eventId.toString(),
-                age: userInfo.age,
-                gender: userInfo.gender,
-                latitude: userInfo.latitude,
-                longitude: userInfo.longitude
-            })
+        // Age, gender and location are taken from the user's profile by the server
+        const response = await authFetch(`http://localhost:8000/events/${eventId}/raffle`, {
+            method: 'POST'
         });
 
         if (response.ok) {
@@ -185,12 +189,8 @@ async function enterRaffle(eventId) {
 
 async function getUserInfo() {
     try {
-        const token = localStorage.getItem('token');
-        const response = await fetch('http://localhost:8000/user', {
-            method: 'GET',
-            headers: {
-                'Authorization': `Bearer ${token}`
-            }
+        const response = await authFetch('http://localhost:8000/user', {
+            method: 'GET'
         });
 
         if (response.ok) {
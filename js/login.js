@@ -9,6 +9,79 @@ class LoginForm {
 
     this.initializeEventListeners();
     this.initializeLocationAutocomplete();
+    this.showEmailVerificationResult();
+    this.showSignInProviders();
+    this.completeProviderSignIn();
+  }
+
+  showEmailVerificationResult() {
+    const emailVerified = new URLSearchParams(window.location.search).get('emailVerified');
+    if (emailVerified === 'true') {
+      this.showSuccessMessage('Your email address has been verified. You can now log in.');
+    } else if (emailVerified === 'false') {
+      this.showErrorMessage('This verification link is invalid or has expired.');
+    }
+
+    const unlocked = new URLSearchParams(window.location.search).get('unlocked');
+    if (unlocked === 'true') {
+      this.showSuccessMessage('Your account has been unlocked. You can now log in.');
+    } else if (unlocked === 'false') {
+      this.showErrorMessage('This unlock link is invalid or has expired.');
+    }
+
+    const restored = new URLSearchParams(window.location.search).get('restored');
+    if (restored === 'true') {
+      this.showSuccessMessage('Your account has been restored. You can now log in.');
+    } else if (restored === 'false') {
+      this.showErrorMessage('This restore link is invalid or has expired.');
+    }
+  }
+
+  showSignInProviders() {
+    const container = document.getElementById('sign-in-providers');
+    fetch('/auth/oidc/providers')
+      .then(response => response.json())
+      .then(data => {
+        data.providers.forEach(provider => {
+          const link = document.createElement('a');
+          link.href = '/auth/oidc/' + encodeURIComponent(provider) + '/login';
+          link.className = 'sign-in-provider';
+          link.textContent = 'Sign in with ' + provider.charAt(0).toUpperCase() + provider.slice(1);
+          container.appendChild(link);
+        });
+      })
+      .catch(() => {});
+  }
+
+  // A provider sign in returns to this page with the outcome in the query string, or tokens in the fragment
+  completeProviderSignIn() {
+    const signInErrors = {
+      cancelled: 'Sign in was cancelled.',
+      expired: 'Sign in took too long. Please try again.',
+      unavailable: 'Sign in with this provider is not available right now.',
+      failed: 'Sign in failed. Please try again.',
+      email_not_verified: 'Your email address must be verified with the provider before you can sign in.',
+      account_email_not_verified: 'An account with this email address already exists. Log in with your password and verify your email address to link it.',
+      account_suspended: 'Your account has been suspended.',
+      account_deleted: 'This account has been deleted. Use the link we emailed you to restore it.'
+    };
+    const signInError = new URLSearchParams(window.location.search).get('signInError');
+    if (signInError) {
+      this.showErrorMessage(signInErrors[signInError] || signInErrors.failed);
+    }
+
+    const fragment = new URLSearchParams(window.location.hash.slice(1));
+    if (!fragment.has('token') && !fragment.has('challengeToken')) {
+      return;
+    }
+    history.replaceState(null, '', window.location.pathname);
+
+    if (fragment.has('challengeToken')) {
+      this.completeTwoFactorLogin(fragment.get('challengeToken'));
+      return;
+    }
+    this.storeToken(fragment.get('token'), fragment.get('refreshToken'));
+    window.location.href = '/';
   }
 
   initializeEventListeners() {
@@ -274,10 +347,29 @@ class LoginForm {
     xhr.onload = () => {
       if (xhr.status === 200) {
         const data = JSON.parse(xhr.responseText);
+        if (data.mfaRequired) {
+          this.completeTwoFactorLogin(data.challengeToken);
+          return;
+        }
         const token = data.token;
         this.showSuccessMessage(successMessage, token);
-        this.storeToken(token);
+        this.storeToken(token, data.refreshToken);
         this.redirectToMainPage();
+      } else if (xhr.status === 429) {
+        this.showErrorMessage('Too many failed login attempts. Please try again later.');
+      } else if (xhr.status === 403 && JSON.parse(xhr.responseText).error === 'account_suspended') {
+        this.showErrorMessage('Your account has been suspended.');
+      } else if (xhr.status === 422 && JSON.parse(xhr.responseText).error === 'invalid_location') {
+        this.setErrorMessage('location-error', JSON.parse(xhr.responseText).message);
+        this.showErrorMessage('Request failed. Please check your input.');
+      } else if (xhr.status === 422 && JSON.parse(xhr.responseText).error === 'validation_failed') {
+        const details = JSON.parse(xhr.responseText).details || {};
+        Object.keys(details).forEach(field => {
+          if (document.getElementById(field + '-error')) {
+            this.setErrorMessage(field + '-error', 'This field ' + details[field] + '.');
+          }
+        });
+        this.showErrorMessage('Request failed. Please check your input.');
       } else {
         this.showErrorMessage('Request failed. Please check your input.');
       }
@@ -290,6 +382,22 @@ class LoginForm {
     xhr.send(JSON.stringify(requestBody));
   }
 
+  completeTwoFactorLogin(challengeToken) {
+    const code = prompt('Enter the 6-digit code from your authenticator app, or one of your recovery codes:');
+    if (!code) {
+      this.showErrorMessage('Login cancelled.');
+      return;
+    }
+
+    const requestBody = { challengeToken };
+    if (/^\d{6}$/.test(code.trim())) {
+      requestBody.code = code.trim();
+    } else {
+      requestBody.recoveryCode = code.trim();
+    }
+    this.sendRequest(requestBody, '/login/2fa', 'Login successful');
+  }
+
   showSuccessMessage(message, token) {
     this.messageElement.textContent = message;
     this.messageElement.style.color = 'green';
@@ -300,8 +408,9 @@ class LoginForm {
     this.messageElement.style.color = 'red';
   }
 
-  storeToken(token) {
+  storeToken(token, refreshToken) {
     localStorage.setItem('token', token);
+    localStorage.setItem('refreshToken', refreshToken);
   }
 
   redirectToMainPage() {
@@ -3,7 +3,7 @@
  var userId = urlParams.get('userId');
 
  // Fetch the user's profile from the server
- var xhr = new XMLHttpRequest();
+ var xhr = createAuthorizedRequest();
  xhr.open('GET', '/other-user-profile?userId=' + userId);
 
  xhr.onload = function() {
@@ -11,16 +11,16 @@
          var user = JSON.parse(xhr.responseText);
          // Display the user's profile details
          document.getElementById('username').textContent = user.username;
-         document.getElementById('email').textContent = user.email;
-         document.getElementById('firstName').textContent = user.firstName;
-         document.getElementById('lastName').textContent = user.lastName;
-         document.getElementById('bio').textContent = user.bio;
-         document.getElementById('interests').textContent = user.interests;
-         document.getElementById('location').textContent = user.location;
-         document.getElementById('age').textContent = user.age;
-         document.getElementById('instagramUsername').textContent = user.instagramUsername;
-         document.getElementById('facebookUsername').textContent = user.facebookUsername;
-         document.getElementById('snapchatUsername').textContent = user.snapchatUsername;
+         document.getElementById('email').textContent = user.email || 'Hidden';
+         document.getElementById('firstName').textContent = user.firstName || '';
+         document.getElementById('lastName').textContent = user.lastName || '';
+         document.getElementById('bio').textContent = user.bio || '';
+         document.getElementById('interests').textContent = user.interests || '';
+         document.getElementById('location').textContent = user.location || 'Hidden';
+         document.getElementById('age').textContent = user.age !== undefined ? user.age : 'Hidden';
+         document.getElementById('instagramUsername').textContent = user.instagramUsername || 'Hidden';
+         document.getElementById('facebookUsername').textContent = user.facebookUsername || 'Hidden';
+         document.getElementById('snapchatUsername').textContent = user.snapchatUsername || 'Hidden';
 
          // Get the "Add Friend" button element
          var addFriendBtn = document.getElementById('add-friend-btn');
@@ -30,22 +30,16 @@
              // Get the user ID from the URL parameter
              var friendId = urlParams.get('userId');
 
-             // Get the current user's ID and token from localStorage or another source
-             var userId = localStorage.getItem('userId');
-           
-             console.log('User ID:', userId);
-             console.log('Token:', token);
-
              // Send the friend request to the server
-             var xhr = new XMLHttpRequest();
-             xhr.open('POST', '/send-friend-request');
+             var xhr = createAuthorizedRequest();
+             xhr.open('POST', '/friends/requests');
              xhr.setRequestHeader('Content-Type', 'application/json');
-             xhr.setRequestHeader('Authorization', 'Bearer ' + localStorage.getItem('token')); // Add this line
 
              xhr.onload = function() {
                  if (xhr.status === 200) {
-                     console.log('Friend request sent successfully');
-                     // Optionally, you can display a success message to the user
+                     var result = JSON.parse(xhr.responseText);
+                     addFriendBtn.textContent = result.status === 'accepted' ? 'Friends' : 'Request sent';
+                     addFriendBtn.disabled = true;
                  } else {
                      console.error('Error sending friend request:', xhr.status);
                      // Handle the error, such as displaying an error message to the user
@@ -58,11 +52,12 @@
              };
 
              var requestData = {
-                 UserID: userId,
-                 FriendID: friendId
+                 userId: parseInt(friendId, 10)
              };
              xhr.send(JSON.stringify(requestData));
          });
+     } else if (xhr.status === 401) {
+         window.location.href = '/login.html';
      } else {
          console.error('Error fetching user profile:', xhr.status);
          // Handle the error, such as displaying an error message to the user
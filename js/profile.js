@@ -6,9 +6,8 @@ if (!token) {
 }
 
 // Fetch user profile and activities from the server
-var xhr = new XMLHttpRequest();
+var xhr = createAuthorizedRequest();
 xhr.open('GET', '/profile');
-xhr.setRequestHeader('Authorization', 'Bearer ' + token);
 
 xhr.onload = function() {
     if (xhr.status === 200) {
@@ -20,6 +19,9 @@ xhr.onload = function() {
 
         // Display user profile details
         document.getElementById('username').textContent = data.user.username || '';
+        if (data.user.avatar) {
+            showAvatar(data.user.avatar);
+        }
         document.getElementById('email').textContent = data.user.email || '';
         document.getElementById('firstName').textContent = data.user.firstName || '';
         document.getElementById('lastName').textContent = data.user.lastName || '';
@@ -166,6 +168,9 @@ xhr.onload = function() {
             document.getElementById('edit-instagramUsername').value = data.user.instagramUsername;
             document.getElementById('edit-facebookUsername').value = data.user.facebookUsername;
             document.getElementById('edit-snapchatUsername').value = data.user.snapchatUsername;
+            document.getElementById('edit-ageMin').value = data.user.ageMin || '';
+            document.getElementById('edit-ageMax').value = data.user.ageMax || '';
+            document.getElementById('edit-distancePreference').value = data.user.distancePreference || '';
         });
 
         cancelEditBtn.addEventListener('click', function() {
@@ -177,8 +182,8 @@ xhr.onload = function() {
         updateProfileForm.addEventListener('submit', function(event) {
             event.preventDefault();
 
-            // Get the updated profile data from the form
-            var updatedProfile = {
+            // Only send the fields that changed; the server leaves the others as they are
+            var formValues = {
                 username: document.getElementById('edit-username').value,
                 email: document.getElementById('edit-email').value,
                 firstName: document.getElementById('edit-firstName').value,
@@ -186,17 +191,24 @@ xhr.onload = function() {
                 bio: document.getElementById('edit-bio').value,
                 interests: document.getElementById('edit-interests').value,
                 location: document.getElementById('edit-location').value,
-                age: data.user.age, // Include the current age value
                 instagramUsername: document.getElementById('edit-instagramUsername').value,
                 facebookUsername: document.getElementById('edit-facebookUsername').value,
-                snapchatUsername: document.getElementById('edit-snapchatUsername').value
+                snapchatUsername: document.getElementById('edit-snapchatUsername').value,
+                ageMin: parseInt(document.getElementById('edit-ageMin').value) || null,
+                ageMax: parseInt(document.getElementById('edit-ageMax').value) || null,
+                distancePreference: parseInt(document.getElementById('edit-distancePreference').value) || null
             };
+            var updatedProfile = {};
+            Object.keys(formValues).forEach(function(field) {
+                if (formValues[field] !== (data.user[field] || (typeof formValues[field] === 'string' ? '' : null))) {
+                    updatedProfile[field] = formValues[field];
+                }
+            });
 
             // Make an HTTP request to update the user profile
-            var xhr = new XMLHttpRequest();
-            xhr.open('PUT', '/profile');
+            var xhr = createAuthorizedRequest();
+            xhr.open('PATCH', '/profile');
             xhr.setRequestHeader('Content-Type', 'application/json');
-            xhr.setRequestHeader('Authorization', 'Bearer ' + token);
 
             xhr.onload = function() {
                 if (xhr.status === 200) {
@@ -204,6 +216,12 @@ xhr.onload = function() {
                     alert('Profile updated successfully');
                     // Refresh the profile details on the page
                     location.reload();
+                } else if (xhr.status === 422) {
+                    // Show what is wrong with each field
+                    var details = JSON.parse(xhr.responseText).details || {};
+                    document.getElementById('edit-profile-errors').textContent = Object.keys(details).map(function(field) {
+                        return field + ' ' + details[field];
+                    }).join('. ');
                 } else {
                     // Handle error
                     alert('Error updating profile');
@@ -223,4 +241,132 @@ xhr.onerror = function() {
     // Handle the error, such as displaying an error message to the user
 };
 
-xhr.send();
\ No newline at end of file
+xhr.send();
+
+// Load and save who can see each profile field
+var privacyFields = ['email', 'location', 'age', 'instagramUsername', 'facebookUsername', 'snapchatUsername'];
+
+var privacyXhr = createAuthorizedRequest();
+privacyXhr.open('GET', '/profile/privacy');
+privacyXhr.onload = function() {
+    if (privacyXhr.status === 200) {
+        var privacy = JSON.parse(privacyXhr.responseText);
+        privacyFields.forEach(function(field) {
+            document.getElementById('privacy-' + field).value = privacy[field];
+        });
+    }
+};
+privacyXhr.send();
+
+document.getElementById('privacy-form').addEventListener('submit', function(event) {
+    event.preventDefault();
+
+    var privacy = {};
+    privacyFields.forEach(function(field) {
+        privacy[field] = document.getElementById('privacy-' + field).value;
+    });
+
+    var xhr = createAuthorizedRequest();
+    xhr.open('PUT', '/profile/privacy');
+    xhr.setRequestHeader('Content-Type', 'application/json');
+    xhr.onload = function() {
+        alert(xhr.status === 200 ? 'Privacy settings saved' : 'Error saving privacy settings');
+    };
+    xhr.send(JSON.stringify(privacy));
+});
+
+// Download everything held about the user as a ZIP archive
+document.getElementById('export-data-btn').addEventListener('click', function() {
+    var xhr = createAuthorizedRequest();
+    xhr.open('GET', '/account/export');
+    xhr.responseType = 'blob';
+    xhr.onload = function() {
+        if (xhr.status !== 200) {
+            alert('Error exporting your data');
+            return;
+        }
+        var disposition = xhr.getResponseHeader('Content-Disposition') || '';
+        var match = disposition.match(/filename="([^"]+)"/);
+        var link = document.createElement('a');
+        link.href = URL.createObjectURL(xhr.response);
+        link.download = match ? match[1] : 'event-connect-export.zip';
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+        URL.revokeObjectURL(link.href);
+    };
+    xhr.send();
+});
+
+// Delete the account after confirming the password, and an authentication code when two-factor authentication is enabled
+document.getElementById('delete-account-btn').addEventListener('click', function() {
+    if (!confirm('Delete your account? You will be signed out and removed from your raffles and teams.')) {
+        return;
+    }
+    var password = prompt('Enter your password to delete your account');
+    if (!password) {
+        return;
+    }
+    deleteAccount({ password: password });
+});
+
+function deleteAccount(body) {
+    var xhr = createAuthorizedRequest();
+    xhr.open('DELETE', '/account');
+    xhr.setRequestHeader('Content-Type', 'application/json');
+    xhr.onload = function() {
+        if (xhr.status === 204) {
+            localStorage.removeItem('token');
+            localStorage.removeItem('refreshToken');
+            alert('Your account has been deleted. We have emailed you a link to restore it within 30 days.');
+            window.location.href = '/login.html';
+            return;
+        }
+        var error = {};
+        try {
+            error = JSON.parse(xhr.responseText);
+        } catch (e) {}
+        if (error.error === 'invalid_code' && !body.code) {
+            var code = prompt('Enter the code from your authenticator app');
+            if (code) {
+                body.code = code;
+                deleteAccount(body);
+            }
+            return;
+        }
+        alert(error.message || 'Error deleting your account');
+    };
+    xhr.send(JSON.stringify(body));
+}
+
+// Upload a new profile photo; the server crops it to a square and removes its metadata
+document.getElementById('avatar-input').addEventListener('change', function() {
+    var file = this.files[0];
+    if (!file) {
+        return;
+    }
+    var formData = new FormData();
+    formData.append('avatar', file);
+
+    var xhr = createAuthorizedRequest();
+    xhr.open('POST', '/profile/avatar');
+    xhr.onload = function() {
+        var response = {};
+        try {
+            response = JSON.parse(xhr.responseText);
+        } catch (e) {}
+        if (xhr.status === 200) {
+            showAvatar(response.avatar);
+        } else {
+            alert(response.message || 'Error uploading your photo');
+        }
+    };
+    xhr.send(formData);
+    this.value = '';
+});
+
+function showAvatar(avatar) {
+    var img = document.getElementById('avatar');
+    img.src = avatar.large;
+    img.style.display = 'block';
+}
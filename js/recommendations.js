@@ -0,0 +1,92 @@
+// Check if the user is logged in
+var token = localStorage.getItem('token');
+if (!token) {
+    // Redirect to the login page if the user is not logged in
+    window.location.href = '/login.html';
+}
+
+var pageSize = 20;
+var offset = 0;
+
+function describeReason(reason) {
+    switch (reason.type) {
+        case 'shared_interests':
+            return 'You both like ' + reason.interests.join(', ');
+        case 'nearby':
+            return 'Within ' + reason.distanceKm + ' km of you';
+        case 'shared_events':
+            return 'Registered for ' + reason.events + (reason.events === 1 ? ' event' : ' events') + ' you are going to';
+        default:
+            return '';
+    }
+}
+
+function renderRecommendation(recommendation) {
+    var card = document.createElement('div');
+    card.className = 'profile-container';
+
+    var link = document.createElement('a');
+    link.href = '/other-user-profile.html?userId=' + recommendation.user.id;
+    link.textContent = recommendation.user.username;
+    var title = document.createElement('h3');
+    title.className = 'title is-5';
+    title.appendChild(link);
+    card.appendChild(title);
+
+    var interests = document.createElement('p');
+    interests.textContent = recommendation.user.interests || '';
+    card.appendChild(interests);
+
+    var reasons = document.createElement('ul');
+    recommendation.reasons.forEach(function(reason) {
+        var item = document.createElement('li');
+        item.textContent = describeReason(reason);
+        reasons.appendChild(item);
+    });
+    card.appendChild(reasons);
+
+    document.getElementById('recommendations').appendChild(card);
+}
+
+function loadRecommendations() {
+    var params = new URLSearchParams({ limit: pageSize, offset: offset });
+    var interest = document.getElementById('filter-interest').value.trim();
+    var maxDistanceKm = document.getElementById('filter-maxDistanceKm').value;
+    if (interest) {
+        params.set('interest', interest);
+    }
+    if (maxDistanceKm) {
+        params.set('maxDistanceKm', maxDistanceKm);
+    }
+
+    var xhr = createAuthorizedRequest();
+    xhr.open('GET', '/recommendations/users?' + params.toString());
+
+    xhr.onload = function() {
+        if (xhr.status === 200) {
+            var data = JSON.parse(xhr.responseText);
+            data.recommendations.forEach(renderRecommendation);
+            offset += data.recommendations.length;
+            document.getElementById('load-more-btn').style.display = offset < data.total ? 'block' : 'none';
+        } else {
+            console.error('Error fetching recommendations:', xhr.status);
+        }
+    };
+
+    xhr.onerror = function() {
+        console.error('Error fetching recommendations:', xhr.status);
+    };
+
+    xhr.send();
+}
+
+document.getElementById('recommendation-filters').addEventListener('submit', function(event) {
+    event.preventDefault();
+    offset = 0;
+    document.getElementById('recommendations').innerHTML = '';
+    loadRecommendations();
+});
+
+document.getElementById('load-more-btn').addEventListener('click', loadRecommendations);
+
+loadRecommendations();
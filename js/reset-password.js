@@ -0,0 +1,58 @@
+const token = new URLSearchParams(window.location.search).get('token');
+const forgotForm = document.getElementById('forgot-form');
+const resetForm = document.getElementById('reset-form');
+const messageElement = document.getElementById('message');
+
+function showMessage(message, color) {
+  messageElement.textContent = message;
+  messageElement.style.color = color;
+}
+
+if (token) {
+  resetForm.style.display = 'block';
+} else {
+  forgotForm.style.display = 'block';
+}
+
+forgotForm.addEventListener('submit', async (event) => {
+  event.preventDefault();
+  try {
+    const response = await fetch('http://localhost:8000/password/forgot', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ email: document.getElementById('email').value })
+    });
+    const data = await response.json();
+    showMessage(data.message, 'green');
+  } catch (error) {
+    showMessage('Request failed. Please try again.', 'red');
+  }
+});
+
+resetForm.addEventListener('submit', async (event) => {
+  event.preventDefault();
+  const password = document.getElementById('password').value;
+  if (password !== document.getElementById('confirm-password').value) {
+    showMessage('Passwords do not match.', 'red');
+    return;
+  }
+
+  try {
+    const response = await fetch('http://localhost:8000/password/reset', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token, password })
+    });
+    const data = await response.json();
+    if (response.ok) {
+      localStorage.removeItem('token');
+      localStorage.removeItem('refreshToken');
+      showMessage(data.message, 'green');
+      resetForm.style.display = 'none';
+    } else {
+      showMessage(data.message, 'red');
+    }
+  } catch (error) {
+    showMessage('Request failed. Please try again.', 'red');
+  }
+});
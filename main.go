@@ -6,10 +6,13 @@ import (
 	"net/http"
 	"os"
 
+	"event-connect/geo"
 	"event-connect/handlers"
 	"event-connect/models"
+	"event-connect/oidc"
 	"event-connect/repositories"
 	"event-connect/routes"
+	"event-connect/storage"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
@@ -38,21 +41,90 @@ func main() {
 	activityRepo := repositories.NewActivityRepository(db, logger)
 	teamRepo := repositories.NewTeamRepository(db, logger)
 	raffleRepo := repositories.NewRaffleRepository(db, logger)
+	commentRepo := repositories.NewCommentRepository(db)
+	notificationRepo := repositories.NewNotificationRepository(db, logger)
+	reminderRepo := repositories.NewReminderRepository(db, logger)
+	tokenRepo := repositories.NewTokenRepository(db, logger)
+	roleRepo := repositories.NewRoleRepository(db, logger)
+	userTokenRepo := repositories.NewUserTokenRepository(db, logger)
+	loginAttemptRepo := repositories.NewLoginAttemptRepository(db, logger)
+	totpRepo := repositories.NewTOTPRepository(db, logger)
+	identityRepo := repositories.NewIdentityRepository(db, logger)
+	friendRepo := repositories.NewFriendRepository(db, logger)
+	blockRepo := repositories.NewBlockRepository(db, logger)
+	reportRepo := repositories.NewReportRepository(db, logger)
+	accountRepo := repositories.NewAccountRepository(db, logger)
 
-	// Schedule daily team creation
-    go handlers.ScheduleTeamCreation(teamRepo)
+	// Run a maintenance command instead of the server, e.g. "grant-admin <username>"
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], userRepo, roleRepo); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Configure "sign in with" providers
+	oidcProviders, err := oidc.ProvidersFromEnv(handlers.OIDCCallbackURL)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Initialize handlers
 	eventHandler := handlers.NewEventHandler(activityRepo)
+	notifier := handlers.NewNotifier(notificationRepo)
+	locationFuzzer, err := geo.NewLocationFuzzerFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	geocoder, err := geo.NewOfflineGeocoder()
+	if err != nil {
+		log.Fatal(err)
+	}
+	uploadStore, err := storage.NewLocalDiskFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Schedule daily team creation
+	go handlers.ScheduleTeamCreation(teamRepo, notifier, uploadStore)
+
+	// Schedule pruning of old read notifications
+	go handlers.ScheduleNotificationPruning(notificationRepo)
+
+	// Schedule reminders before registered events
+	reminderWindows, err := handlers.ParseReminderWindows(os.Getenv("EVENT_REMINDER_WINDOWS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go handlers.ScheduleEventReminders(reminderRepo, teamRepo, notifier, reminderWindows)
+
+	// Schedule raffle draws once entries close
+	go handlers.ScheduleRaffleDraws(raffleRepo, notifier)
+
+	// Schedule pruning of expired tokens
+	go handlers.ScheduleTokenPruning(tokenRepo, userTokenRepo, identityRepo)
+
+	// Schedule pruning of old login attempts
+	go handlers.ScheduleLoginAttemptPruning(loginAttemptRepo)
+
+	// Schedule purging of deleted accounts once their grace period ends
+	go handlers.ScheduleAccountPurge(accountRepo, userRepo, uploadStore)
 
 	// Middleware
 	r.Use(routes.LoggingMiddleware)
-	authMiddleware := routes.AuthMiddleware
+	authMiddleware := routes.NewAuthMiddleware(tokenRepo)
 
 	// Register routes
 	routes.StaticFileRoutes(r)
+	routes.UploadRoutes(r, uploadStore)
 	routes.HTMLFileRoutes(r)
-	routes.APIRoutes(r, userRepo, activityRepo, teamRepo, raffleRepo, authMiddleware, eventHandler)
+	routes.APIRoutes(r, userRepo, activityRepo, teamRepo, raffleRepo, commentRepo, tokenRepo, roleRepo, userTokenRepo, loginAttemptRepo, totpRepo, friendRepo, blockRepo, accountRepo, authMiddleware, eventHandler, notifier, locationFuzzer, geocoder, uploadStore)
+	routes.NotificationRoutes(r, notificationRepo, authMiddleware)
+	routes.ReminderRoutes(r, reminderRepo, authMiddleware)
+	routes.FriendRoutes(r, friendRepo, blockRepo, userRepo, notifier, authMiddleware)
+	routes.ModerationRoutes(r, blockRepo, reportRepo, userRepo, authMiddleware)
+	routes.AdminRoutes(r, roleRepo, userRepo, tokenRepo, authMiddleware)
+	routes.OIDCRoutes(r, oidcProviders, identityRepo, userRepo, tokenRepo, roleRepo, totpRepo, loginAttemptRepo, authMiddleware)
 	routes.TwitterScraperRoute(r)
 
 	// Start the server
@@ -0,0 +1,22 @@
+package models
+
+import "encoding/json"
+
+// ExportSection is one part of the data exported about a user, such as their profile or comments
+type ExportSection struct {
+	Name string
+	Data json.RawMessage
+}
+
+// RafflePromotion is an entrant moved from the waitlist to a place in an event's raffle
+type RafflePromotion struct {
+	EventID uint
+	UserID  uint
+}
+
+// TeamMembership is a team a user belonged to, with the other members of the team
+type TeamMembership struct {
+	EventID   uint   `json:"eventId"`
+	TeamID    string `json:"teamId"`
+	Teammates []uint `json:"teammates"`
+}
@@ -11,3 +11,19 @@ type Activity struct {
 	ActivityType string    `json:"activity_type"`
 	Timestamp    time.Time `json:"timestamp"`
 }
+
+// UserLocation is the home location of a user registered for an event
+type UserLocation struct {
+	UserID             uint
+	Latitude           float64
+	Longitude          float64
+	LocationVisibility string
+	// IsTeammate is whether the user shares a team with the user viewing the locations
+	IsTeammate bool
+}
+
+// EventEngagement is the number of users who registered for, or entered the raffle of, an event
+type EventEngagement struct {
+	EventID uint `json:"eventId"`
+	Users   int  `json:"users"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// Avatar holds the URLs of a user's profile photo at each thumbnail size
+type Avatar struct {
+	Large  string `json:"large"`
+	Medium string `json:"medium"`
+	Small  string `json:"small"`
+}
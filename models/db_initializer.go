@@ -136,6 +136,466 @@ func InitializeDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Allow comments to reply to other comments
+	_, err = db.Exec(`ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES comments(id)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create notifications table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS notifications (
+            id SERIAL PRIMARY KEY,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            type VARCHAR(50) NOT NULL,
+            title VARCHAR(255) NOT NULL,
+            body TEXT NOT NULL,
+            link TEXT,
+            read_at TIMESTAMP WITHOUT TIME ZONE,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_at DESC)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create notification_preferences table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS notification_preferences (
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            type VARCHAR(50) NOT NULL,
+            in_app BOOLEAN NOT NULL DEFAULT TRUE,
+            email BOOLEAN NOT NULL DEFAULT TRUE,
+            PRIMARY KEY (user_id, type)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow users to opt out of event reminders
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS event_reminders_opt_out BOOLEAN NOT NULL DEFAULT FALSE`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create event_reminders table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS event_reminders (
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            event_id INTEGER NOT NULL,
+            reminder_window VARCHAR(20) NOT NULL,
+            sent_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (user_id, event_id, reminder_window)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Track the outcome of each raffle entry
+	_, err = db.Exec(`
+        ALTER TABLE raffle_entries
+            ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'entered',
+            ADD COLUMN IF NOT EXISTS waitlist_position INTEGER,
+            ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create raffles table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS raffles (
+            event_id VARCHAR(255) PRIMARY KEY,
+            places INTEGER NOT NULL CHECK (places > 0),
+            closes_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+            drawn_at TIMESTAMP WITHOUT TIME ZONE,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit to the raffle seed before entries close
+	_, err = db.Exec(`
+        ALTER TABLE raffles
+            ADD COLUMN IF NOT EXISTS seed VARCHAR(64),
+            ADD COLUMN IF NOT EXISTS seed_hash VARCHAR(64)
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create raffle_draws table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS raffle_draws (
+            event_id VARCHAR(255) PRIMARY KEY REFERENCES raffles(event_id),
+            algorithm VARCHAR(50) NOT NULL,
+            seed VARCHAR(64) NOT NULL,
+            seed_hash VARCHAR(64) NOT NULL,
+            places INTEGER NOT NULL,
+            entries JSONB NOT NULL,
+            winners JSONB NOT NULL,
+            waitlist JSONB NOT NULL,
+            drawn_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create raffle_entry_history table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS raffle_entry_history (
+            id SERIAL PRIMARY KEY,
+            event_id VARCHAR(255) NOT NULL,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            action VARCHAR(20) NOT NULL,
+            age INTEGER,
+            gender VARCHAR(10),
+            latitude DOUBLE PRECISION,
+            longitude DOUBLE PRECISION,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create raffle_rules table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS raffle_rules (
+            event_id VARCHAR(255) PRIMARY KEY,
+            rules JSONB NOT NULL,
+            updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create token_families table; each login starts a family of rotating refresh tokens
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS token_families (
+            id VARCHAR(64) PRIMARY KEY,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            revoked_at TIMESTAMP WITHOUT TIME ZONE
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create refresh_tokens table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS refresh_tokens (
+            id SERIAL PRIMARY KEY,
+            family_id VARCHAR(64) NOT NULL REFERENCES token_families(id),
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            token_hash VARCHAR(64) NOT NULL UNIQUE,
+            expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+            used_at TIMESTAMP WITHOUT TIME ZONE,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create revoked_access_tokens table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+            token_id VARCHAR(64) PRIMARY KEY,
+            expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_roles table; every user implicitly holds the "user" role
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_roles (
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            role VARCHAR(20) NOT NULL,
+            granted_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (user_id, role)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create event_organisers table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS event_organisers (
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            event_id INTEGER NOT NULL,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (user_id, event_id)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_tokens table for single-use tokens emailed to users, stored hashed
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_tokens (
+            id SERIAL PRIMARY KEY,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            purpose VARCHAR(30) NOT NULL,
+            token_hash VARCHAR(64) NOT NULL UNIQUE,
+            expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+            used_at TIMESTAMP WITHOUT TIME ZONE,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record when a user verified their email address
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP WITHOUT TIME ZONE`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create login_attempts table; an audit trail of logins that also drives throttling and lockout
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS login_attempts (
+            id SERIAL PRIMARY KEY,
+            username VARCHAR(255) NOT NULL,
+            user_id INTEGER REFERENCES users(id),
+            ip_address VARCHAR(45) NOT NULL,
+            user_agent TEXT,
+            success BOOLEAN NOT NULL,
+            reason VARCHAR(30) NOT NULL,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS login_attempts_username_idx ON login_attempts (username, created_at DESC)`)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS login_attempts_ip_address_idx ON login_attempts (ip_address, created_at DESC)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_totp table; enabled_at is set once the user has confirmed a code
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_totp (
+            user_id INTEGER PRIMARY KEY REFERENCES users(id),
+            secret VARCHAR(64) NOT NULL,
+            enabled_at TIMESTAMP WITHOUT TIME ZONE,
+            last_used_step BIGINT,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_recovery_codes table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_recovery_codes (
+            id SERIAL PRIMARY KEY,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            code_hash VARCHAR(64) NOT NULL,
+            used_at TIMESTAMP WITHOUT TIME ZONE,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_identities table; links users to accounts at external OpenID Connect providers
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_identities (
+            id SERIAL PRIMARY KEY,
+            user_id INTEGER NOT NULL REFERENCES users(id),
+            provider VARCHAR(50) NOT NULL,
+            subject VARCHAR(255) NOT NULL,
+            email VARCHAR(255),
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            last_login_at TIMESTAMP WITHOUT TIME ZONE,
+            UNIQUE (provider, subject)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create oidc_login_states table; holds the state, nonce and PKCE verifier of sign ins in progress
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS oidc_login_states (
+            state_hash VARCHAR(64) PRIMARY KEY,
+            provider VARCHAR(50) NOT NULL,
+            nonce VARCHAR(64) NOT NULL,
+            code_verifier VARCHAR(128) NOT NULL,
+            expires_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create profile_privacy table; users without a row use the default visibility of each field
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS profile_privacy (
+            user_id INTEGER PRIMARY KEY REFERENCES users(id),
+            email VARCHAR(10) NOT NULL,
+            location VARCHAR(10) NOT NULL,
+            age VARCHAR(10) NOT NULL,
+            instagram_username VARCHAR(10) NOT NULL,
+            facebook_username VARCHAR(10) NOT NULL,
+            snapchat_username VARCHAR(10) NOT NULL,
+            updated_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create friendships table; a pair of users has at most one row, whichever of them asked first
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS friendships (
+            id SERIAL PRIMARY KEY,
+            requester_id INTEGER NOT NULL REFERENCES users(id),
+            addressee_id INTEGER NOT NULL REFERENCES users(id),
+            status VARCHAR(20) NOT NULL DEFAULT 'pending',
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            accepted_at TIMESTAMP WITHOUT TIME ZONE,
+            CHECK (requester_id <> addressee_id)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_friendships_pair ON friendships (LEAST(requester_id, addressee_id), GREATEST(requester_id, addressee_id))`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let raffle entrants ask to be placed in the same team as a friend
+	_, err = db.Exec(`ALTER TABLE raffle_entries ADD COLUMN IF NOT EXISTS team_with_user_id INTEGER REFERENCES users(id)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_blocks table
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_blocks (
+            blocker_id INTEGER NOT NULL REFERENCES users(id),
+            blocked_id INTEGER NOT NULL REFERENCES users(id),
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (blocker_id, blocked_id),
+            CHECK (blocker_id <> blocked_id)
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create user_reports table, the queue moderators work through
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS user_reports (
+            id SERIAL PRIMARY KEY,
+            reporter_id INTEGER NOT NULL REFERENCES users(id),
+            reported_id INTEGER NOT NULL REFERENCES users(id),
+            reason VARCHAR(50) NOT NULL,
+            details TEXT,
+            status VARCHAR(20) NOT NULL DEFAULT 'open',
+            created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            resolved_by INTEGER REFERENCES users(id),
+            resolved_at TIMESTAMP WITHOUT TIME ZONE,
+            resolution_note TEXT
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_user_reports_status ON user_reports (status, created_at)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let admins suspend accounts
+	_, err = db.Exec(`
+        ALTER TABLE users
+            ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP WITHOUT TIME ZONE,
+            ADD COLUMN IF NOT EXISTS suspension_reason TEXT
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record when a user deleted their account; personal data is purged once the grace period ends
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITHOUT TIME ZONE`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store where each user's avatar thumbnails are kept; null until they upload a photo
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_key VARCHAR(255)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remember when events start so that reminders aren't looked up for events that are over
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS event_start_times (
+            event_id INTEGER PRIMARY KEY,
+            starts_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+            refreshed_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reserve an entrant's email domain when the raffle allows one entry per domain, so that two
+	// entries from the same domain can't both pass the eligibility check
+	_, err = db.Exec(`ALTER TABLE raffle_entries ADD COLUMN IF NOT EXISTS unique_email_domain VARCHAR(255)`)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_raffle_entries_unique_email_domain ON raffle_entries (event_id, unique_email_domain)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tie email verification tokens to the address they were sent to
+	_, err = db.Exec(`ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS email VARCHAR(255)`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record when a user was last emailed about their account being locked, so that it happens once per lockout
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS lockout_notified_at TIMESTAMP WITHOUT TIME ZONE`)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Println("Database tables initialized successfully")
 	return db, nil
 }
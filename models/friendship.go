@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Friendship statuses
+const (
+	FriendshipPending  = "pending"
+	FriendshipAccepted = "accepted"
+)
+
+// Friend is a user who has accepted a friend request from, or had theirs accepted by, another user
+type Friend struct {
+	UserID    uint      `json:"userId"`
+	Username  string    `json:"username"`
+	FirstName *string   `json:"firstName"`
+	Since     time.Time `json:"since"`
+}
+
+// FriendRequest is a pending friend request, either sent to or by the current user
+type FriendRequest struct {
+	UserID    uint      `json:"userId"`
+	Username  string    `json:"username"`
+	FirstName *string   `json:"firstName"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FriendRequests are the current user's pending friend requests
+type FriendRequests struct {
+	Incoming []FriendRequest `json:"incoming"`
+	Outgoing []FriendRequest `json:"outgoing"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to their account at an external OpenID Connect provider
+type UserIdentity struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"userId"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// OIDCLoginState is a sign in with an OpenID Connect provider that is waiting for the provider's callback
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+}
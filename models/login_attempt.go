@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Outcomes recorded for login attempts
+const (
+	LoginSucceeded          = "success"
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginInvalidMFACode     = "invalid_mfa_code"
+	LoginThrottled          = "throttled"
+	LoginUnlocked           = "unlocked"
+	LoginPasswordReset      = "password_reset"
+	LoginSingleSignOn       = "single_sign_on"
+	LoginSuspended          = "suspended"
+)
+
+type LoginAttempt struct {
+	ID        uint      `json:"id"`
+	Username  string    `json:"-"`
+	IPAddress string    `json:"ipAddress"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
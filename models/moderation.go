@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Reasons a user can be reported for
+const (
+	ReportHarassment           = "harassment"
+	ReportSpam                 = "spam"
+	ReportInappropriateContent = "inappropriate_content"
+	ReportFakeProfile          = "fake_profile"
+	ReportUnderage             = "underage"
+	ReportOther                = "other"
+)
+
+// ReportReasons lists every reason a user can be reported for
+var ReportReasons = []string{
+	ReportHarassment,
+	ReportSpam,
+	ReportInappropriateContent,
+	ReportFakeProfile,
+	ReportUnderage,
+	ReportOther,
+}
+
+// IsReportReason reports whether reason is a known report reason
+func IsReportReason(reason string) bool {
+	for _, known := range ReportReasons {
+		if known == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses of a report in the moderator queue
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+// MaxReportDetailsLength is the longest description a report can have
+const MaxReportDetailsLength = 2000
+
+// BlockedUser is a user the current user has blocked
+type BlockedUser struct {
+	UserID    uint      `json:"userId"`
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blockedAt"`
+}
+
+// UserReport is a report of a user, as shown to moderators
+type UserReport struct {
+	ID               uint       `json:"id"`
+	ReporterID       uint       `json:"reporterId"`
+	ReporterUsername string     `json:"reporterUsername"`
+	ReportedID       uint       `json:"reportedId"`
+	ReportedUsername string     `json:"reportedUsername"`
+	Reason           string     `json:"reason"`
+	Details          string     `json:"details,omitempty"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	ResolvedBy       *uint      `json:"resolvedBy,omitempty"`
+	ResolvedAt       *time.Time `json:"resolvedAt,omitempty"`
+	ResolutionNote   string     `json:"resolutionNote,omitempty"`
+}
+
+// Suspension records that an admin suspended an account
+type Suspension struct {
+	SuspendedAt time.Time `json:"suspendedAt"`
+	Reason      string    `json:"reason"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification types delivered through the notification centre
+const (
+	NotificationTeamFormed    = "team_formed"
+	NotificationRaffleResult  = "raffle_result"
+	NotificationCommentReply  = "comment_reply"
+	NotificationEventReminder = "event_reminder"
+	NotificationFriendRequest = "friend_request"
+	NotificationTeamChanged   = "team_changed"
+)
+
+// NotificationTypes lists every notification type a user can set preferences for
+var NotificationTypes = []string{
+	NotificationTeamFormed,
+	NotificationRaffleResult,
+	NotificationCommentReply,
+	NotificationEventReminder,
+	NotificationFriendRequest,
+	NotificationTeamChanged,
+}
+
+type Notification struct {
+	ID        uint       `json:"id"`
+	UserID    uint       `json:"userId"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Link      string     `json:"link,omitempty"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type NotificationPreference struct {
+	Type  string `json:"type"`
+	InApp bool   `json:"inApp"`
+	Email bool   `json:"email"`
+}
+
+// IsNotificationType reports whether t is a known notification type
+func IsNotificationType(t string) bool {
+	for _, known := range NotificationTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package models
+
+import "time"
+
+// Who can see a profile field
+const (
+	VisibilityPublic    = "public"
+	VisibilityTeammates = "teammates"
+	VisibilityPrivate   = "private"
+)
+
+// IsVisibility reports whether visibility is a known visibility setting
+func IsVisibility(visibility string) bool {
+	return visibility == VisibilityPublic || visibility == VisibilityTeammates || visibility == VisibilityPrivate
+}
+
+// ProfilePrivacy holds who can see each of a user's sensitive profile fields
+type ProfilePrivacy struct {
+	Email             string `json:"email"`
+	Location          string `json:"location"`
+	Age               string `json:"age"`
+	InstagramUsername string `json:"instagramUsername"`
+	FacebookUsername  string `json:"facebookUsername"`
+	SnapchatUsername  string `json:"snapchatUsername"`
+}
+
+// DefaultProfilePrivacy is used for users who have not changed their privacy settings
+func DefaultProfilePrivacy() ProfilePrivacy {
+	return ProfilePrivacy{
+		Email:             VisibilityPrivate,
+		Location:          VisibilityTeammates,
+		Age:               VisibilityPublic,
+		InstagramUsername: VisibilityTeammates,
+		FacebookUsername:  VisibilityTeammates,
+		SnapchatUsername:  VisibilityTeammates,
+	}
+}
+
+// InvalidFields returns the fields, keyed by their JSON name, that don't hold a known visibility
+func (p ProfilePrivacy) InvalidFields() map[string]string {
+	fields := map[string]string{
+		"email":             p.Email,
+		"location":          p.Location,
+		"age":               p.Age,
+		"instagramUsername": p.InstagramUsername,
+		"facebookUsername":  p.FacebookUsername,
+		"snapchatUsername":  p.SnapchatUsername,
+	}
+
+	invalid := map[string]string{}
+	for field, visibility := range fields {
+		if !IsVisibility(visibility) {
+			invalid[field] = "must be one of public, teammates or private"
+		}
+	}
+	return invalid
+}
+
+// How the user viewing a profile is related to its owner
+const (
+	ViewerOther = iota
+	ViewerTeammate
+	ViewerSelf
+)
+
+// PublicProfile is the view of a user's profile shown to other users. Fields the viewer isn't
+// allowed to see are left out, and exact coordinates are never included.
+type PublicProfile struct {
+	ID                uint      `json:"id"`
+	Username          string    `json:"username"`
+	FirstName         *string   `json:"firstName"`
+	LastName          string    `json:"lastName"`
+	Bio               string    `json:"bio"`
+	Interests         string    `json:"interests"`
+	Gender            string    `json:"gender"`
+	Email             string    `json:"email,omitempty"`
+	Location          string    `json:"location,omitempty"`
+	Age               *int      `json:"age,omitempty"`
+	InstagramUsername string    `json:"instagramUsername,omitempty"`
+	FacebookUsername  string    `json:"facebookUsername,omitempty"`
+	SnapchatUsername  string    `json:"snapchatUsername,omitempty"`
+	Avatar            *Avatar   `json:"avatar,omitempty"`
+	IsTeammate        bool      `json:"isTeammate"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// NewPublicProfile projects a user's profile for a viewer with the given relationship to them
+func NewPublicProfile(user *User, privacy ProfilePrivacy, viewer int) PublicProfile {
+	visible := func(visibility string) bool {
+		switch visibility {
+		case VisibilityPublic:
+			return true
+		case VisibilityTeammates:
+			return viewer >= ViewerTeammate
+		default:
+			return viewer == ViewerSelf
+		}
+	}
+
+	profile := PublicProfile{
+		ID:         user.ID,
+		Username:   user.Username,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		Bio:        user.Bio,
+		Interests:  user.Interests,
+		Gender:     user.Gender,
+		Avatar:     user.Avatar,
+		IsTeammate: viewer == ViewerTeammate,
+		CreatedAt:  user.CreatedAt,
+	}
+	if visible(privacy.Email) {
+		profile.Email = user.Email
+	}
+	if visible(privacy.Location) {
+		profile.Location = user.Location
+	}
+	if visible(privacy.Age) {
+		age := user.Age
+		profile.Age = &age
+	}
+	if visible(privacy.InstagramUsername) {
+		profile.InstagramUsername = user.InstagramUsername
+	}
+	if visible(privacy.FacebookUsername) {
+		profile.FacebookUsername = user.FacebookUsername
+	}
+	if visible(privacy.SnapchatUsername) {
+		profile.SnapchatUsername = user.SnapchatUsername
+	}
+	return profile
+}
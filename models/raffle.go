@@ -1,14 +1,62 @@
 package models
 
 import (
+	"time"
+
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
+// Raffle entry statuses
+const (
+	RaffleEntryEntered    = "entered"
+	RaffleEntryWon        = "won"
+	RaffleEntryWaitlisted = "waitlisted"
+	RaffleEntryDeclined   = "declined"
+)
+
+// Raffle entry history actions
+const (
+	RaffleEntryActionEntered   = "entered"
+	RaffleEntryActionAmended   = "amended"
+	RaffleEntryActionWithdrawn = "withdrawn"
+)
+
 type RaffleEntry struct {
-	EventID   uint    `json:"event_id"`
-	UserID    uint    `json:"user_id"`
-	Age       int     `json:"age"`
-	Gender    string  `json:"gender"`
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	EventID          uint    `json:"event_id"`
+	UserID           uint    `json:"user_id"`
+	Age              int     `json:"age"`
+	Gender           string  `json:"gender"`
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	Status           string  `json:"status"`
+	WaitlistPosition *int    `json:"waitlist_position,omitempty"`
+	TeamWithUserID   *uint   `json:"team_with_user_id,omitempty"`
+}
+
+type Raffle struct {
+	EventID   uint       `json:"eventId"`
+	Places    int        `json:"places"`
+	ClosesAt  time.Time  `json:"closesAt"`
+	DrawnAt   *time.Time `json:"drawnAt"`
+	SeedHash  string     `json:"seedHash"`
+	Seed      string     `json:"-"` // kept secret until the draw record is published
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// RaffleDraw is the published record of a raffle draw, sufficient to recompute the result
+type RaffleDraw struct {
+	EventID   uint      `json:"eventId"`
+	Algorithm string    `json:"algorithm"`
+	Seed      string    `json:"seed"`
+	SeedHash  string    `json:"seedHash"`
+	Places    int       `json:"places"`
+	Entries   []uint    `json:"entries"`
+	Winners   []uint    `json:"winners"`
+	Waitlist  []uint    `json:"waitlist"`
+	DrawnAt   time.Time `json:"drawnAt"`
+}
+
+// IsOpen reports whether the raffle still accepts entries at the given time
+func (r *Raffle) IsOpen(now time.Time) bool {
+	return r.DrawnAt == nil && now.Before(r.ClosesAt)
 }
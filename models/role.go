@@ -0,0 +1,27 @@
+package models
+
+// Roles that can be granted to a user
+const (
+	RoleUser      = "user"
+	RoleOrganiser = "organiser"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role in increasing order of privilege
+var Roles = []string{
+	RoleUser,
+	RoleOrganiser,
+	RoleModerator,
+	RoleAdmin,
+}
+
+// IsRole reports whether role is a known role
+func IsRole(role string) bool {
+	for _, known := range Roles {
+		if known == role {
+			return true
+		}
+	}
+	return false
+}
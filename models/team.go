@@ -21,4 +21,20 @@ type Member struct {
 	InstagramUsername string  `json:"instagramUsername"`
 	FacebookUsername  string  `json:"facebookUsername"`
 	SnapchatUsername  string  `json:"snapchatUsername"`
+	AvatarKey         string  `json:"avatarKey,omitempty"`
+	Avatar            *Avatar `json:"avatar,omitempty"`
+}
+
+// TeamMemberProfile is the profile of a member of a team, with the privacy settings that decide
+// which of its fields other users can see
+type TeamMemberProfile struct {
+	TeamID  string
+	User    User
+	Privacy ProfilePrivacy
+}
+
+// EventTeam is a team of an event as shown to its members and the event's organisers
+type EventTeam struct {
+	ID      string          `json:"id"`
+	Members []PublicProfile `json:"members"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// UserTOTP is a user's TOTP enrolment. EnabledAt is nil until the user confirms a code.
+type UserTOTP struct {
+	UserID       uint
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep *int64
+	CreatedAt    time.Time
+}
@@ -0,0 +1,9 @@
+package models
+
+// Purposes of single-use tokens emailed to users
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+	UserTokenAccountUnlock     = "account_unlock"
+	UserTokenAccountRestore    = "account_restore"
+)
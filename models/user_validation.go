@@ -0,0 +1,110 @@
+package models
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Genders users can choose from
+var Genders = []string{"male", "female", "non-binary", "other"}
+
+// Limits on profile fields
+const (
+	MinUserAge            = 18
+	MaxUserAge            = 120
+	MaxDistancePreference = 1000
+	maxBioLength          = 1000
+	maxInterestsLength    = 500
+	maxNameLength         = 100
+)
+
+var (
+	usernamePattern       = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,30}$`)
+	socialUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.]{0,30}$`)
+)
+
+// NormaliseProfile tidies free-text profile fields before they are validated and saved
+func NormaliseProfile(user *User) {
+	user.Username = strings.TrimSpace(user.Username)
+	user.Email = strings.TrimSpace(user.Email)
+	user.Gender = strings.ToLower(strings.TrimSpace(user.Gender))
+	user.InstagramUsername = strings.TrimPrefix(strings.TrimSpace(user.InstagramUsername), "@")
+	user.FacebookUsername = strings.TrimPrefix(strings.TrimSpace(user.FacebookUsername), "@")
+	user.SnapchatUsername = strings.TrimPrefix(strings.TrimSpace(user.SnapchatUsername), "@")
+}
+
+// ValidateProfile checks a user's profile fields and returns an error message for each invalid
+// field, keyed by its JSON name. An empty map means the profile is valid.
+func ValidateProfile(user *User) map[string]string {
+	errors := map[string]string{}
+
+	if !usernamePattern.MatchString(user.Username) {
+		errors["username"] = "must be 3 to 30 letters, numbers, dots, dashes or underscores"
+	}
+	if address, err := mail.ParseAddress(user.Email); err != nil || address.Address != user.Email {
+		errors["email"] = "must be a valid email address"
+	}
+	if user.FirstName != nil && utf8.RuneCountInString(*user.FirstName) > maxNameLength {
+		errors["firstName"] = "must be at most 100 characters"
+	}
+	if utf8.RuneCountInString(user.LastName) > maxNameLength {
+		errors["lastName"] = "must be at most 100 characters"
+	}
+	if utf8.RuneCountInString(user.Bio) > maxBioLength {
+		errors["bio"] = "must be at most 1000 characters"
+	}
+	if utf8.RuneCountInString(user.Interests) > maxInterestsLength {
+		errors["interests"] = "must be at most 500 characters"
+	}
+	if user.Latitude < -90 || user.Latitude > 90 {
+		errors["latitude"] = "must be between -90 and 90"
+	}
+	if user.Longitude < -180 || user.Longitude > 180 {
+		errors["longitude"] = "must be between -180 and 180"
+	}
+	if user.Age < MinUserAge || user.Age > MaxUserAge {
+		errors["age"] = "must be between 18 and 120"
+	}
+	if !IsGender(user.Gender) {
+		errors["gender"] = "must be one of " + strings.Join(Genders, ", ")
+	}
+
+	socials := map[string]string{
+		"instagramUsername": user.InstagramUsername,
+		"facebookUsername":  user.FacebookUsername,
+		"snapchatUsername":  user.SnapchatUsername,
+	}
+	for field, username := range socials {
+		if !socialUsernamePattern.MatchString(username) {
+			errors[field] = "must be at most 30 letters, numbers, dots or underscores"
+		}
+	}
+
+	// Preferences of zero mean the user hasn't set them
+	if user.AgeMin != 0 && (user.AgeMin < MinUserAge || user.AgeMin > MaxUserAge) {
+		errors["ageMin"] = "must be between 18 and 120"
+	}
+	if user.AgeMax != 0 && (user.AgeMax < MinUserAge || user.AgeMax > MaxUserAge) {
+		errors["ageMax"] = "must be between 18 and 120"
+	}
+	if user.AgeMin != 0 && user.AgeMax != 0 && user.AgeMin > user.AgeMax {
+		errors["ageMax"] = "must not be less than ageMin"
+	}
+	if user.DistancePreference < 0 || user.DistancePreference > MaxDistancePreference {
+		errors["distancePreference"] = "must be between 0 and 1000 kilometers"
+	}
+
+	return errors
+}
+
+// IsGender reports whether gender is one of the genders users can choose from
+func IsGender(gender string) bool {
+	for _, g := range Genders {
+		if g == gender {
+			return true
+		}
+	}
+	return false
+}
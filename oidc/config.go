@@ -0,0 +1,42 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProvidersFromEnv configures the providers named in OIDC_PROVIDERS (e.g. "google,dev").
+// Each provider NAME is configured with OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET
+// and optionally OIDC_NAME_SCOPES and OIDC_NAME_REDIRECT_URL, which defaults to defaultRedirectURL(name).
+func ProvidersFromEnv(defaultRedirectURL func(name string) string) (map[string]*Provider, error) {
+	providers := make(map[string]*Provider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := Config{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.IssuerURL == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = defaultRedirectURL(name)
+		}
+		if len(config.Scopes) > 0 && !contains(config.Scopes, "openid") {
+			config.Scopes = append([]string{"openid"}, config.Scopes...)
+		}
+
+		providers[name] = NewProvider(config)
+	}
+	return providers, nil
+}
@@ -0,0 +1,243 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// devCodeTTL is how long an authorization code issued by the development provider can be redeemed
+const devCodeTTL = time.Minute
+
+// DevProvider is a stand-in OpenID Connect provider for local development and manual testing of
+// "sign in with" flows. It signs anyone in as whatever email address they type, so it must never
+// be reachable from outside a developer's machine.
+type DevProvider struct {
+	issuer string
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu    sync.Mutex
+	codes map[string]devAuthorization
+}
+
+// devAuthorization is an issued authorization code waiting to be redeemed at the token endpoint
+type devAuthorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	name          string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+// NewDevProvider creates a development provider that identifies itself as issuer, e.g. "http://localhost:9000"
+func NewDevProvider(issuer string) (*DevProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DevProvider{
+		issuer: strings.TrimRight(issuer, "/"),
+		key:    key,
+		kid:    kid[:16],
+		codes:  make(map[string]devAuthorization),
+	}, nil
+}
+
+func (d *DevProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		d.serveDiscovery(w)
+	case "/authorize":
+		d.serveAuthorize(w, r)
+	case "/token":
+		d.serveToken(w, r)
+	case "/jwks":
+		writeJSON(w, http.StatusOK, map[string][]jsonWebKey{"keys": {newJSONWebKey(d.kid, &d.key.PublicKey)}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *DevProvider) serveDiscovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                d.issuer,
+		"authorization_endpoint":                d.issuer + "/authorize",
+		"token_endpoint":                        d.issuer + "/token",
+		"jwks_uri":                              d.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+var devSignInPage = template.Must(template.New("signin").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Development sign in</title></head>
+<body>
+    <h2>Development OpenID Connect provider</h2>
+    <p>Sign in as any user. Do not use this provider outside local development.</p>
+    <form method="POST" action="/authorize">
+        {{range $name, $values := .}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">{{end}}{{end}}
+        <div><label>Email: <input type="email" name="email" required></label></div>
+        <div><label>Name: <input type="text" name="name"></label></div>
+        <div><label><input type="checkbox" name="email_verified" value="true" checked> Email address verified</label></div>
+        <button type="submit">Sign in</button>
+    </form>
+</body>
+</html>`))
+
+// serveAuthorize shows a sign in form, then redirects back to the client with an authorization code
+func (d *DevProvider) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("response_type") != "code" || r.Form.Get("client_id") == "" ||
+		r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		http.Error(w, "the authorization code flow with S256 PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		devSignInPage.Execute(w, url.Values{
+			"response_type":         {"code"},
+			"client_id":             {r.Form.Get("client_id")},
+			"redirect_uri":          {r.Form.Get("redirect_uri")},
+			"state":                 {r.Form.Get("state")},
+			"nonce":                 {r.Form.Get("nonce")},
+			"code_challenge":        {r.Form.Get("code_challenge")},
+			"code_challenge_method": {"S256"},
+		})
+		return
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	d.mu.Lock()
+	d.codes[code] = devAuthorization{
+		clientID:      r.Form.Get("client_id"),
+		redirectURI:   r.Form.Get("redirect_uri"),
+		codeChallenge: r.Form.Get("code_challenge"),
+		nonce:         r.Form.Get("nonce"),
+		email:         strings.TrimSpace(r.Form.Get("email")),
+		name:          strings.TrimSpace(r.Form.Get("name")),
+		emailVerified: r.Form.Get("email_verified") == "true",
+		expiresAt:     time.Now().Add(devCodeTTL),
+	}
+	d.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// serveToken redeems an authorization code for a signed ID token after checking the PKCE code verifier
+func (d *DevProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	clientID, _, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+	} else {
+		clientID = r.Form.Get("client_id")
+	}
+
+	code := r.Form.Get("code")
+	d.mu.Lock()
+	authorization, found := d.codes[code]
+	delete(d.codes, code)
+	d.mu.Unlock()
+
+	if !found || time.Now().After(authorization.expiresAt) ||
+		authorization.clientID != clientID ||
+		authorization.redirectURI != r.Form.Get("redirect_uri") ||
+		CodeChallenge(r.Form.Get("code_verifier")) != authorization.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	givenName, familyName := authorization.name, ""
+	if i := strings.LastIndex(authorization.name, " "); i > 0 {
+		givenName, familyName = authorization.name[:i], authorization.name[i+1:]
+	}
+
+	subject := sha256.Sum256([]byte(strings.ToLower(authorization.email)))
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                d.issuer,
+		"sub":                hex.EncodeToString(subject[:16]),
+		"aud":                clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              authorization.nonce,
+		"email":              authorization.email,
+		"email_verified":     authorization.emailVerified,
+		"name":               authorization.name,
+		"given_name":         givenName,
+		"family_name":        familyName,
+		"preferred_username": strings.SplitN(authorization.email, "@", 2)[0],
+	})
+	token.Header["kid"] = d.kid
+	idToken, err := token.SignedString(d.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, err := RandomString()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		IDToken:     idToken,
+		ExpiresIn:   300,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,159 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newDevServer starts a development provider and a client registered with it
+func newDevServer(t *testing.T) (*httptest.Server, *Provider) {
+	t.Helper()
+
+	var dev *DevProvider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dev.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	var err error
+	dev, err = NewDevProvider(server.URL)
+	if err != nil {
+		t.Fatalf("NewDevProvider: %v", err)
+	}
+
+	provider := NewProvider(Config{
+		Name:        "dev",
+		IssuerURL:   server.URL,
+		ClientID:    "event-connect",
+		RedirectURL: "http://app.test/auth/oidc/dev/callback",
+	})
+	return server, provider
+}
+
+// signIn submits the provider's sign in form for the authorization request at authURL and returns
+// the query of the redirect back to the client
+func signIn(t *testing.T, authURL, email string) url.Values {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parsing authorization URL: %v", err)
+	}
+	form := parsed.Query()
+	form.Set("email", email)
+	form.Set("name", "Ada Lovelace")
+	form.Set("email_verified", "true")
+	parsed.RawQuery = ""
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(parsed.String(), form)
+	if err != nil {
+		t.Fatalf("submitting sign in form: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("sign in returned status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), "http://app.test/auth/oidc/dev/callback?") {
+		t.Fatalf("redirected to %q, want the client's redirect URL", location)
+	}
+	return location.Query()
+}
+
+func TestDevProviderSignIn(t *testing.T) {
+	ctx := context.Background()
+	_, provider := newDevServer(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "the-state", "the-nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	callback := signIn(t, authURL, "ada@example.com")
+	if callback.Get("state") != "the-state" {
+		t.Fatalf("state = %q, want %q", callback.Get("state"), "the-state")
+	}
+
+	token, err := provider.Exchange(ctx, callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, "the-nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+
+	if idToken.Email != "ada@example.com" || !idToken.EmailVerified {
+		t.Errorf("email = %q (verified %v), want ada@example.com (verified)", idToken.Email, idToken.EmailVerified)
+	}
+	if idToken.Subject == "" {
+		t.Error("subject is empty")
+	}
+	if idToken.GivenName != "Ada" || idToken.FamilyName != "Lovelace" {
+		t.Errorf("name = %q %q, want Ada Lovelace", idToken.GivenName, idToken.FamilyName)
+	}
+
+	// A code can only be redeemed once
+	if _, err := provider.Exchange(ctx, callback.Get("code"), verifier); err == nil {
+		t.Error("Exchange accepted a code that had already been redeemed")
+	}
+}
+
+func TestDevProviderRejectsWrongNonce(t *testing.T) {
+	ctx := context.Background()
+	_, provider := newDevServer(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "state", "the-nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	callback := signIn(t, authURL, "ada@example.com")
+
+	token, err := provider.Exchange(ctx, callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := provider.VerifyIDToken(ctx, token.IDToken, "another-nonce"); err == nil {
+		t.Error("VerifyIDToken accepted a token issued for another nonce")
+	}
+}
+
+func TestDevProviderRejectsWrongCodeVerifier(t *testing.T) {
+	ctx := context.Background()
+	_, provider := newDevServer(t)
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	callback := signIn(t, authURL, "ada@example.com")
+
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+	if _, err := provider.Exchange(ctx, callback.Get("code"), otherVerifier); err == nil {
+		t.Error("Exchange accepted a code verifier that doesn't match the challenge")
+	}
+}
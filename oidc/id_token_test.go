@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// testIssuer is a provider that publishes one signing key and signs whatever claims it is given
+type testIssuer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	provider *Provider
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	issuer := &testIssuer{key: key}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			writeJSON(w, http.StatusOK, Discovery{
+				Issuer:                issuer.server.URL,
+				AuthorizationEndpoint: issuer.server.URL + "/authorize",
+				TokenEndpoint:         issuer.server.URL + "/token",
+				JWKSURI:               issuer.server.URL + "/jwks",
+			})
+		case "/jwks":
+			writeJSON(w, http.StatusOK, map[string][]jsonWebKey{"keys": {newJSONWebKey("key-1", &key.PublicKey)}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(issuer.server.Close)
+
+	issuer.provider = NewProvider(Config{Name: "test", IssuerURL: issuer.server.URL, ClientID: "client"})
+	return issuer
+}
+
+// claims returns valid claims for the test client, which tests then break
+func (i *testIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.server.URL,
+		"sub":            "user-1",
+		"aud":            "client",
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          "nonce",
+		"email":          "ada@example.com",
+		"email_verified": "true",
+	}
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+
+	idToken, err := issuer.provider.VerifyIDToken(ctx, issuer.sign(t, issuer.claims(), issuer.key, "key-1"), "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if idToken.Subject != "user-1" || idToken.Email != "ada@example.com" || !idToken.EmailVerified {
+		t.Errorf("VerifyIDToken() = %+v, want user-1 with a verified ada@example.com", idToken)
+	}
+
+	// The key ID can be left out when the provider has a single key
+	if _, err := issuer.provider.VerifyIDToken(ctx, issuer.sign(t, issuer.claims(), issuer.key, ""), "nonce"); err != nil {
+		t.Errorf("VerifyIDToken without a key ID: %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		key    *rsa.PrivateKey
+		nonce  string
+	}{
+		{name: "another issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://attacker.example" }},
+		{name: "another audience", modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "several audiences without this client as authorized party", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"client", "other-client"}
+			c["azp"] = "other-client"
+		}},
+		{name: "expired beyond the clock skew", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(10 * time.Minute).Unix() }},
+		{name: "no subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "another nonce", nonce: "another-nonce"},
+		{name: "no nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "signed with another key", key: otherKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			key := issuer.key
+			if tt.key != nil {
+				key = tt.key
+			}
+			nonce := "nonce"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			if _, err := issuer.provider.VerifyIDToken(ctx, issuer.sign(t, claims, key, "key-1"), nonce); err == nil {
+				t.Error("VerifyIDToken accepted the token")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsOtherAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+
+	// A token signed with HMAC using the public key as the secret must not pass as RS256
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, issuer.claims())
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(issuer.key.PublicKey.N.Bytes())
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	if _, err := issuer.provider.VerifyIDToken(ctx, signed, "nonce"); err == nil {
+		t.Error("VerifyIDToken accepted an HS256 token")
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, issuer.claims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("encoding token: %v", err)
+	}
+	if _, err := issuer.provider.VerifyIDToken(ctx, unsigned, "nonce"); err == nil {
+		t.Error("VerifyIDToken accepted an unsigned token")
+	}
+}
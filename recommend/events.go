@@ -0,0 +1,158 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"event-connect/geo"
+	"event-connect/models"
+)
+
+// Weights of the event score components for users who have registered for or entered events before
+const (
+	similarUsersWeight   = 0.4
+	eventInterestsWeight = 0.25
+	venueDistanceWeight  = 0.15
+	popularityWeight     = 0.2
+)
+
+// Weights of the event score components for users without any history to compare
+const (
+	coldStartInterestsWeight  = 0.4
+	coldStartDistanceWeight   = 0.25
+	coldStartPopularityWeight = 0.35
+)
+
+// Event is an upcoming event that may be recommended
+type Event struct {
+	ID          uint
+	Name        string
+	Description string
+	Latitude    float64
+	Longitude   float64
+	HasVenue    bool
+	// Details is returned with the recommendation as it is
+	Details interface{}
+}
+
+// EventCandidate is an event with how other users engaged with it. An engagement is a registration
+// for the event or an entry into its raffle.
+type EventCandidate struct {
+	Event Event
+	// SimilarUsers is how many users who engaged with the same events as the seeker engaged with this one
+	SimilarUsers int
+	// NearbyUsers is how many users living near the seeker engaged with this one
+	NearbyUsers int
+}
+
+// EventRecommendation is a scored event
+type EventRecommendation struct {
+	Event   interface{} `json:"event"`
+	Score   float64     `json:"score"`
+	Reasons []Reason    `json:"reasons"`
+}
+
+// Events scores upcoming events for the seeker and returns them best first. An event's score is made up of:
+//
+//   - similar users (40%): how many people who engaged with the same events as the seeker engaged
+//     with this one, relative to the best candidate
+//   - interests (25%): the share of the seeker's interests mentioned in the event's name or description
+//   - distance (15%): falling linearly from 1 at the seeker's location to 0 at radiusKm from the venue
+//   - popularity (20%): how many people living near the seeker engaged with it, relative to the
+//     most popular candidate
+//
+// Seekers without any history of their own can't be compared with other users, so their scores are
+// made up of interests (40%), distance (25%) and popularity (35%) instead.
+func Events(seeker *models.User, candidates []EventCandidate, hasHistory bool, radiusKm float64) []EventRecommendation {
+	interestsShare, distanceShare, popularShare := eventInterestsWeight, venueDistanceWeight, popularityWeight
+	if !hasHistory {
+		interestsShare, distanceShare, popularShare = coldStartInterestsWeight, coldStartDistanceWeight, coldStartPopularityWeight
+	}
+	if radiusKm <= 0 {
+		radiusKm = DefaultRadiusKm
+	}
+	seekerInterests := ParseInterests(seeker.Interests)
+
+	maxSimilar, maxNearby := 0, 0
+	for _, candidate := range candidates {
+		if candidate.SimilarUsers > maxSimilar {
+			maxSimilar = candidate.SimilarUsers
+		}
+		if candidate.NearbyUsers > maxNearby {
+			maxNearby = candidate.NearbyUsers
+		}
+	}
+
+	recommendations := []EventRecommendation{}
+	for _, candidate := range candidates {
+		var score float64
+		reasons := []Reason{}
+
+		if hasHistory && candidate.SimilarUsers > 0 {
+			score += similarUsersWeight * float64(candidate.SimilarUsers) / float64(maxSimilar)
+			reasons = append(reasons, Reason{Type: ReasonAlsoRegistered, Users: candidate.SimilarUsers})
+		}
+
+		if matched := mentionedInterests(seekerInterests, candidate.Event); len(matched) > 0 {
+			score += interestsShare * float64(len(matched)) / float64(len(seekerInterests))
+			reasons = append(reasons, Reason{Type: ReasonMatchesInterests, Interests: matched})
+		}
+
+		if candidate.Event.HasVenue && HasLocation(seeker) {
+			distance := geo.DistanceKm(seeker.Latitude, seeker.Longitude, candidate.Event.Latitude, candidate.Event.Longitude)
+			if distance < radiusKm {
+				score += distanceShare * (1 - distance/radiusKm)
+				reasons = append(reasons, Reason{Type: ReasonNearby, DistanceKm: math.Round(distance*10) / 10})
+			}
+		}
+
+		if candidate.NearbyUsers > 0 {
+			score += popularShare * float64(candidate.NearbyUsers) / float64(maxNearby)
+			reasons = append(reasons, Reason{Type: ReasonPopularNearby, Users: candidate.NearbyUsers})
+		}
+
+		recommendations = append(recommendations, EventRecommendation{
+			Event:   candidate.Event.Details,
+			Score:   math.Round(score*1000) / 1000,
+			Reasons: reasons,
+		})
+	}
+
+	order := make([]int, len(recommendations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if recommendations[a].Score != recommendations[b].Score {
+			return recommendations[a].Score > recommendations[b].Score
+		}
+		return candidates[a].Event.ID < candidates[b].Event.ID
+	})
+
+	sorted := make([]EventRecommendation, len(order))
+	for i, index := range order {
+		sorted[i] = recommendations[index]
+	}
+	return sorted
+}
+
+// mentionedInterests returns the interests mentioned in an event's name or description
+func mentionedInterests(interests []string, event Event) []string {
+	text := " " + strings.Join(strings.FieldsFunc(strings.ToLower(event.Name+" "+event.Description), isSeparator), " ") + " "
+
+	var matched []string
+	for _, interest := range interests {
+		words := strings.Join(strings.FieldsFunc(interest, isSeparator), " ")
+		if words != "" && strings.Contains(text, " "+words+" ") {
+			matched = append(matched, interest)
+		}
+	}
+	return matched
+}
+
+// isSeparator reports whether a rune separates words when matching interests against event text
+func isSeparator(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+}
@@ -0,0 +1,196 @@
+// Package recommend scores other users as people a user might want to meet, and upcoming events
+// they might want to go to.
+//
+// Each user candidate gets a score between 0 and 1 made up of:
+//
+//   - shared interests (50%): the Jaccard similarity of the two users' comma-separated interests
+//   - distance (30%): falling linearly from 1 at the user's location to 0 at the search radius, using
+//     the distance rounded up to 5 km
+//   - shared events (20%): the number of events both users registered for, up to three
+//
+// How events are scored is described on Events. Every component that contributes to a score is
+// returned as a reason.
+package recommend
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"event-connect/geo"
+	"event-connect/models"
+)
+
+// Weights of the score components
+const (
+	interestsWeight    = 0.5
+	distanceWeight     = 0.3
+	sharedEventsWeight = 0.2
+)
+
+// DefaultRadiusKm is the distance at which the distance component reaches zero for users who haven't
+// set a distance preference
+const DefaultRadiusKm = 100
+
+// maxSharedEvents is the number of shared events that earns the full shared events component
+const maxSharedEvents = 3
+
+// distanceRoundingKm is the precision distances are shown with, so that a candidate's location
+// can't be worked out from the distances reported to different users
+const distanceRoundingKm = 5
+
+// Reason types
+const (
+	ReasonSharedInterests  = "shared_interests"
+	ReasonNearby           = "nearby"
+	ReasonSharedEvents     = "shared_events"
+	ReasonMatchesInterests = "matches_interests"
+	ReasonAlsoRegistered   = "also_registered"
+	ReasonPopularNearby    = "popular_nearby"
+)
+
+// Filters narrow down the candidates. Zero values don't filter.
+type Filters struct {
+	MinAge        int
+	MaxAge        int
+	MaxDistanceKm float64
+	Gender        string
+	Interest      string
+	EventID       uint
+}
+
+// Candidate is another user who may be recommended, with what is known about them relative to the seeker
+type Candidate struct {
+	User         models.User
+	Privacy      models.ProfilePrivacy
+	SharedEvents int
+}
+
+// Reason explains a component of a recommendation's score
+type Reason struct {
+	Type       string   `json:"type"`
+	Interests  []string `json:"interests,omitempty"`
+	DistanceKm float64  `json:"distanceKm,omitempty"`
+	Events     int      `json:"events,omitempty"`
+	Users      int      `json:"users,omitempty"`
+}
+
+// Recommendation is a scored candidate as shown to the seeker
+type Recommendation struct {
+	User    models.PublicProfile `json:"user"`
+	Score   float64              `json:"score"`
+	Reasons []Reason             `json:"reasons"`
+}
+
+// Users scores the candidates for the seeker and returns them best first. Candidates further away
+// than filters.MaxDistanceKm, both rounded up to the reporting precision, or without
+// filters.Interest, are left out.
+func Users(seeker *models.User, candidates []Candidate, filters Filters) []Recommendation {
+	seekerInterests := ParseInterests(seeker.Interests)
+	radiusKm := filters.MaxDistanceKm
+	if radiusKm <= 0 {
+		radiusKm = DefaultRadiusKm
+	}
+	interest := strings.ToLower(strings.TrimSpace(filters.Interest))
+
+	recommendations := []Recommendation{}
+	for i := range candidates {
+		candidate := &candidates[i]
+		candidateInterests := ParseInterests(candidate.User.Interests)
+		if interest != "" && !contains(candidateInterests, interest) {
+			continue
+		}
+
+		var score float64
+		reasons := []Reason{}
+
+		shared, union := overlap(seekerInterests, candidateInterests)
+		if len(shared) > 0 {
+			score += interestsWeight * float64(len(shared)) / float64(union)
+			reasons = append(reasons, Reason{Type: ReasonSharedInterests, Interests: shared})
+		}
+
+		// Candidates are never teammates, so users who don't make their location public are only
+		// matched when distance doesn't matter
+		locatable := HasLocation(seeker) && HasLocation(&candidate.User) && candidate.Privacy.Location == models.VisibilityPublic
+		if filters.MaxDistanceKm > 0 && HasLocation(seeker) && !locatable {
+			continue
+		}
+		if locatable {
+			// Only the rounded distance is used, for the filter and the score as well as the reason,
+			// so that none of them give away more than the distance shown
+			distance := roundDistance(geo.DistanceKm(seeker.Latitude, seeker.Longitude, candidate.User.Latitude, candidate.User.Longitude))
+			if filters.MaxDistanceKm > 0 && distance > roundDistance(filters.MaxDistanceKm) {
+				continue
+			}
+			if distance < radiusKm {
+				score += distanceWeight * (1 - distance/radiusKm)
+				reasons = append(reasons, Reason{Type: ReasonNearby, DistanceKm: distance})
+			}
+		}
+
+		if candidate.SharedEvents > 0 {
+			score += sharedEventsWeight * math.Min(float64(candidate.SharedEvents), maxSharedEvents) / maxSharedEvents
+			reasons = append(reasons, Reason{Type: ReasonSharedEvents, Events: candidate.SharedEvents})
+		}
+
+		recommendations = append(recommendations, Recommendation{
+			User:    models.NewPublicProfile(&candidate.User, candidate.Privacy, models.ViewerOther),
+			Score:   math.Round(score*1000) / 1000,
+			Reasons: reasons,
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].User.ID < recommendations[j].User.ID
+	})
+	return recommendations
+}
+
+// HasLocation reports whether a user has coordinates. Users created before locations were
+// geocoded may have none, stored as zero or NULL.
+func HasLocation(user *models.User) bool {
+	return user.Latitude != 0 || user.Longitude != 0
+}
+
+// ParseInterests splits comma-separated interests into a lowercased list without duplicates
+func ParseInterests(interests string) []string {
+	var parsed []string
+	seen := make(map[string]bool)
+	for _, interest := range strings.Split(interests, ",") {
+		interest = strings.ToLower(strings.Join(strings.Fields(interest), " "))
+		if interest == "" || seen[interest] {
+			continue
+		}
+		seen[interest] = true
+		parsed = append(parsed, interest)
+	}
+	return parsed
+}
+
+// overlap returns the interests in both lists, in the order of b, and the size of their union
+func overlap(a, b []string) (shared []string, union int) {
+	for _, interest := range b {
+		if contains(a, interest) {
+			shared = append(shared, interest)
+		}
+	}
+	return shared, len(a) + len(b) - len(shared)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// roundDistance rounds a distance up to the reporting precision
+func roundDistance(distanceKm float64) float64 {
+	return math.Max(1, math.Ceil(distanceKm/distanceRoundingKm)) * distanceRoundingKm
+}
@@ -0,0 +1,157 @@
+package recommend
+
+import (
+	"reflect"
+	"testing"
+
+	"event-connect/models"
+)
+
+// kmPerDegree converts kilometers north to degrees of latitude, close enough for the tests
+const kmPerDegree = 111.2
+
+func publicPrivacy() models.ProfilePrivacy {
+	privacy := models.DefaultProfilePrivacy()
+	privacy.Location = models.VisibilityPublic
+	return privacy
+}
+
+// candidate returns a candidate kmNorth kilometers north of the test seeker
+func candidate(id uint, kmNorth float64, interests string, privacy models.ProfilePrivacy) Candidate {
+	return Candidate{
+		User:    models.User{ID: id, Interests: interests, Latitude: 51.5 + kmNorth/kmPerDegree, Longitude: -0.1},
+		Privacy: privacy,
+	}
+}
+
+func recommendedIDs(recommendations []Recommendation) []uint {
+	ids := []uint{}
+	for _, recommendation := range recommendations {
+		ids = append(ids, recommendation.User.ID)
+	}
+	return ids
+}
+
+func TestUsersFilters(t *testing.T) {
+	seeker := &models.User{ID: 1, Interests: "techno, hiking", Latitude: 51.5, Longitude: -0.1}
+	teammatesOnly := models.DefaultProfilePrivacy()
+	private := publicPrivacy()
+	private.Location = models.VisibilityPrivate
+
+	candidates := []Candidate{
+		candidate(2, 3, "techno", publicPrivacy()),
+		candidate(3, 12, "techno", publicPrivacy()),
+		candidate(4, 3, "techno", teammatesOnly),
+		candidate(5, 3, "techno", private),
+		candidate(6, 3, "jazz", publicPrivacy()),
+	}
+
+	tests := []struct {
+		name    string
+		filters Filters
+		want    []uint
+	}{
+		{
+			// Users without a public location still come up when distance doesn't matter, below
+			// those nearby
+			name: "no filters",
+			want: []uint{2, 3, 6, 4, 5},
+		},
+		{
+			// 12km rounds up to 15km, which 11km also rounds up to but 10km doesn't
+			name:    "distance limit compared after rounding",
+			filters: Filters{MaxDistanceKm: 11},
+			want:    []uint{2, 3, 6},
+		},
+		{
+			name:    "distance limit excludes further rounded distances",
+			filters: Filters{MaxDistanceKm: 10},
+			want:    []uint{2, 6},
+		},
+		{
+			name:    "interest",
+			filters: Filters{Interest: " Techno "},
+			want:    []uint{2, 3, 4, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recommendedIDs(Users(seeker, candidates, tt.filters))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Users() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsersReasonsOnlyShowRoundedPublicDistances(t *testing.T) {
+	seeker := &models.User{ID: 1, Latitude: 51.5, Longitude: -0.1}
+	candidates := []Candidate{
+		candidate(2, 12, "", publicPrivacy()),
+		candidate(3, 12, "", models.DefaultProfilePrivacy()),
+	}
+
+	recommendations := Users(seeker, candidates, Filters{})
+	if len(recommendations) != 2 {
+		t.Fatalf("Users() returned %d recommendations, want 2", len(recommendations))
+	}
+
+	public := recommendations[0]
+	wantReasons := []Reason{{Type: ReasonNearby, DistanceKm: 15}}
+	if public.User.ID != 2 || !reflect.DeepEqual(public.Reasons, wantReasons) {
+		t.Errorf("Users()[0] = user %d with %+v, want user 2 with %+v", public.User.ID, public.Reasons, wantReasons)
+	}
+	// The score is worked out from the rounded distance too
+	if want := 0.255; public.Score != want {
+		t.Errorf("Users()[0].Score = %v, want %v", public.Score, want)
+	}
+
+	hidden := recommendations[1]
+	if hidden.Score != 0 || len(hidden.Reasons) != 0 {
+		t.Errorf("Users()[1] = score %v with %+v, want nothing given away by the hidden location", hidden.Score, hidden.Reasons)
+	}
+}
+
+func TestUsersOrder(t *testing.T) {
+	seeker := &models.User{ID: 1, Interests: "techno, hiking, jazz"}
+	candidates := []Candidate{
+		{User: models.User{ID: 4, Interests: "techno"}},
+		{User: models.User{ID: 2, Interests: "techno, hiking, jazz"}},
+		{User: models.User{ID: 5}, SharedEvents: 5},
+		{User: models.User{ID: 3, Interests: "techno"}},
+	}
+
+	// Full interest overlap (0.5), then all shared events (0.2), then a third of the interests
+	// (0.167), ties broken by ID
+	got := recommendedIDs(Users(seeker, candidates, Filters{}))
+	if want := []uint{2, 5, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Users() = %v, want %v", got, want)
+	}
+}
+
+func TestParseInterests(t *testing.T) {
+	got := ParseInterests(" Techno,  Deep   House ,techno,,hiking ")
+	if want := []string{"techno", "deep house", "hiking"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseInterests() = %v, want %v", got, want)
+	}
+}
+
+func TestRoundDistance(t *testing.T) {
+	tests := []struct {
+		distance, want float64
+	}{
+		{0, 5},
+		{0.3, 5},
+		{5, 5},
+		{5.01, 10},
+		{12, 15},
+		{99.9, 100},
+	}
+
+	for _, tt := range tests {
+		if got := roundDistance(tt.distance); got != tt.want {
+			t.Errorf("roundDistance(%v) = %v, want %v", tt.distance, got, tt.want)
+		}
+	}
+}
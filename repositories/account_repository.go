@@ -0,0 +1,365 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** AccountRepository ***************************
+
+// AccountRepository represents the repository for exporting and deleting everything held about a user
+type AccountRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewAccountRepository creates a new instance of AccountRepository
+func NewAccountRepository(db *sql.DB, logger *logrus.Logger) *AccountRepository {
+	return &AccountRepository{db: db, logger: logger}
+}
+
+// exportSections are the queries that collect a user's data for an export, in the order they are
+// exported. Each returns a single JSON value for user $1. Password hashes, token hashes and
+// two-factor secrets are never exported.
+var exportSections = []struct {
+	name  string
+	query string
+}{
+	{"profile", `
+        SELECT to_jsonb(u) - 'password' - 'deleted_at'
+        FROM users u WHERE u.id = $1`},
+	{"privacy", `
+        SELECT COALESCE((SELECT to_jsonb(p) - 'user_id' FROM profile_privacy p WHERE p.user_id = $1), 'null'::jsonb)`},
+	{"roles", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('role', role, 'granted_at', granted_at) ORDER BY granted_at), '[]'::jsonb)
+        FROM user_roles WHERE user_id = $1`},
+	{"organised_events", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('event_id', event_id, 'created_at', created_at) ORDER BY created_at), '[]'::jsonb)
+        FROM event_organisers WHERE user_id = $1`},
+	{"activities", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('event_id', event_id, 'activity_type', activity_type, 'timestamp', timestamp) ORDER BY timestamp), '[]'::jsonb)
+        FROM activities WHERE user_id = $1`},
+	{"comments", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('id', id, 'event_id', event_id, 'text', text, 'parent_id', parent_id, 'created_at', created_at) ORDER BY created_at), '[]'::jsonb)
+        FROM comments WHERE user_id = $1`},
+	{"raffle_entries", `
+        SELECT COALESCE(jsonb_agg(to_jsonb(e) - 'user_id' ORDER BY e.created_at), '[]'::jsonb)
+        FROM raffle_entries e WHERE e.user_id = $1`},
+	{"raffle_entry_history", `
+        SELECT COALESCE(jsonb_agg(to_jsonb(h) - 'user_id' ORDER BY h.created_at), '[]'::jsonb)
+        FROM raffle_entry_history h WHERE h.user_id = $1`},
+	{"teams", `
+        SELECT COALESCE(jsonb_agg(to_jsonb(t) - 'user_id' ORDER BY t.created_at), '[]'::jsonb)
+        FROM teams t WHERE t.user_id = $1`},
+	{"friendships", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object(
+            'user_id', CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END,
+            'username', u.username,
+            'sent_by_me', f.requester_id = $1,
+            'status', f.status,
+            'created_at', f.created_at,
+            'accepted_at', f.accepted_at
+        ) ORDER BY f.created_at), '[]'::jsonb)
+        FROM friendships f
+        JOIN users u ON u.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+        WHERE f.requester_id = $1 OR f.addressee_id = $1`},
+	{"blocked_users", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('user_id', b.blocked_id, 'username', u.username, 'created_at', b.created_at) ORDER BY b.created_at), '[]'::jsonb)
+        FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+        WHERE b.blocker_id = $1`},
+	{"reports_filed", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('reported_id', reported_id, 'reason', reason, 'details', details, 'status', status, 'created_at', created_at) ORDER BY created_at), '[]'::jsonb)
+        FROM user_reports WHERE reporter_id = $1`},
+	{"notifications", `
+        SELECT COALESCE(jsonb_agg(to_jsonb(n) - 'user_id' ORDER BY n.created_at), '[]'::jsonb)
+        FROM notifications n WHERE n.user_id = $1`},
+	{"notification_preferences", `
+        SELECT COALESCE(jsonb_agg(to_jsonb(p) - 'user_id' ORDER BY p.type), '[]'::jsonb)
+        FROM notification_preferences p WHERE p.user_id = $1`},
+	{"event_reminders", `
+        SELECT COALESCE(jsonb_agg(to_jsonb(er) - 'user_id' ORDER BY er.sent_at), '[]'::jsonb)
+        FROM event_reminders er WHERE er.user_id = $1`},
+	{"sessions", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('created_at', created_at, 'revoked_at', revoked_at) ORDER BY created_at), '[]'::jsonb)
+        FROM token_families WHERE user_id = $1`},
+	{"login_attempts", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('ip_address', ip_address, 'user_agent', user_agent, 'success', success, 'reason', reason, 'created_at', created_at) ORDER BY created_at), '[]'::jsonb)
+        FROM login_attempts WHERE user_id = $1`},
+	{"linked_identities", `
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('provider', provider, 'subject', subject, 'email', email, 'created_at', created_at, 'last_login_at', last_login_at) ORDER BY created_at), '[]'::jsonb)
+        FROM user_identities WHERE user_id = $1`},
+	{"two_factor", `
+        SELECT COALESCE((SELECT jsonb_build_object('enabled_at', enabled_at, 'created_at', created_at) FROM user_totp WHERE user_id = $1), 'null'::jsonb)`},
+}
+
+// purgeStatements delete or detach every row that refers to user $1, in an order that respects the
+// foreign keys, finishing with the user. Raffle draw records only hold user IDs and are kept so that
+// past draws can still be verified.
+var purgeStatements = []string{
+	"DELETE FROM refresh_tokens WHERE user_id = $1",
+	"DELETE FROM token_families WHERE user_id = $1",
+	"DELETE FROM user_tokens WHERE user_id = $1",
+	"DELETE FROM user_recovery_codes WHERE user_id = $1",
+	"DELETE FROM user_totp WHERE user_id = $1",
+	"DELETE FROM user_identities WHERE user_id = $1",
+	"DELETE FROM profile_privacy WHERE user_id = $1",
+	"DELETE FROM user_roles WHERE user_id = $1",
+	"DELETE FROM event_organisers WHERE user_id = $1",
+	"DELETE FROM notifications WHERE user_id = $1",
+	"DELETE FROM notification_preferences WHERE user_id = $1",
+	"DELETE FROM event_reminders WHERE user_id = $1",
+	"DELETE FROM activities WHERE user_id = $1",
+	"DELETE FROM raffle_entry_history WHERE user_id = $1",
+	"UPDATE raffle_entries SET team_with_user_id = NULL WHERE team_with_user_id = $1",
+	"DELETE FROM raffle_entries WHERE user_id = $1",
+	"DELETE FROM teams WHERE user_id = $1",
+	"DELETE FROM friendships WHERE requester_id = $1 OR addressee_id = $1",
+	"DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1",
+	"UPDATE user_reports SET resolved_by = NULL WHERE resolved_by = $1",
+	"DELETE FROM user_reports WHERE reporter_id = $1 OR reported_id = $1",
+	"DELETE FROM login_attempts WHERE user_id = $1 OR username = (SELECT username FROM users WHERE id = $1)",
+	"UPDATE comments SET user_id = NULL WHERE user_id = $1",
+	"DELETE FROM users WHERE id = $1",
+}
+
+// *************************** Repository Methods ***************************
+
+// ExportData collects everything held about a user, as JSON sections in a stable order
+func (r *AccountRepository) ExportData(userID uint) ([]models.ExportSection, error) {
+	sections := make([]models.ExportSection, 0, len(exportSections))
+	for _, section := range exportSections {
+		var data []byte
+		if err := r.db.QueryRow(section.query, userID).Scan(&data); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID":  userID,
+				"section": section.name,
+				"method":  "ExportData",
+			}).Error("Error exporting user data", err)
+			return nil, err
+		}
+		sections = append(sections, models.ExportSection{Name: section.name, Data: json.RawMessage(data)})
+	}
+	return sections, nil
+}
+
+// DeleteAccount starts the deletion of a user's account. The account can no longer be used, its
+// sessions are revoked, its comments are anonymised, places it won in raffles go to the next entrant
+// on the waitlist and its raffle entries, team memberships, friendships and blocks are removed. The
+// rest of its data is kept until PurgeAccount. It returns the teams the user left and the entrants
+// promoted to their places, so that they can be told.
+func (r *AccountRepository) DeleteAccount(userID uint) ([]models.TeamMembership, []models.RafflePromotion, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "DeleteAccount",
+		}).Error("Error beginning transaction", err)
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", now, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "DeleteAccount",
+		}).Error("Error marking account as deleted", err)
+		return nil, nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, nil, ErrAccountNotFound
+	}
+
+	// Places won in a raffle go to the next person on the waitlist before the entries are removed
+	heldPlaces, err := heldRafflePlaces(tx, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "DeleteAccount",
+		}).Error("Error fetching raffle places", err)
+		return nil, nil, err
+	}
+	var promotions []models.RafflePromotion
+	for _, eventID := range heldPlaces {
+		promoted, err := declinePlace(tx, r.logger, eventID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if promoted != nil {
+			promotions = append(promotions, models.RafflePromotion{EventID: eventID, UserID: *promoted})
+		}
+	}
+
+	memberships, err := teamMemberships(tx, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "DeleteAccount",
+		}).Error("Error fetching team memberships", err)
+		return nil, nil, err
+	}
+
+	statements := []string{
+		"UPDATE comments SET user_id = NULL WHERE user_id = $1",
+		"UPDATE raffle_entries SET team_with_user_id = NULL WHERE team_with_user_id = $1",
+		"DELETE FROM raffle_entries WHERE user_id = $1",
+		"DELETE FROM teams WHERE user_id = $1",
+		"DELETE FROM friendships WHERE requester_id = $1 OR addressee_id = $1",
+		"DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "DeleteAccount",
+			}).Error("Error removing account data", err)
+			return nil, nil, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE token_families SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", now, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "DeleteAccount",
+		}).Error("Error revoking sessions", err)
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return memberships, promotions, nil
+}
+
+// heldRafflePlaces retrieves the events where a user holds a place won in a raffle
+func heldRafflePlaces(tx *sql.Tx, userID uint) ([]uint, error) {
+	rows, err := tx.Query("SELECT event_id::integer FROM raffle_entries WHERE user_id = $1 AND status = $2 FOR UPDATE", userID, models.RaffleEntryWon)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var eventIDs []uint
+	for rows.Next() {
+		var eventID uint
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, err
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	return eventIDs, rows.Err()
+}
+
+// teamMemberships retrieves the teams a user belongs to and the other members of each
+func teamMemberships(tx *sql.Tx, userID uint) ([]models.TeamMembership, error) {
+	rows, err := tx.Query(`
+        SELECT COALESCE(mine.event_id, 0), mine.team_id, theirs.user_id
+        FROM teams mine
+        JOIN teams theirs ON theirs.team_id = mine.team_id AND theirs.user_id <> mine.user_id
+        WHERE mine.user_id = $1
+        ORDER BY mine.team_id, theirs.user_id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []models.TeamMembership
+	for rows.Next() {
+		var eventID, teammateID uint
+		var teamID string
+		if err := rows.Scan(&eventID, &teamID, &teammateID); err != nil {
+			return nil, err
+		}
+		if len(memberships) == 0 || memberships[len(memberships)-1].TeamID != teamID {
+			memberships = append(memberships, models.TeamMembership{EventID: eventID, TeamID: teamID})
+		}
+		last := &memberships[len(memberships)-1]
+		last.Teammates = append(last.Teammates, teammateID)
+	}
+	return memberships, rows.Err()
+}
+
+// RestoreAccount cancels the deletion of an account that hasn't been purged yet. Raffle entries and
+// team memberships removed on deletion are not restored.
+func (r *AccountRepository) RestoreAccount(userID uint) error {
+	result, err := r.db.Exec("UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "RestoreAccount",
+		}).Error("Error restoring account", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// GetAccountsDueForPurge retrieves the accounts deleted before a time
+func (r *AccountRepository) GetAccountsDueForPurge(deletedBefore time.Time) ([]uint, error) {
+	rows, err := r.db.Query("SELECT id FROM users WHERE deleted_at < $1", deletedBefore)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "GetAccountsDueForPurge",
+		}).Error("Error fetching deleted accounts", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []uint
+	for rows.Next() {
+		var userID uint
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// PurgeAccount permanently deletes a deleted account and all the personal data held about it.
+// Anonymised comments are kept.
+func (r *AccountRepository) PurgeAccount(userID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "PurgeAccount",
+		}).Error("Error beginning transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only accounts that are still deleted are purged, in case the deletion was cancelled meanwhile
+	var deleted bool
+	if err := tx.QueryRow("SELECT deleted_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&deleted); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAccountNotFound
+		}
+		return err
+	}
+	if !deleted {
+		return ErrAccountNotFound
+	}
+
+	for _, statement := range purgeStatements {
+		if _, err := tx.Exec(statement, userID); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID":    userID,
+				"statement": statement,
+				"method":    "PurgeAccount",
+			}).Error("Error purging account data", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -3,7 +3,6 @@ package repositories
 import (
 	"database/sql"
 	"event-connect/models"
-	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -46,7 +45,7 @@ func (r *ActivityRepository) CreateActivity(activity *models.Activity) error {
 			"method":       "CreateActivity",
 			"activityType": activity.ActivityType,
 		}).Warn("Activity already exists for user and event")
-		return fmt.Errorf("activity already exists")
+		return ErrActivityExists
 	}
 
 	// Insert the new activity record
@@ -118,14 +117,25 @@ func (r *ActivityRepository) GetUserActivities(userID uint) ([]map[string]interf
 	return activities, nil
 }
 
-// GetUserLocationsForEvent retrieves the user locations for a specific event from the database
-func (r *ActivityRepository) GetUserLocationsForEvent(eventID string) ([]map[string]interface{}, error) {
+// GetUserLocationsForEvent retrieves the exact home locations of users registered for an event, with
+// who they allow to see their location and whether they are a teammate of the viewer. They must be
+// fuzzed before being shown to other users.
+func (r *ActivityRepository) GetUserLocationsForEvent(eventID, viewerID uint) ([]models.UserLocation, error) {
 	rows, err := r.db.Query(`
-        SELECT u.id, u.latitude, u.longitude
+        SELECT DISTINCT u.id, u.latitude, u.longitude, COALESCE(p.location, $2),
+               EXISTS (
+                   SELECT 1
+                   FROM teams mine
+                   JOIN teams theirs ON mine.team_id = theirs.team_id
+                   WHERE mine.user_id = $3 AND theirs.user_id = u.id
+               )
         FROM activities a
         JOIN users u ON a.user_id = u.id
+        LEFT JOIN profile_privacy p ON p.user_id = u.id
         WHERE a.event_id = $1 AND a.activity_type = 'event_registered'
-    `, eventID)
+          AND u.latitude IS NOT NULL AND u.longitude IS NOT NULL
+          AND u.deleted_at IS NULL AND u.suspended_at IS NULL
+    `, eventID, models.DefaultProfilePrivacy().Location, viewerID)
 	if err != nil {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": eventID,
@@ -135,11 +145,10 @@ func (r *ActivityRepository) GetUserLocationsForEvent(eventID string) ([]map[str
 	}
 	defer rows.Close()
 
-	var userLocations []map[string]interface{}
+	var userLocations []models.UserLocation
 	for rows.Next() {
-		var id uint
-		var latitude, longitude float64
-		err := rows.Scan(&id, &latitude, &longitude)
+		var location models.UserLocation
+		err := rows.Scan(&location.UserID, &location.Latitude, &location.Longitude, &location.LocationVisibility, &location.IsTeammate)
 		if err != nil {
 			r.logger.WithFields(logrus.Fields{
 				"eventID": eventID,
@@ -147,17 +156,145 @@ func (r *ActivityRepository) GetUserLocationsForEvent(eventID string) ([]map[str
 			}).Error("Error scanning user location", err)
 			return nil, err
 		}
-		userLocations = append(userLocations, map[string]interface{}{
-			"id":        id,
-			"latitude":  latitude,
-			"longitude": longitude,
-		})
+		userLocations = append(userLocations, location)
 	}
 
-	r.logger.WithFields(logrus.Fields{
-		"eventID":      eventID,
-		"method":       "GetUserLocationsForEvent",
-		"userLocations": userLocations,
-	}).Info("User locations for event retrieved successfully")
-	return userLocations, nil
-}
\ No newline at end of file
+	return userLocations, rows.Err()
+}
+
+// IsRegistered reports whether a user has registered for an event
+func (r *ActivityRepository) IsRegistered(userID, eventID uint) (bool, error) {
+	var registered bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM activities WHERE user_id = $1 AND event_id = $2 AND activity_type = 'event_registered')", userID, eventID).Scan(&registered)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"eventID": eventID,
+			"method":  "IsRegistered",
+		}).Error("Error checking event registration", err)
+		return false, err
+	}
+	return registered, nil
+}
+
+// *************************** Event Recommendations ***************************
+
+// engagementsQuery lists the events each user has shown interest in, by registering for them or
+// entering their raffle. Deleted and suspended accounts are left out, so that their history no
+// longer shapes what other users are shown.
+const engagementsQuery = `
+    engagements AS (
+        SELECT e.user_id, e.event_id
+        FROM (
+            SELECT user_id, event_id FROM activities WHERE activity_type = 'event_registered'
+            UNION
+            SELECT user_id, CAST(event_id AS INTEGER) FROM raffle_entries WHERE event_id ~ '^[0-9]+$'
+        ) e
+        JOIN users u ON u.id = e.user_id
+        WHERE u.deleted_at IS NULL AND u.suspended_at IS NULL
+    )`
+
+// GetEngagedEventIDs retrieves the events a user has registered for or entered the raffle of
+func (r *ActivityRepository) GetEngagedEventIDs(userID uint) (map[uint]bool, error) {
+	rows, err := r.db.Query("WITH"+engagementsQuery+" SELECT DISTINCT event_id FROM engagements WHERE user_id = $1", userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetEngagedEventIDs",
+		}).Error("Error fetching engaged events", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventIDs := make(map[uint]bool)
+	for rows.Next() {
+		var eventID uint
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, err
+		}
+		eventIDs[eventID] = true
+	}
+	return eventIDs, rows.Err()
+}
+
+// GetCoEngagedEvents retrieves the other events that users engaged with the given event also engaged
+// with, by how many of them did. Events shared by fewer than minUsers users are left out.
+func (r *ActivityRepository) GetCoEngagedEvents(eventID uint, minUsers, limit int) ([]models.EventEngagement, error) {
+	query := "WITH" + engagementsQuery + `
+        SELECT theirs.event_id, COUNT(DISTINCT theirs.user_id)
+        FROM engagements seed
+        JOIN engagements theirs ON theirs.user_id = seed.user_id AND theirs.event_id != seed.event_id
+        WHERE seed.event_id = $1
+        GROUP BY theirs.event_id
+        HAVING COUNT(DISTINCT theirs.user_id) >= $2
+        ORDER BY 2 DESC, 1
+        LIMIT $3
+    `
+	return r.queryEventEngagements("GetCoEngagedEvents", query, eventID, minUsers, limit)
+}
+
+// GetEventsEngagedBySimilarUsers retrieves the events that users who engaged with the same events as
+// a user also engaged with, by how many of them did. Events the user already engaged with, and events
+// shared by fewer than minUsers users, are left out.
+func (r *ActivityRepository) GetEventsEngagedBySimilarUsers(userID uint, minUsers, limit int) ([]models.EventEngagement, error) {
+	query := "WITH" + engagementsQuery + `,
+    mine AS (SELECT event_id FROM engagements WHERE user_id = $1)
+        SELECT theirs.event_id, COUNT(DISTINCT theirs.user_id)
+        FROM engagements seed
+        JOIN engagements theirs ON theirs.user_id = seed.user_id
+        WHERE seed.event_id IN (SELECT event_id FROM mine)
+          AND seed.user_id != $1
+          AND theirs.event_id NOT IN (SELECT event_id FROM mine)
+        GROUP BY theirs.event_id
+        HAVING COUNT(DISTINCT theirs.user_id) >= $2
+        ORDER BY 2 DESC, 1
+        LIMIT $3
+    `
+	return r.queryEventEngagements("GetEventsEngagedBySimilarUsers", query, userID, minUsers, limit)
+}
+
+// GetPopularEventsNearby retrieves the events most engaged with by users living within radiusKm of a
+// location, or by all users when radiusKm is zero. Events the given user already engaged with, and
+// events engaged with by fewer than minUsers users, are left out.
+func (r *ActivityRepository) GetPopularEventsNearby(userID uint, latitude, longitude, radiusKm float64, minUsers, limit int) ([]models.EventEngagement, error) {
+	query := "WITH" + engagementsQuery + `
+        SELECT e.event_id, COUNT(DISTINCT e.user_id)
+        FROM engagements e
+        JOIN users u ON u.id = e.user_id
+        WHERE e.user_id != $1
+          AND e.event_id NOT IN (SELECT event_id FROM engagements WHERE user_id = $1)
+          AND ($4::float8 = 0 OR (
+              u.latitude IS NOT NULL AND u.longitude IS NOT NULL AND NOT (u.latitude = 0 AND u.longitude = 0)
+              AND sqrt(power(radians(u.longitude - $3) * cos(radians((u.latitude + $2) / 2)), 2) + power(radians(u.latitude - $2), 2)) * 6371 <= $4::float8
+          ))
+        GROUP BY e.event_id
+        HAVING COUNT(DISTINCT e.user_id) >= $5
+        ORDER BY 2 DESC, 1
+        LIMIT $6
+    `
+	return r.queryEventEngagements("GetPopularEventsNearby", query, userID, latitude, longitude, radiusKm, minUsers, limit)
+}
+
+func (r *ActivityRepository) queryEventEngagements(method, query string, args ...interface{}) ([]models.EventEngagement, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": method,
+		}).Error("Error fetching event engagements", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var engagements []models.EventEngagement
+	for rows.Next() {
+		var engagement models.EventEngagement
+		if err := rows.Scan(&engagement.EventID, &engagement.Users); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"method": method,
+			}).Error("Error scanning event engagement", err)
+			return nil, err
+		}
+		engagements = append(engagements, engagement)
+	}
+	return engagements, rows.Err()
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** BlockRepository ***************************
+
+// BlockRepository represents the repository for users blocking other users
+type BlockRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewBlockRepository creates a new instance of BlockRepository
+func NewBlockRepository(db *sql.DB, logger *logrus.Logger) *BlockRepository {
+	return &BlockRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// BlockUser blocks blockedID for blockerID. Any friendship or friend request between the two is
+// removed at the same time. Blocking a user twice is a no-op.
+func (r *BlockRepository) BlockUser(blockerID, blockedID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"blockerID": blockerID,
+			"blockedID": blockedID,
+			"method":    "BlockUser",
+		}).Error("Error beginning transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO user_blocks (blocker_id, blocked_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		blockerID, blockedID, time.Now())
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"blockerID": blockerID,
+			"blockedID": blockedID,
+			"method":    "BlockUser",
+		}).Error("Error blocking user", err)
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM friendships WHERE "+friendPair, blockerID, blockedID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"blockerID": blockerID,
+			"blockedID": blockedID,
+			"method":    "BlockUser",
+		}).Error("Error removing friendship of blocked user", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnblockUser removes a block blockerID placed on blockedID
+func (r *BlockRepository) UnblockUser(blockerID, blockedID uint) error {
+	result, err := r.db.Exec("DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerID, blockedID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"blockerID": blockerID,
+			"blockedID": blockedID,
+			"method":    "UnblockUser",
+		}).Error("Error unblocking user", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// IsBlocked reports whether either of two users has blocked the other
+func (r *BlockRepository) IsBlocked(userID, otherUserID uint) (bool, error) {
+	var blocked bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM user_blocks
+            WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+        )
+    `, userID, otherUserID).Scan(&blocked)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":      userID,
+			"otherUserID": otherUserID,
+			"method":      "IsBlocked",
+		}).Error("Error checking block", err)
+		return false, err
+	}
+	return blocked, nil
+}
+
+// GetBlockedUsers retrieves the users a user has blocked, most recent first
+func (r *BlockRepository) GetBlockedUsers(userID uint) ([]models.BlockedUser, error) {
+	rows, err := r.db.Query(`
+        SELECT u.id, u.username, b.created_at
+        FROM user_blocks b
+        JOIN users u ON u.id = b.blocked_id
+        WHERE b.blocker_id = $1
+        ORDER BY b.created_at DESC
+    `, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetBlockedUsers",
+		}).Error("Error fetching blocked users", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []models.BlockedUser{}
+	for rows.Next() {
+		var user models.BlockedUser
+		if err := rows.Scan(&user.UserID, &user.Username, &user.BlockedAt); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetBlockedUsers",
+			}).Error("Error scanning blocked user", err)
+			return nil, err
+		}
+		blocked = append(blocked, user)
+	}
+	return blocked, rows.Err()
+}
@@ -12,18 +12,34 @@ func NewCommentRepository(db *sql.DB) *CommentRepository {
 	return &CommentRepository{db: db}
 }
 
-func (r *CommentRepository) CreateComment(eventID string, userID int, text string) error {
-	_, err := r.db.Exec("INSERT INTO comments (event_id, user_id, text) VALUES ($1, $2, $3)", eventID, userID, text)
-	return err
+func (r *CommentRepository) CreateComment(eventID string, userID int, text string, parentID *int) (int, error) {
+	var id int
+	err := r.db.QueryRow("INSERT INTO comments (event_id, user_id, text, parent_id) VALUES ($1, $2, $3, $4) RETURNING id", eventID, userID, text, parentID).Scan(&id)
+	return id, err
 }
 
-func (r *CommentRepository) GetComments(eventID string) ([]map[string]interface{}, error) {
+// GetCommentAuthor returns the author and event of a comment, used to validate and notify replies.
+// The author is 0 when the comment was anonymised after its author deleted their account.
+func (r *CommentRepository) GetCommentAuthor(commentID int) (userID int, eventID string, err error) {
+	err = r.db.QueryRow("SELECT COALESCE(user_id, 0), event_id FROM comments WHERE id = $1", commentID).Scan(&userID, &eventID)
+	return userID, eventID, err
+}
+
+// GetComments returns the comments on an event, leaving out those by users the viewer has blocked or
+// been blocked by. A viewerID of 0 is an anonymous viewer who sees every comment. Comments by deleted
+// accounts have no author and are shown as by a deleted user.
+func (r *CommentRepository) GetComments(eventID string, viewerID uint) ([]map[string]interface{}, error) {
 	rows, err := r.db.Query(`
-		SELECT c.id, c.user_id, u.username, c.text, c.created_at
+		SELECT c.id, COALESCE(c.user_id, 0), COALESCE(u.username, 'Deleted user'), c.text, c.parent_id, c.created_at
 		FROM comments c
-		JOIN users u ON c.user_id = u.id
+		LEFT JOIN users u ON c.user_id = u.id
 		WHERE c.event_id = $1
-	`, eventID)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $2 AND b.blocked_id = c.user_id) OR (b.blocker_id = c.user_id AND b.blocked_id = $2)
+		)
+		ORDER BY c.created_at
+	`, eventID, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -33,7 +49,8 @@ func (r *CommentRepository) GetComments(eventID string) ([]map[string]interface{
 	for rows.Next() {
 		var id, userID int
 		var username, text, createdAt string
-		if err := rows.Scan(&id, &userID, &username, &text, &createdAt); err != nil {
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &userID, &username, &text, &parentID, &createdAt); err != nil {
 			return nil, err
 		}
 		comment := map[string]interface{}{
@@ -41,8 +58,12 @@ func (r *CommentRepository) GetComments(eventID string) ([]map[string]interface{
 			"userId":    userID,
 			"username":  username,
 			"text":      text,
+			"parentId":  nil,
 			"createdAt": createdAt,
 		}
+		if parentID.Valid {
+			comment["parentId"] = parentID.Int64
+		}
 		comments = append(comments, comment)
 	}
 
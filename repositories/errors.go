@@ -0,0 +1,46 @@
+package repositories
+
+import "errors"
+
+// Errors returned by the repositories for outcomes that handlers respond to, to be matched with errors.Is
+var (
+	// Users and accounts
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrEmailChanged       = errors.New("email changed")
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrRoleNotRevocable   = errors.New("role cannot be revoked")
+
+	// Tokens and sign in
+	ErrInvalidToken            = errors.New("invalid token")
+	ErrInvalidRefreshToken     = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired     = errors.New("refresh token expired")
+	ErrRefreshTokenReused      = errors.New("refresh token reused")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrIdentityNotFound        = errors.New("identity not found")
+	ErrInvalidLoginState       = errors.New("invalid state")
+
+	// Raffles
+	ErrRaffleClosed         = errors.New("raffle closed")
+	ErrDuplicateRaffleEntry = errors.New("duplicate raffle entry")
+	ErrEmailDomainTaken     = errors.New("email domain taken")
+	ErrRaffleAlreadyDrawn   = errors.New("raffle already drawn")
+	ErrRaffleEntryNotFound  = errors.New("raffle entry not found")
+	ErrRaffleEntryLocked    = errors.New("raffle entry locked")
+	ErrNoPlaceToDecline     = errors.New("no place to decline")
+
+	// Activities, notifications and friends
+	ErrActivityExists           = errors.New("activity already exists")
+	ErrNotificationNotFound     = errors.New("notification not found")
+	ErrAlreadyFriends           = errors.New("already friends")
+	ErrFriendRequestAlreadySent = errors.New("friend request already sent")
+	ErrFriendRequestNotFound    = errors.New("friend request not found")
+	ErrFriendNotFound           = errors.New("friend not found")
+
+	// Moderation
+	ErrBlockNotFound         = errors.New("block not found")
+	ErrReportAlreadyOpen     = errors.New("report already open")
+	ErrReportNotFound        = errors.New("report not found")
+	ErrReportAlreadyResolved = errors.New("report already resolved")
+)
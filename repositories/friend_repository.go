@@ -0,0 +1,235 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** FriendRepository ***************************
+
+// FriendRepository represents the repository for friendships between users
+type FriendRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewFriendRepository creates a new instance of FriendRepository
+func NewFriendRepository(db *sql.DB, logger *logrus.Logger) *FriendRepository {
+	return &FriendRepository{db: db, logger: logger}
+}
+
+// friendPair matches the friendship row between users $1 and $2, whichever of them sent the request
+const friendPair = `((requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1))`
+
+// *************************** Repository Methods ***************************
+
+// SendFriendRequest asks addresseeID to become requesterID's friend. When addresseeID has already
+// asked requesterID, their request is accepted instead and accepted is true.
+func (r *FriendRepository) SendFriendRequest(requesterID, addresseeID uint) (accepted bool, err error) {
+	var existingRequester uint
+	var status string
+	err = r.db.QueryRow("SELECT requester_id, status FROM friendships WHERE "+friendPair, requesterID, addresseeID).Scan(&existingRequester, &status)
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := r.db.Exec("INSERT INTO friendships (requester_id, addressee_id, status, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+			requesterID, addresseeID, models.FriendshipPending, time.Now())
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"requesterID": requesterID,
+				"addresseeID": addresseeID,
+				"method":      "SendFriendRequest",
+			}).Error("Error creating friend request", err)
+			return false, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			// The other user sent a request at the same moment, so handle theirs as one sent earlier
+			return r.SendFriendRequest(requesterID, addresseeID)
+		}
+		return false, nil
+	case err != nil:
+		r.logger.WithFields(logrus.Fields{
+			"requesterID": requesterID,
+			"addresseeID": addresseeID,
+			"method":      "SendFriendRequest",
+		}).Error("Error retrieving friendship", err)
+		return false, err
+	case status == models.FriendshipAccepted:
+		return false, ErrAlreadyFriends
+	case existingRequester == requesterID:
+		return false, ErrFriendRequestAlreadySent
+	}
+
+	if err := r.AcceptFriendRequest(requesterID, addresseeID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AcceptFriendRequest accepts the pending friend request requesterID sent to userID
+func (r *FriendRepository) AcceptFriendRequest(userID, requesterID uint) error {
+	result, err := r.db.Exec("UPDATE friendships SET status = $1, accepted_at = $2 WHERE requester_id = $3 AND addressee_id = $4 AND status = $5",
+		models.FriendshipAccepted, time.Now(), requesterID, userID, models.FriendshipPending)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":      userID,
+			"requesterID": requesterID,
+			"method":      "AcceptFriendRequest",
+		}).Error("Error accepting friend request", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrFriendRequestNotFound
+	}
+	return nil
+}
+
+// DeclineFriendRequest deletes the pending friend request requesterID sent to userID. The requester
+// isn't told, and can ask again.
+func (r *FriendRepository) DeclineFriendRequest(userID, requesterID uint) error {
+	result, err := r.db.Exec("DELETE FROM friendships WHERE requester_id = $1 AND addressee_id = $2 AND status = $3",
+		requesterID, userID, models.FriendshipPending)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":      userID,
+			"requesterID": requesterID,
+			"method":      "DeclineFriendRequest",
+		}).Error("Error declining friend request", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrFriendRequestNotFound
+	}
+	return nil
+}
+
+// RemoveFriend ends a friendship between two users, or cancels a pending request between them
+func (r *FriendRepository) RemoveFriend(userID, otherUserID uint) error {
+	result, err := r.db.Exec("DELETE FROM friendships WHERE "+friendPair, userID, otherUserID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":      userID,
+			"otherUserID": otherUserID,
+			"method":      "RemoveFriend",
+		}).Error("Error removing friend", err)
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrFriendNotFound
+	}
+	return nil
+}
+
+// AreFriends reports whether two users have an accepted friendship
+func (r *FriendRepository) AreFriends(userID, otherUserID uint) (bool, error) {
+	var friends bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM friendships WHERE "+friendPair+" AND status = $3)",
+		userID, otherUserID, models.FriendshipAccepted).Scan(&friends)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":      userID,
+			"otherUserID": otherUserID,
+			"method":      "AreFriends",
+		}).Error("Error checking friendship", err)
+		return false, err
+	}
+	return friends, nil
+}
+
+// GetFriends retrieves a user's friends, most recent first
+func (r *FriendRepository) GetFriends(userID uint) ([]models.Friend, error) {
+	return r.queryFriends("GetFriends", `
+        SELECT u.id, u.username, u.first_name, f.accepted_at
+        FROM friendships f
+        JOIN users u ON u.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+        WHERE (f.requester_id = $1 OR f.addressee_id = $1) AND f.status = $2 AND u.deleted_at IS NULL
+        ORDER BY f.accepted_at DESC
+    `, userID, models.FriendshipAccepted)
+}
+
+// GetFriendsRegisteredForEvent retrieves the friends of a user who have registered for an event
+func (r *FriendRepository) GetFriendsRegisteredForEvent(userID, eventID uint) ([]models.Friend, error) {
+	return r.queryFriends("GetFriendsRegisteredForEvent", `
+        SELECT u.id, u.username, u.first_name, f.accepted_at
+        FROM friendships f
+        JOIN users u ON u.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+        WHERE (f.requester_id = $1 OR f.addressee_id = $1) AND f.status = $2 AND u.deleted_at IS NULL
+          AND EXISTS (
+              SELECT 1 FROM activities a
+              WHERE a.user_id = u.id AND a.event_id = $3 AND a.activity_type = 'event_registered'
+          )
+        ORDER BY u.username
+    `, userID, models.FriendshipAccepted, eventID)
+}
+
+func (r *FriendRepository) queryFriends(method, query string, args ...interface{}) ([]models.Friend, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": method,
+		}).Error("Error fetching friends", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	friends := []models.Friend{}
+	for rows.Next() {
+		var friend models.Friend
+		var firstName sql.NullString
+		if err := rows.Scan(&friend.UserID, &friend.Username, &firstName, &friend.Since); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"method": method,
+			}).Error("Error scanning friend", err)
+			return nil, err
+		}
+		if firstName.Valid {
+			friend.FirstName = &firstName.String
+		}
+		friends = append(friends, friend)
+	}
+	return friends, rows.Err()
+}
+
+// GetFriendRequests retrieves the pending friend requests sent to and by a user, most recent first
+func (r *FriendRepository) GetFriendRequests(userID uint) (*models.FriendRequests, error) {
+	rows, err := r.db.Query(`
+        SELECT f.requester_id = $1, u.id, u.username, u.first_name, f.created_at
+        FROM friendships f
+        JOIN users u ON u.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+        WHERE (f.requester_id = $1 OR f.addressee_id = $1) AND f.status = $2 AND u.deleted_at IS NULL
+        ORDER BY f.created_at DESC
+    `, userID, models.FriendshipPending)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetFriendRequests",
+		}).Error("Error fetching friend requests", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := &models.FriendRequests{Incoming: []models.FriendRequest{}, Outgoing: []models.FriendRequest{}}
+	for rows.Next() {
+		var outgoing bool
+		var request models.FriendRequest
+		var firstName sql.NullString
+		if err := rows.Scan(&outgoing, &request.UserID, &request.Username, &firstName, &request.CreatedAt); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetFriendRequests",
+			}).Error("Error scanning friend request", err)
+			return nil, err
+		}
+		if firstName.Valid {
+			request.FirstName = &firstName.String
+		}
+		if outgoing {
+			requests.Outgoing = append(requests.Outgoing, request)
+		} else {
+			requests.Incoming = append(requests.Incoming, request)
+		}
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** IdentityRepository ***************************
+
+// IdentityRepository represents the repository for accounts at external OpenID Connect providers
+type IdentityRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewIdentityRepository creates a new instance of IdentityRepository
+func NewIdentityRepository(db *sql.DB, logger *logrus.Logger) *IdentityRepository {
+	return &IdentityRepository{db: db, logger: logger}
+}
+
+// *************************** Identities ***************************
+
+// GetUserIDByIdentity retrieves the user linked to an account at a provider
+func (r *IdentityRepository) GetUserIDByIdentity(provider, subject string) (uint, error) {
+	var userID uint
+	err := r.db.QueryRow("SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2", provider, subject).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrIdentityNotFound
+		}
+		r.logger.WithFields(logrus.Fields{
+			"provider": provider,
+			"method":   "GetUserIDByIdentity",
+		}).Error("Error retrieving identity", err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+// LinkIdentity links an account at a provider to a user
+func (r *IdentityRepository) LinkIdentity(userID uint, provider, subject, email string) error {
+	now := time.Now()
+	_, err := r.db.Exec("INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at) VALUES ($1, $2, $3, $4, $5, $5)",
+		userID, provider, subject, email, now)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":   userID,
+			"provider": provider,
+			"method":   "LinkIdentity",
+		}).Error("Error linking identity", err)
+		return err
+	}
+	return nil
+}
+
+// RecordIdentityLogin records a sign in through a provider and the email address it reported
+func (r *IdentityRepository) RecordIdentityLogin(provider, subject, email string) error {
+	_, err := r.db.Exec("UPDATE user_identities SET last_login_at = $1, email = $2 WHERE provider = $3 AND subject = $4", time.Now(), email, provider, subject)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"provider": provider,
+			"method":   "RecordIdentityLogin",
+		}).Error("Error recording identity login", err)
+		return err
+	}
+	return nil
+}
+
+// GetIdentities retrieves the provider accounts linked to a user
+func (r *IdentityRepository) GetIdentities(userID uint) ([]models.UserIdentity, error) {
+	rows, err := r.db.Query("SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at FROM user_identities WHERE user_id = $1 ORDER BY created_at", userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetIdentities",
+		}).Error("Error retrieving identities", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		var identity models.UserIdentity
+		var lastLoginAt sql.NullTime
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &lastLoginAt); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetIdentities",
+			}).Error("Error scanning identity", err)
+			return nil, err
+		}
+		if lastLoginAt.Valid {
+			identity.LastLoginAt = &lastLoginAt.Time
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// *************************** Login States ***************************
+
+// SaveLoginState stores a sign in that has been sent to a provider, keyed by the hash of its state parameter
+func (r *IdentityRepository) SaveLoginState(stateHash string, state models.OIDCLoginState, expiresAt time.Time) error {
+	_, err := r.db.Exec("INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		stateHash, state.Provider, state.Nonce, state.CodeVerifier, expiresAt, time.Now())
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"provider": state.Provider,
+			"method":   "SaveLoginState",
+		}).Error("Error saving login state", err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeLoginState removes and returns an unexpired sign in state. A state can only be used once.
+func (r *IdentityRepository) ConsumeLoginState(stateHash string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	err := r.db.QueryRow("DELETE FROM oidc_login_states WHERE state_hash = $1 AND expires_at > $2 RETURNING provider, nonce, code_verifier", stateHash, time.Now()).
+		Scan(&state.Provider, &state.Nonce, &state.CodeVerifier)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidLoginState
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "ConsumeLoginState",
+		}).Error("Error consuming login state", err)
+		return nil, err
+	}
+	return &state, nil
+}
+
+// PruneLoginStates deletes sign in states that expired before the given time
+func (r *IdentityRepository) PruneLoginStates(expiredBefore time.Time) error {
+	_, err := r.db.Exec("DELETE FROM oidc_login_states WHERE expires_at < $1", expiredBefore)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "PruneLoginStates",
+		}).Error("Error pruning login states", err)
+		return err
+	}
+	return nil
+}
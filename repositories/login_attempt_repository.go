@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** LoginAttemptRepository ***************************
+
+// LoginAttemptRepository represents the repository for login attempt database operations
+type LoginAttemptRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewLoginAttemptRepository creates a new instance of LoginAttemptRepository
+func NewLoginAttemptRepository(db *sql.DB, logger *logrus.Logger) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// RecordAttempt stores a login attempt, linking it to the account with that username if there is one
+func (r *LoginAttemptRepository) RecordAttempt(attempt *models.LoginAttempt) error {
+	err := r.db.QueryRow(`
+        INSERT INTO login_attempts (username, user_id, ip_address, user_agent, success, reason, created_at)
+        VALUES ($1, (SELECT id FROM users WHERE username = $1), $2, $3, $4, $5, $6)
+        RETURNING id
+    `, attempt.Username, attempt.IPAddress, attempt.UserAgent, attempt.Success, attempt.Reason, time.Now()).Scan(&attempt.ID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"username": attempt.Username,
+			"method":   "RecordAttempt",
+		}).Error("Error recording login attempt", err)
+		return err
+	}
+	return nil
+}
+
+// RecentFailures counts the failed password and two-factor code attempts for a username since the given time, ignoring
+// failures before the most recent success, and returns when the latest failure happened
+func (r *LoginAttemptRepository) RecentFailures(username string, since time.Time) (int, time.Time, error) {
+	var count int
+	var last sql.NullTime
+	err := r.db.QueryRow(`
+        SELECT COUNT(*), MAX(created_at)
+        FROM login_attempts
+        WHERE username = $1 AND reason IN ($2, $3) AND created_at > $4
+          AND created_at > COALESCE((SELECT MAX(created_at) FROM login_attempts WHERE username = $1 AND success), 'epoch')
+    `, username, models.LoginInvalidCredentials, models.LoginInvalidMFACode, since).Scan(&count, &last)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"username": username,
+			"method":   "RecentFailures",
+		}).Error("Error counting failed login attempts", err)
+		return 0, time.Time{}, err
+	}
+	return count, last.Time, nil
+}
+
+// RecentFailuresByIP counts the failed password and two-factor code attempts from an IP address since the given time
+func (r *LoginAttemptRepository) RecentFailuresByIP(ipAddress string, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM login_attempts WHERE ip_address = $1 AND reason IN ($2, $3) AND created_at > $4",
+		ipAddress, models.LoginInvalidCredentials, models.LoginInvalidMFACode, since).Scan(&count)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"ipAddress": ipAddress,
+			"method":    "RecentFailuresByIP",
+		}).Error("Error counting failed login attempts", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetAttempts retrieves the most recent login attempts against a user's account, newest first
+func (r *LoginAttemptRepository) GetAttempts(userID uint, limit int) ([]models.LoginAttempt, error) {
+	rows, err := r.db.Query(`
+        SELECT id, username, ip_address, user_agent, success, reason, created_at
+        FROM login_attempts
+        WHERE user_id = $1
+        ORDER BY created_at DESC, id DESC
+        LIMIT $2
+    `, userID, limit)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetAttempts",
+		}).Error("Error querying login attempts", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []models.LoginAttempt{}
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		var userAgent sql.NullString
+		if err := rows.Scan(&attempt.ID, &attempt.Username, &attempt.IPAddress, &userAgent, &attempt.Success, &attempt.Reason, &attempt.CreatedAt); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetAttempts",
+			}).Error("Error scanning login attempt", err)
+			return nil, err
+		}
+		attempt.UserAgent = userAgent.String
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// PruneAttempts deletes login attempts older than the given time
+func (r *LoginAttemptRepository) PruneAttempts(before time.Time) error {
+	_, err := r.db.Exec("DELETE FROM login_attempts WHERE created_at < $1", before)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "PruneAttempts",
+		}).Error("Error pruning login attempts", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** NotificationRepository ***************************
+
+// NotificationRepository represents the repository for notification-related database operations
+type NotificationRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewNotificationRepository creates a new instance of NotificationRepository
+func NewNotificationRepository(db *sql.DB, logger *logrus.Logger) *NotificationRepository {
+	return &NotificationRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// CreateNotification stores a new in-app notification for a user
+func (r *NotificationRepository) CreateNotification(notification *models.Notification) error {
+	err := r.db.QueryRow(`
+        INSERT INTO notifications (user_id, type, title, body, link, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `, notification.UserID, notification.Type, notification.Title, notification.Body, notification.Link, time.Now()).Scan(&notification.ID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": notification.UserID,
+			"type":   notification.Type,
+			"method": "CreateNotification",
+		}).Error("Error creating notification", err)
+		return err
+	}
+	return nil
+}
+
+// GetNotifications retrieves a page of a user's notifications, newest first
+func (r *NotificationRepository) GetNotifications(userID uint, unreadOnly bool, limit, offset int) ([]models.Notification, error) {
+	query := `
+        SELECT id, user_id, type, title, body, link, read_at, created_at
+        FROM notifications
+        WHERE user_id = $1`
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3"
+
+	rows, err := r.db.Query(query, userID, limit, offset)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetNotifications",
+		}).Error("Error querying notifications", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var notification models.Notification
+		var link sql.NullString
+		var readAt sql.NullTime
+		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.Title, &notification.Body, &link, &readAt, &notification.CreatedAt)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetNotifications",
+			}).Error("Error scanning notification", err)
+			return nil, err
+		}
+		notification.Link = link.String
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// MarkRead marks a single notification as read if it belongs to the user
+func (r *NotificationRepository) MarkRead(userID, notificationID uint) error {
+	result, err := r.db.Exec("UPDATE notifications SET read_at = $1 WHERE id = $2 AND user_id = $3 AND read_at IS NULL", time.Now(), notificationID, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":         userID,
+			"notificationID": notificationID,
+			"method":         "MarkRead",
+		}).Error("Error marking notification as read", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// Either already read or not the user's notification
+		var exists bool
+		err = r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM notifications WHERE id = $1 AND user_id = $2)", notificationID, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotificationNotFound
+		}
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of a user as read
+func (r *NotificationRepository) MarkAllRead(userID uint) (int64, error) {
+	result, err := r.db.Exec("UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL", time.Now(), userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "MarkAllRead",
+		}).Error("Error marking all notifications as read", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UnreadCount returns the number of unread notifications for a user
+func (r *NotificationRepository) UnreadCount(userID uint) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "UnreadCount",
+		}).Error("Error counting unread notifications", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetPreferences returns the delivery preferences of a user for every notification type.
+// Types without a stored preference default to both in-app and email delivery.
+func (r *NotificationRepository) GetPreferences(userID uint) ([]models.NotificationPreference, error) {
+	rows, err := r.db.Query("SELECT type, in_app, email FROM notification_preferences WHERE user_id = $1", userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetPreferences",
+		}).Error("Error querying notification preferences", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]models.NotificationPreference)
+	for rows.Next() {
+		var pref models.NotificationPreference
+		if err := rows.Scan(&pref.Type, &pref.InApp, &pref.Email); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetPreferences",
+			}).Error("Error scanning notification preference", err)
+			return nil, err
+		}
+		stored[pref.Type] = pref
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(models.NotificationTypes))
+	for _, notificationType := range models.NotificationTypes {
+		pref, ok := stored[notificationType]
+		if !ok {
+			pref = models.NotificationPreference{Type: notificationType, InApp: true, Email: true}
+		}
+		preferences = append(preferences, pref)
+	}
+	return preferences, nil
+}
+
+// GetPreference returns the delivery preference of a user for a single notification type
+func (r *NotificationRepository) GetPreference(userID uint, notificationType string) (models.NotificationPreference, error) {
+	pref := models.NotificationPreference{Type: notificationType, InApp: true, Email: true}
+	err := r.db.QueryRow("SELECT in_app, email FROM notification_preferences WHERE user_id = $1 AND type = $2", userID, notificationType).Scan(&pref.InApp, &pref.Email)
+	if err != nil && err != sql.ErrNoRows {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"type":   notificationType,
+			"method": "GetPreference",
+		}).Error("Error retrieving notification preference", err)
+		return pref, err
+	}
+	return pref, nil
+}
+
+// SetPreference stores the delivery preference of a user for a notification type
+func (r *NotificationRepository) SetPreference(userID uint, pref models.NotificationPreference) error {
+	_, err := r.db.Exec(`
+        INSERT INTO notification_preferences (user_id, type, in_app, email)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (user_id, type) DO UPDATE SET in_app = EXCLUDED.in_app, email = EXCLUDED.email
+    `, userID, pref.Type, pref.InApp, pref.Email)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"type":   pref.Type,
+			"method": "SetPreference",
+		}).Error("Error saving notification preference", err)
+		return err
+	}
+	return nil
+}
+
+// GetUserEmail retrieves the email address a notification should be delivered to and whether it is verified
+func (r *NotificationRepository) GetUserEmail(userID uint) (string, bool, error) {
+	var email string
+	var verified bool
+	err := r.db.QueryRow("SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&email, &verified)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetUserEmail",
+		}).Error("Error retrieving user email", err)
+		return "", false, err
+	}
+	return email, verified, nil
+}
+
+// PruneReadNotifications deletes notifications that were read before the given time
+func (r *NotificationRepository) PruneReadNotifications(readBefore time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM notifications WHERE read_at IS NOT NULL AND read_at < $1", readBefore)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "PruneReadNotifications",
+		}).Error("Error pruning read notifications", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -2,10 +2,12 @@ package repositories
 
 import (
 	"database/sql"
+	"encoding/json"
+	"event-connect/draw"
+	"event-connect/eligibility"
 	"event-connect/models"
-	"event-connect/skiddle"
 	"fmt"
-	"net/http"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -19,71 +21,100 @@ func NewRaffleRepository(db *sql.DB, logger *logrus.Logger) *RaffleRepository {
 	return &RaffleRepository{db: db, logger: logger}
 }
 
-func (r *RaffleRepository) EnterRaffle(entry *models.RaffleEntry, getUserIDFromToken func(*http.Request) (int, error), req *http.Request) error {
-	url := skiddle.EventDetailsURL(entry.EventID)
-	resp, err := http.Get(url)
+// EnterRaffle records a raffle entry for entry.UserID, which the caller must have authenticated
+func (r *RaffleRepository) EnterRaffle(entry *models.RaffleEntry) error {
+	r.logger.WithFields(logrus.Fields{
+		"eventID": entry.EventID,
+		"userID":  entry.UserID,
+		"method":  "EnterRaffle",
+	}).Info("Received raffle entry request", entry)
+
+	raffle, err := r.GetRaffle(entry.EventID)
 	if err != nil {
+		return fmt.Errorf("internal server error")
+	}
+	if raffle != nil && !raffle.IsOpen(time.Now()) {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": entry.EventID,
+			"userID":  entry.UserID,
 			"method":  "EnterRaffle",
-		}).Error("Error checking event existence", err)
+		}).Warn("Raffle is closed for event")
+		return ErrRaffleClosed
+	}
+
+	var count int
+	err = r.db.QueryRow("SELECT COUNT(*) FROM raffle_entries WHERE event_id = $1 AND user_id = $2", entry.EventID, entry.UserID).Scan(&count)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": entry.EventID,
+			"userID":  entry.UserID,
+			"method":  "EnterRaffle",
+		}).Error("Error checking duplicate raffle entry", err)
 		return fmt.Errorf("internal server error")
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
+	if count > 0 {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": entry.EventID,
+			"userID":  entry.UserID,
 			"method":  "EnterRaffle",
-		}).Error("Event not found in Skiddle API")
-		return fmt.Errorf("event not found")
+		}).Warn("User has already entered the raffle for event")
+		return ErrDuplicateRaffleEntry
 	}
 
-	userID, err := getUserIDFromToken(req)
+	tx, err := r.db.Begin()
 	if err != nil {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": entry.EventID,
+			"userID":  entry.UserID,
 			"method":  "EnterRaffle",
-		}).Error("Error getting user ID from token", err)
-		return fmt.Errorf("unauthorized")
+		}).Error("Failed to begin transaction", err)
+		return fmt.Errorf("internal server error")
 	}
+	defer tx.Rollback()
 
-	entry.UserID = uint(userID)
-
-	r.logger.WithFields(logrus.Fields{
-		"eventID": entry.EventID,
-		"userID":  entry.UserID,
-		"method":  "EnterRaffle",
-	}).Info("Received raffle entry request", entry)
+	// The unique index on the reserved domain settles entries from the same domain that both passed the eligibility check
+	emailDomain, err := r.reservedEmailDomain(tx, entry.EventID, entry.UserID)
+	if err != nil {
+		return fmt.Errorf("internal server error")
+	}
 
-	var count int
-	err = r.db.QueryRow("SELECT COUNT(*) FROM raffle_entries WHERE event_id = $1 AND user_id = $2", entry.EventID, entry.UserID).Scan(&count)
+	result, err := tx.Exec(`
+        INSERT INTO raffle_entries (event_id, user_id, age, gender, latitude, longitude, team_with_user_id, unique_email_domain)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (event_id, unique_email_domain) DO NOTHING
+    `, entry.EventID, entry.UserID, entry.Age, entry.Gender, entry.Latitude, entry.Longitude, entry.TeamWithUserID, emailDomain)
 	if err != nil {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": entry.EventID,
 			"userID":  entry.UserID,
 			"method":  "EnterRaffle",
-		}).Error("Error checking duplicate raffle entry", err)
+		}).Error("Error inserting raffle entry", err)
 		return fmt.Errorf("internal server error")
 	}
-
-	if count > 0 {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("internal server error")
+	}
+	if affected == 0 {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": entry.EventID,
 			"userID":  entry.UserID,
 			"method":  "EnterRaffle",
-		}).Warn("User has already entered the raffle for event")
-		return fmt.Errorf("duplicate raffle entry")
+		}).Warn("Email domain has already entered the raffle for event")
+		return ErrEmailDomainTaken
 	}
 
-	_, err = r.db.Exec("INSERT INTO raffle_entries (event_id, user_id, age, gender, latitude, longitude) VALUES ($1, $2, $3, $4, $5, $6)",
-		entry.EventID, entry.UserID, entry.Age, entry.Gender, entry.Latitude, entry.Longitude)
-	if err != nil {
+	if err := recordEntryHistory(tx, entry, models.RaffleEntryActionEntered); err != nil {
 		r.logger.WithFields(logrus.Fields{
 			"eventID": entry.EventID,
 			"userID":  entry.UserID,
 			"method":  "EnterRaffle",
-		}).Error("Error inserting raffle entry", err)
+		}).Error("Error recording raffle entry history", err)
+		return fmt.Errorf("internal server error")
+	}
+
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("internal server error")
 	}
 
@@ -93,4 +124,606 @@ func (r *RaffleRepository) EnterRaffle(entry *models.RaffleEntry, getUserIDFromT
 		"method":  "EnterRaffle",
 	}).Info("Raffle entry created successfully")
 	return nil
-}
\ No newline at end of file
+}
+
+// reservedEmailDomain returns the email domain a new entry takes up under the event's rules, or nil when there isn't one
+func (r *RaffleRepository) reservedEmailDomain(tx *sql.Tx, eventID, userID uint) (*string, error) {
+	rules, err := r.GetRules(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	var email string
+	if err := tx.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "reservedEmailDomain",
+		}).Error("Error retrieving entrant email", err)
+		return nil, err
+	}
+
+	if domain := eligibility.ReservedEmailDomain(rules, email); domain != "" {
+		return &domain, nil
+	}
+	return nil, nil
+}
+
+// GetRaffle retrieves the raffle settings for an event, or nil if the event has no raffle configured
+func (r *RaffleRepository) GetRaffle(eventID uint) (*models.Raffle, error) {
+	var raffle models.Raffle
+	var drawnAt sql.NullTime
+	var seed, seedHash sql.NullString
+	err := r.db.QueryRow("SELECT event_id, places, closes_at, drawn_at, seed, seed_hash, created_at FROM raffles WHERE event_id = $1", eventID).
+		Scan(&raffle.EventID, &raffle.Places, &raffle.ClosesAt, &drawnAt, &seed, &seedHash, &raffle.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetRaffle",
+		}).Error("Error retrieving raffle", err)
+		return nil, err
+	}
+	if drawnAt.Valid {
+		raffle.DrawnAt = &drawnAt.Time
+	}
+	raffle.Seed = seed.String
+	raffle.SeedHash = seedHash.String
+	return &raffle, nil
+}
+
+// SaveRaffle creates or updates the raffle settings for an event that has not been drawn yet.
+// A new raffle is committed to a freshly generated seed; updates keep the existing commitment.
+func (r *RaffleRepository) SaveRaffle(raffle *models.Raffle) error {
+	seed, seedHash, err := draw.NewSeed()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": raffle.EventID,
+			"method":  "SaveRaffle",
+		}).Error("Error generating raffle seed", err)
+		return err
+	}
+
+	result, err := r.db.Exec(`
+        INSERT INTO raffles (event_id, places, closes_at, seed, seed_hash)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (event_id) DO UPDATE SET places = EXCLUDED.places, closes_at = EXCLUDED.closes_at,
+            seed = COALESCE(raffles.seed, EXCLUDED.seed), seed_hash = COALESCE(raffles.seed_hash, EXCLUDED.seed_hash)
+        WHERE raffles.drawn_at IS NULL
+    `, raffle.EventID, raffle.Places, raffle.ClosesAt, seed, seedHash)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": raffle.EventID,
+			"method":  "SaveRaffle",
+		}).Error("Error saving raffle", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRaffleAlreadyDrawn
+	}
+	return nil
+}
+
+// CountEntries returns the number of entries for an event's raffle
+func (r *RaffleRepository) CountEntries(eventID uint) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM raffle_entries WHERE event_id = $1", eventID).Scan(&count)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "CountEntries",
+		}).Error("Error counting raffle entries", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// FetchEntries retrieves every entry of an event's raffle in the order they were made
+func (r *RaffleRepository) FetchEntries(eventID uint) ([]models.RaffleEntry, error) {
+	rows, err := r.db.Query(`
+        SELECT event_id, user_id, age, gender, latitude, longitude, status, waitlist_position
+        FROM raffle_entries
+        WHERE event_id = $1
+        ORDER BY id
+    `, eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "FetchEntries",
+		}).Error("Error fetching raffle entries", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.RaffleEntry
+	for rows.Next() {
+		var entry models.RaffleEntry
+		var position sql.NullInt64
+		err := rows.Scan(&entry.EventID, &entry.UserID, &entry.Age, &entry.Gender, &entry.Latitude, &entry.Longitude, &entry.Status, &position)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"eventID": eventID,
+				"method":  "FetchEntries",
+			}).Error("Error scanning raffle entry", err)
+			return nil, err
+		}
+		if position.Valid {
+			p := int(position.Int64)
+			entry.WaitlistPosition = &p
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetEntry retrieves a user's entry in an event's raffle, or nil if they have not entered
+func (r *RaffleRepository) GetEntry(eventID, userID uint) (*models.RaffleEntry, error) {
+	var entry models.RaffleEntry
+	var position, teamWith sql.NullInt64
+	err := r.db.QueryRow(`
+        SELECT event_id, user_id, age, gender, latitude, longitude, status, waitlist_position, team_with_user_id
+        FROM raffle_entries
+        WHERE event_id = $1 AND user_id = $2
+    `, eventID, userID).Scan(&entry.EventID, &entry.UserID, &entry.Age, &entry.Gender, &entry.Latitude, &entry.Longitude, &entry.Status, &position, &teamWith)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "GetEntry",
+		}).Error("Error retrieving raffle entry", err)
+		return nil, err
+	}
+	if position.Valid {
+		p := int(position.Int64)
+		entry.WaitlistPosition = &p
+	}
+	if teamWith.Valid {
+		friendID := uint(teamWith.Int64)
+		entry.TeamWithUserID = &friendID
+	}
+	return &entry, nil
+}
+
+// RecordDraw stores the draw record, the winners and the ranked waitlist of a raffle and marks it as drawn
+func (r *RaffleRepository) RecordDraw(record *models.RaffleDraw) error {
+	eventID, winners, waitlist := record.EventID, record.Winners, record.Waitlist
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "RecordDraw",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE raffles SET drawn_at = $1, seed = $2, seed_hash = $3 WHERE event_id = $4 AND drawn_at IS NULL",
+		record.DrawnAt, record.Seed, record.SeedHash, eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "RecordDraw",
+		}).Error("Error marking raffle as drawn", err)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRaffleAlreadyDrawn
+	}
+
+	entriesJSON, err := json.Marshal(record.Entries)
+	if err != nil {
+		return err
+	}
+	winnersJSON, err := json.Marshal(winners)
+	if err != nil {
+		return err
+	}
+	waitlistJSON, err := json.Marshal(waitlist)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        INSERT INTO raffle_draws (event_id, algorithm, seed, seed_hash, places, entries, winners, waitlist, drawn_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+    `, eventID, record.Algorithm, record.Seed, record.SeedHash, record.Places, entriesJSON, winnersJSON, waitlistJSON, record.DrawnAt)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "RecordDraw",
+		}).Error("Error storing raffle draw record", err)
+		return err
+	}
+
+	for _, userID := range winners {
+		_, err := tx.Exec("UPDATE raffle_entries SET status = $1, waitlist_position = NULL WHERE event_id = $2 AND user_id = $3", models.RaffleEntryWon, eventID, userID)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"eventID": eventID,
+				"userID":  userID,
+				"method":  "RecordDraw",
+			}).Error("Error recording raffle winner", err)
+			return err
+		}
+	}
+
+	for i, userID := range waitlist {
+		_, err := tx.Exec("UPDATE raffle_entries SET status = $1, waitlist_position = $2 WHERE event_id = $3 AND user_id = $4", models.RaffleEntryWaitlisted, i+1, eventID, userID)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"eventID": eventID,
+				"userID":  userID,
+				"method":  "RecordDraw",
+			}).Error("Error recording raffle waitlist entry", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeclinePlace gives up a winner's place and promotes the first entry on the waitlist.
+// It returns the ID of the promoted user, or nil if the waitlist is empty.
+func (r *RaffleRepository) DeclinePlace(eventID, userID uint) (*uint, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "DeclinePlace",
+		}).Error("Failed to begin transaction", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	promoted, err := declinePlace(tx, r.logger, eventID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// declinePlace gives up a winner's place within a transaction and promotes the first entry on the
+// waitlist, returning the ID of the promoted user or nil if the waitlist is empty
+func declinePlace(tx *sql.Tx, logger *logrus.Logger, eventID, userID uint) (*uint, error) {
+	result, err := tx.Exec("UPDATE raffle_entries SET status = $1 WHERE event_id = $2 AND user_id = $3 AND status = $4", models.RaffleEntryDeclined, eventID, userID, models.RaffleEntryWon)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "DeclinePlace",
+		}).Error("Error declining raffle place", err)
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrNoPlaceToDecline
+	}
+
+	var promoted uint
+	err = tx.QueryRow(`
+        SELECT user_id FROM raffle_entries
+        WHERE event_id = $1 AND status = $2
+        ORDER BY waitlist_position
+        LIMIT 1
+        FOR UPDATE
+    `, eventID, models.RaffleEntryWaitlisted).Scan(&promoted)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "DeclinePlace",
+		}).Error("Error fetching next waitlisted entry", err)
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE raffle_entries SET status = $1, waitlist_position = NULL WHERE event_id = $2 AND user_id = $3", models.RaffleEntryWon, eventID, promoted)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  promoted,
+			"method":  "DeclinePlace",
+		}).Error("Error promoting waitlisted entry", err)
+		return nil, err
+	}
+
+	// Move everyone else up the waitlist
+	_, err = tx.Exec("UPDATE raffle_entries SET waitlist_position = waitlist_position - 1 WHERE event_id = $1 AND status = $2", eventID, models.RaffleEntryWaitlisted)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "DeclinePlace",
+		}).Error("Error updating waitlist positions", err)
+		return nil, err
+	}
+
+	return &promoted, nil
+}
+
+// FetchRafflesDueForDraw retrieves the raffles whose entries have closed but have not been drawn.
+// Raffles without a committed seed can't be drawn, so they are left out.
+func (r *RaffleRepository) FetchRafflesDueForDraw(now time.Time) ([]models.Raffle, error) {
+	rows, err := r.db.Query("SELECT event_id, places, closes_at, created_at FROM raffles WHERE drawn_at IS NULL AND closes_at <= $1 AND seed_hash IS NOT NULL", now)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "FetchRafflesDueForDraw",
+		}).Error("Error fetching raffles due for draw", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var raffles []models.Raffle
+	for rows.Next() {
+		var raffle models.Raffle
+		if err := rows.Scan(&raffle.EventID, &raffle.Places, &raffle.ClosesAt, &raffle.CreatedAt); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"method": "FetchRafflesDueForDraw",
+			}).Error("Error scanning raffle", err)
+			return nil, err
+		}
+		raffles = append(raffles, raffle)
+	}
+
+	return raffles, rows.Err()
+}
+
+// GetDraw retrieves the published draw record of an event's raffle, or nil if it has not been drawn
+func (r *RaffleRepository) GetDraw(eventID uint) (*models.RaffleDraw, error) {
+	var record models.RaffleDraw
+	var entriesJSON, winnersJSON, waitlistJSON []byte
+	err := r.db.QueryRow(`
+        SELECT event_id, algorithm, seed, seed_hash, places, entries, winners, waitlist, drawn_at
+        FROM raffle_draws
+        WHERE event_id = $1
+    `, eventID).Scan(&record.EventID, &record.Algorithm, &record.Seed, &record.SeedHash, &record.Places, &entriesJSON, &winnersJSON, &waitlistJSON, &record.DrawnAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetDraw",
+		}).Error("Error retrieving raffle draw", err)
+		return nil, err
+	}
+
+	for _, field := range []struct {
+		raw  []byte
+		dest *[]uint
+	}{{entriesJSON, &record.Entries}, {winnersJSON, &record.Winners}, {waitlistJSON, &record.Waitlist}} {
+		if err := json.Unmarshal(field.raw, field.dest); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"eventID": eventID,
+				"method":  "GetDraw",
+			}).Error("Error unmarshalling raffle draw", err)
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// AmendEntry updates a user's raffle entry while it can still be changed
+func (r *RaffleRepository) AmendEntry(entry *models.RaffleEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": entry.EventID,
+			"userID":  entry.UserID,
+			"method":  "AmendEntry",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.checkEntryEditable(tx, entry.EventID, entry.UserID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE raffle_entries SET age = $1, gender = $2, latitude = $3, longitude = $4, team_with_user_id = $5 WHERE event_id = $6 AND user_id = $7",
+		entry.Age, entry.Gender, entry.Latitude, entry.Longitude, entry.TeamWithUserID, entry.EventID, entry.UserID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": entry.EventID,
+			"userID":  entry.UserID,
+			"method":  "AmendEntry",
+		}).Error("Error updating raffle entry", err)
+		return err
+	}
+
+	if err := recordEntryHistory(tx, entry, models.RaffleEntryActionAmended); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": entry.EventID,
+			"userID":  entry.UserID,
+			"method":  "AmendEntry",
+		}).Error("Error recording raffle entry history", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// WithdrawEntry removes a user's raffle entry while it can still be changed
+func (r *RaffleRepository) WithdrawEntry(eventID, userID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "WithdrawEntry",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := r.checkEntryEditable(tx, eventID, userID); err != nil {
+		return err
+	}
+
+	entry := models.RaffleEntry{EventID: eventID, UserID: userID}
+	err = tx.QueryRow("DELETE FROM raffle_entries WHERE event_id = $1 AND user_id = $2 RETURNING age, gender, latitude, longitude", eventID, userID).
+		Scan(&entry.Age, &entry.Gender, &entry.Latitude, &entry.Longitude)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "WithdrawEntry",
+		}).Error("Error deleting raffle entry", err)
+		return err
+	}
+
+	if err := recordEntryHistory(tx, &entry, models.RaffleEntryActionWithdrawn); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "WithdrawEntry",
+		}).Error("Error recording raffle entry history", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkEntryEditable ensures the entry exists and neither the draw nor team formation has happened.
+// The entry row is locked for the rest of the transaction.
+func (r *RaffleRepository) checkEntryEditable(tx *sql.Tx, eventID, userID uint) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM raffle_entries WHERE event_id = $1 AND user_id = $2 FOR UPDATE", eventID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrRaffleEntryNotFound
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "checkEntryEditable",
+		}).Error("Error retrieving raffle entry", err)
+		return err
+	}
+
+	var locked bool
+	err = tx.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM raffles WHERE event_id = $1 AND drawn_at IS NOT NULL)
+            OR EXISTS (SELECT 1 FROM teams WHERE event_id = $2)
+    `, eventID, eventID).Scan(&locked)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"userID":  userID,
+			"method":  "checkEntryEditable",
+		}).Error("Error checking raffle state", err)
+		return err
+	}
+	if locked {
+		return ErrRaffleEntryLocked
+	}
+	return nil
+}
+
+// recordEntryHistory appends a change to a raffle entry to its history
+func recordEntryHistory(tx *sql.Tx, entry *models.RaffleEntry, action string) error {
+	_, err := tx.Exec("INSERT INTO raffle_entry_history (event_id, user_id, action, age, gender, latitude, longitude) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		entry.EventID, entry.UserID, action, entry.Age, entry.Gender, entry.Latitude, entry.Longitude)
+	return err
+}
+
+// GetRules retrieves the eligibility rules of an event's raffle; an event without rules returns an empty set
+func (r *RaffleRepository) GetRules(eventID uint) ([]eligibility.Rule, error) {
+	var rulesJSON []byte
+	err := r.db.QueryRow("SELECT rules FROM raffle_rules WHERE event_id = $1", eventID).Scan(&rulesJSON)
+	if err == sql.ErrNoRows {
+		return []eligibility.Rule{}, nil
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetRules",
+		}).Error("Error retrieving raffle rules", err)
+		return nil, err
+	}
+
+	var rules []eligibility.Rule
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetRules",
+		}).Error("Error unmarshalling raffle rules", err)
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SaveRules replaces the eligibility rules of an event's raffle
+func (r *RaffleRepository) SaveRules(eventID uint, rules []eligibility.Rule) error {
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+        INSERT INTO raffle_rules (event_id, rules, updated_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (event_id) DO UPDATE SET rules = EXCLUDED.rules, updated_at = EXCLUDED.updated_at
+    `, eventID, rulesJSON, time.Now())
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "SaveRules",
+		}).Error("Error saving raffle rules", err)
+		return err
+	}
+	return nil
+}
+
+// EntryEmailDomains returns the email domains of users who have entered an event's raffle, with
+// the IDs of the entrants using each one
+func (r *RaffleRepository) EntryEmailDomains(eventID uint) (map[string][]uint, error) {
+	rows, err := r.db.Query(`
+        SELECT e.user_id, u.email
+        FROM raffle_entries e
+        JOIN users u ON e.user_id = u.id
+        WHERE e.event_id = $1
+    `, eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "EntryEmailDomains",
+		}).Error("Error fetching raffle entry email domains", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := make(map[string][]uint)
+	for rows.Next() {
+		var userID uint
+		var email string
+		if err := rows.Scan(&userID, &email); err != nil {
+			return nil, err
+		}
+		domain := eligibility.EmailDomain(email)
+		domains[domain] = append(domains[domain], userID)
+	}
+	return domains, rows.Err()
+}
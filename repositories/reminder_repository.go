@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** ReminderRepository ***************************
+
+// ReminderRepository represents the repository for event reminder database operations
+type ReminderRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewReminderRepository creates a new instance of ReminderRepository
+func NewReminderRepository(db *sql.DB, logger *logrus.Logger) *ReminderRepository {
+	return &ReminderRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// FetchRegistrations retrieves the event registrations of users who have not opted out of reminders
+// or deleted their account. Registrations for events known to have started by now, and those that
+// have already had the final reminder, are left out.
+func (r *ReminderRepository) FetchRegistrations(now time.Time, finalWindow string) ([]models.Activity, error) {
+	rows, err := r.db.Query(`
+        SELECT a.id, a.user_id, a.event_id, a.activity_type, a.timestamp
+        FROM activities a
+        JOIN users u ON a.user_id = u.id
+        LEFT JOIN event_start_times s ON s.event_id = a.event_id
+        WHERE a.activity_type = 'event_registered' AND NOT u.event_reminders_opt_out AND u.deleted_at IS NULL
+          AND (s.starts_at IS NULL OR s.starts_at > $1)
+          AND NOT EXISTS (
+              SELECT 1 FROM event_reminders er
+              WHERE er.user_id = a.user_id AND er.event_id = a.event_id AND er.reminder_window = $2
+          )
+        ORDER BY a.event_id
+    `, now, finalWindow)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "FetchRegistrations",
+		}).Error("Error fetching event registrations", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var registrations []models.Activity
+	for rows.Next() {
+		var activity models.Activity
+		err := rows.Scan(&activity.ID, &activity.UserID, &activity.EventID, &activity.ActivityType, &activity.Timestamp)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"method": "FetchRegistrations",
+			}).Error("Error scanning event registration", err)
+			return nil, err
+		}
+		registrations = append(registrations, activity)
+	}
+
+	return registrations, rows.Err()
+}
+
+// GetEventStartTime retrieves the stored start time of an event and when it was last looked up.
+// found is false when the start time has never been stored.
+func (r *ReminderRepository) GetEventStartTime(eventID uint) (startsAt, refreshedAt time.Time, found bool, err error) {
+	err = r.db.QueryRow("SELECT starts_at, refreshed_at FROM event_start_times WHERE event_id = $1", eventID).Scan(&startsAt, &refreshedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetEventStartTime",
+		}).Error("Error retrieving event start time", err)
+		return time.Time{}, time.Time{}, false, err
+	}
+	return startsAt, refreshedAt, true, nil
+}
+
+// SaveEventStartTime stores the start time of an event, replacing any stored before
+func (r *ReminderRepository) SaveEventStartTime(eventID uint, startsAt, refreshedAt time.Time) error {
+	_, err := r.db.Exec(`
+        INSERT INTO event_start_times (event_id, starts_at, refreshed_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (event_id) DO UPDATE SET starts_at = EXCLUDED.starts_at, refreshed_at = EXCLUDED.refreshed_at
+    `, eventID, startsAt, refreshedAt)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "SaveEventStartTime",
+		}).Error("Error saving event start time", err)
+	}
+	return err
+}
+
+// ClaimReminder records that a reminder is being sent and reports whether it had not been sent before
+func (r *ReminderRepository) ClaimReminder(userID, eventID uint, window string) (bool, error) {
+	result, err := r.db.Exec(`
+        INSERT INTO event_reminders (user_id, event_id, reminder_window)
+        VALUES ($1, $2, $3)
+        ON CONFLICT DO NOTHING
+    `, userID, eventID, window)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"eventID": eventID,
+			"window":  window,
+			"method":  "ClaimReminder",
+		}).Error("Error recording event reminder", err)
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// ReleaseReminder removes a reminder claim so that a failed delivery is retried on the next run
+func (r *ReminderRepository) ReleaseReminder(userID, eventID uint, window string) error {
+	_, err := r.db.Exec("DELETE FROM event_reminders WHERE user_id = $1 AND event_id = $2 AND reminder_window = $3", userID, eventID, window)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"eventID": eventID,
+			"window":  window,
+			"method":  "ReleaseReminder",
+		}).Error("Error releasing event reminder", err)
+	}
+	return err
+}
+
+// GetOptOut reports whether a user has opted out of event reminders
+func (r *ReminderRepository) GetOptOut(userID uint) (bool, error) {
+	var optOut bool
+	err := r.db.QueryRow("SELECT event_reminders_opt_out FROM users WHERE id = $1", userID).Scan(&optOut)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetOptOut",
+		}).Error("Error retrieving event reminder opt-out", err)
+		return false, err
+	}
+	return optOut, nil
+}
+
+// SetOptOut updates whether a user receives event reminders
+func (r *ReminderRepository) SetOptOut(userID uint, optOut bool) error {
+	_, err := r.db.Exec("UPDATE users SET event_reminders_opt_out = $1, updated_at = NOW() WHERE id = $2", optOut, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "SetOptOut",
+		}).Error("Error updating event reminder opt-out", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** ReportRepository ***************************
+
+// ReportRepository represents the repository for reports of users and the moderator queue
+type ReportRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewReportRepository creates a new instance of ReportRepository
+func NewReportRepository(db *sql.DB, logger *logrus.Logger) *ReportRepository {
+	return &ReportRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// CreateReport adds a report of reportedID by reporterID to the moderator queue. A user can only
+// have one open report of the same user at a time.
+func (r *ReportRepository) CreateReport(reporterID, reportedID uint, reason, details string) (uint, error) {
+	var open bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_reports WHERE reporter_id = $1 AND reported_id = $2 AND status = $3)",
+		reporterID, reportedID, models.ReportOpen).Scan(&open)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"reporterID": reporterID,
+			"reportedID": reportedID,
+			"method":     "CreateReport",
+		}).Error("Error checking for an open report", err)
+		return 0, err
+	}
+	if open {
+		return 0, ErrReportAlreadyOpen
+	}
+
+	var id uint
+	err = r.db.QueryRow("INSERT INTO user_reports (reporter_id, reported_id, reason, details, status, created_at) VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6) RETURNING id",
+		reporterID, reportedID, reason, details, models.ReportOpen, time.Now()).Scan(&id)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"reporterID": reporterID,
+			"reportedID": reportedID,
+			"method":     "CreateReport",
+		}).Error("Error creating report", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetReports retrieves the reports with a status, oldest first so the queue is worked in order
+func (r *ReportRepository) GetReports(status string, limit, offset int) ([]models.UserReport, error) {
+	rows, err := r.db.Query(`
+        SELECT ur.id, ur.reporter_id, reporter.username, ur.reported_id, reported.username, ur.reason, COALESCE(ur.details, ''),
+               ur.status, ur.created_at, ur.resolved_by, ur.resolved_at, COALESCE(ur.resolution_note, '')
+        FROM user_reports ur
+        JOIN users reporter ON reporter.id = ur.reporter_id
+        JOIN users reported ON reported.id = ur.reported_id
+        WHERE ur.status = $1
+        ORDER BY ur.created_at, ur.id
+        LIMIT $2 OFFSET $3
+    `, status, limit, offset)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"status": status,
+			"method": "GetReports",
+		}).Error("Error fetching reports", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.UserReport{}
+	for rows.Next() {
+		var report models.UserReport
+		var resolvedBy sql.NullInt64
+		var resolvedAt sql.NullTime
+		err := rows.Scan(&report.ID, &report.ReporterID, &report.ReporterUsername, &report.ReportedID, &report.ReportedUsername, &report.Reason, &report.Details,
+			&report.Status, &report.CreatedAt, &resolvedBy, &resolvedAt, &report.ResolutionNote)
+		if err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"status": status,
+				"method": "GetReports",
+			}).Error("Error scanning report", err)
+			return nil, err
+		}
+		if resolvedBy.Valid {
+			moderatorID := uint(resolvedBy.Int64)
+			report.ResolvedBy = &moderatorID
+		}
+		if resolvedAt.Valid {
+			report.ResolvedAt = &resolvedAt.Time
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// ResolveReport closes an open report with the outcome a moderator chose. It returns the reported user.
+func (r *ReportRepository) ResolveReport(reportID, moderatorID uint, status, note string) (uint, error) {
+	var reportedID uint
+	err := r.db.QueryRow(`
+        UPDATE user_reports
+        SET status = $1, resolved_by = $2, resolved_at = $3, resolution_note = NULLIF($4, '')
+        WHERE id = $5 AND status = $6
+        RETURNING reported_id
+    `, status, moderatorID, time.Now(), note, reportID, models.ReportOpen).Scan(&reportedID)
+	if err == sql.ErrNoRows {
+		var exists bool
+		if err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_reports WHERE id = $1)", reportID).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, ErrReportAlreadyResolved
+		}
+		return 0, ErrReportNotFound
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"reportID": reportID,
+			"method":   "ResolveReport",
+		}).Error("Error resolving report", err)
+		return 0, err
+	}
+	return reportedID, nil
+}
@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** RoleRepository ***************************
+
+// RoleRepository represents the repository for user role and event organiser database operations
+type RoleRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewRoleRepository creates a new instance of RoleRepository
+func NewRoleRepository(db *sql.DB, logger *logrus.Logger) *RoleRepository {
+	return &RoleRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// GetRoles returns the roles held by a user. Every user holds the "user" role.
+func (r *RoleRepository) GetRoles(userID uint) ([]string, error) {
+	rows, err := r.db.Query("SELECT role FROM user_roles WHERE user_id = $1", userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetRoles",
+		}).Error("Error querying user roles", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	held := map[string]bool{models.RoleUser: true}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"userID": userID,
+				"method": "GetRoles",
+			}).Error("Error scanning user role", err)
+			return nil, err
+		}
+		held[role] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Keep the roles in a stable order so tokens and responses are predictable
+	roles := []string{}
+	for _, role := range models.Roles {
+		if held[role] {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// GrantRole gives a user a role; granting a role the user already holds is a no-op
+func (r *RoleRepository) GrantRole(userID uint, role string) error {
+	if !models.IsRole(role) {
+		return ErrUnknownRole
+	}
+	if role == models.RoleUser {
+		return nil
+	}
+
+	_, err := r.db.Exec("INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT (user_id, role) DO NOTHING", userID, role)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"role":   role,
+			"method": "GrantRole",
+		}).Error("Error granting role", err)
+		return err
+	}
+	return nil
+}
+
+// RevokeRole removes a role from a user. The "user" role cannot be revoked.
+func (r *RoleRepository) RevokeRole(userID uint, role string) error {
+	if !models.IsRole(role) {
+		return ErrUnknownRole
+	}
+	if role == models.RoleUser {
+		return ErrRoleNotRevocable
+	}
+
+	_, err := r.db.Exec("DELETE FROM user_roles WHERE user_id = $1 AND role = $2", userID, role)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"role":   role,
+			"method": "RevokeRole",
+		}).Error("Error revoking role", err)
+		return err
+	}
+	return nil
+}
+
+// *************************** Event Organisers ***************************
+
+// IsEventOrganiser reports whether a user manages an event
+func (r *RoleRepository) IsEventOrganiser(userID, eventID uint) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM event_organisers WHERE user_id = $1 AND event_id = $2)", userID, eventID).Scan(&exists)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"eventID": eventID,
+			"method":  "IsEventOrganiser",
+		}).Error("Error checking event organiser", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+// GetEventOrganisers returns the IDs of the users who manage an event
+func (r *RoleRepository) GetEventOrganisers(eventID uint) ([]uint, error) {
+	rows, err := r.db.Query("SELECT user_id FROM event_organisers WHERE event_id = $1 ORDER BY user_id", eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetEventOrganisers",
+		}).Error("Error querying event organisers", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	organisers := []uint{}
+	for rows.Next() {
+		var userID uint
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		organisers = append(organisers, userID)
+	}
+	return organisers, rows.Err()
+}
+
+// AddEventOrganiser assigns a user to manage an event
+func (r *RoleRepository) AddEventOrganiser(userID, eventID uint) error {
+	_, err := r.db.Exec("INSERT INTO event_organisers (user_id, event_id) VALUES ($1, $2) ON CONFLICT (user_id, event_id) DO NOTHING", userID, eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"eventID": eventID,
+			"method":  "AddEventOrganiser",
+		}).Error("Error adding event organiser", err)
+		return err
+	}
+	return nil
+}
+
+// RemoveEventOrganiser stops a user from managing an event
+func (r *RoleRepository) RemoveEventOrganiser(userID, eventID uint) error {
+	_, err := r.db.Exec("DELETE FROM event_organisers WHERE user_id = $1 AND event_id = $2", userID, eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"eventID": eventID,
+			"method":  "RemoveEventOrganiser",
+		}).Error("Error removing event organiser", err)
+		return err
+	}
+	return nil
+}
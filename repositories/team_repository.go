@@ -26,11 +26,30 @@ func NewTeamRepository(db *sql.DB, logger *logrus.Logger) *TeamRepository {
     return &TeamRepository{db: db, logger: logger}
 }
 
+// teamEligibleEntry restricts raffle entries (aliased e) to those that take part in team formation:
+// the winners of a drawn raffle, or every entry when the event has no raffle draw configured
+const teamEligibleEntry = `(e.status = '` + models.RaffleEntryWon + `' OR (e.status = '` + models.RaffleEntryEntered +
+    `' AND NOT EXISTS (SELECT 1 FROM raffles r WHERE r.event_id = e.event_id)))`
+
+// verifiedEntrant restricts raffle entries (aliased e) to users who have verified their email address
+const verifiedEntrant = `EXISTS (SELECT 1 FROM users u WHERE u.id = e.user_id AND u.email_verified_at IS NOT NULL)`
+
+// activeEntrant restricts raffle entries (aliased e) to users whose account isn't suspended
+const activeEntrant = `NOT EXISTS (SELECT 1 FROM users u WHERE u.id = e.user_id AND u.suspended_at IS NOT NULL)`
+
+// teamEntryFilter returns the condition raffle entries must meet to be placed in a team
+func teamEntryFilter() string {
+    if models.RequireVerifiedEmail {
+        return teamEligibleEntry + " AND " + activeEntrant + " AND " + verifiedEntrant
+    }
+    return teamEligibleEntry + " AND " + activeEntrant
+}
+
 // *************************** Repository Methods ***************************
 
 // FetchRaffleEntries fetches the raffle entries for a specific event from the database
 func (r *TeamRepository) FetchRaffleEntries(eventID uint) ([]models.User, error) {
-    rows, err := r.db.Query("SELECT user_id, age, gender, latitude, longitude FROM raffle_entries WHERE event_id = $1 ORDER BY gender, age, latitude, longitude", eventID)
+    rows, err := r.db.Query("SELECT user_id, age, gender, latitude, longitude FROM raffle_entries e WHERE event_id = $1 AND "+teamEntryFilter()+" ORDER BY gender, age, latitude, longitude", eventID)
     if err != nil {
         r.logger.WithFields(logrus.Fields{
             "eventId": eventID,
@@ -57,6 +76,88 @@ func (r *TeamRepository) FetchRaffleEntries(eventID uint) ([]models.User, error)
     return entries, nil
 }
 
+// FetchTeamPreferences retrieves, for the raffle entries of an event taking part in team formation,
+// the friend each entrant asked to be placed in the same team as. Requests naming someone who is no
+// longer a friend are left out.
+func (r *TeamRepository) FetchTeamPreferences(eventID uint) (map[uint]uint, error) {
+    rows, err := r.db.Query(`
+        SELECT e.user_id, e.team_with_user_id
+        FROM raffle_entries e
+        WHERE e.event_id = $1 AND e.team_with_user_id IS NOT NULL AND `+teamEntryFilter()+`
+          AND EXISTS (
+              SELECT 1 FROM friendships f
+              WHERE f.status = $2
+                AND ((f.requester_id = e.user_id AND f.addressee_id = e.team_with_user_id)
+                  OR (f.requester_id = e.team_with_user_id AND f.addressee_id = e.user_id))
+          )
+    `, eventID, models.FriendshipAccepted)
+    if err != nil {
+        r.logger.WithFields(logrus.Fields{
+            "eventId": eventID,
+            "method":  "FetchTeamPreferences",
+        }).Error("Failed to fetch team preferences", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    teamWith := make(map[uint]uint)
+    for rows.Next() {
+        var userID, friendID uint
+        if err := rows.Scan(&userID, &friendID); err != nil {
+            r.logger.WithFields(logrus.Fields{
+                "eventId": eventID,
+                "method":  "FetchTeamPreferences",
+            }).Error("Failed to scan team preference", err)
+            return nil, err
+        }
+        teamWith[userID] = friendID
+    }
+
+    return teamWith, rows.Err()
+}
+
+// FetchTeamBlocks retrieves the pairs of raffle entrants of an event taking part in team formation
+// where one has blocked the other. Each user maps to the entrants they must not share a team with.
+func (r *TeamRepository) FetchTeamBlocks(eventID uint) (map[uint]map[uint]bool, error) {
+    rows, err := r.db.Query(`
+        SELECT b.blocker_id, b.blocked_id
+        FROM user_blocks b
+        JOIN raffle_entries e ON e.user_id = b.blocker_id AND e.event_id = $1
+        JOIN raffle_entries other ON other.user_id = b.blocked_id AND other.event_id = $1
+        WHERE `+teamEntryFilter()+`
+    `, eventID)
+    if err != nil {
+        r.logger.WithFields(logrus.Fields{
+            "eventId": eventID,
+            "method":  "FetchTeamBlocks",
+        }).Error("Failed to fetch team blocks", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    blocks := make(map[uint]map[uint]bool)
+    addBlock := func(userID, otherUserID uint) {
+        if blocks[userID] == nil {
+            blocks[userID] = make(map[uint]bool)
+        }
+        blocks[userID][otherUserID] = true
+    }
+    for rows.Next() {
+        var blockerID, blockedID uint
+        if err := rows.Scan(&blockerID, &blockedID); err != nil {
+            r.logger.WithFields(logrus.Fields{
+                "eventId": eventID,
+                "method":  "FetchTeamBlocks",
+            }).Error("Failed to scan team block", err)
+            return nil, err
+        }
+        addBlock(blockerID, blockedID)
+        addBlock(blockedID, blockerID)
+    }
+
+    return blocks, rows.Err()
+}
+
 // InsertTeams inserts the teams into the database for a specific event
 func (r *TeamRepository) InsertTeams(eventID uint, teams []models.Team) error {
     tx, err := r.db.Begin()
@@ -116,9 +217,9 @@ func (r *TeamRepository) InsertTeams(eventID uint, teams []models.Team) error {
 
 // GetUserByID retrieves a user by their ID from the database
 func (r *TeamRepository) GetUserByID(userID uint) (*models.User, error) {
-    row := r.db.QueryRow("SELECT email, instagram_username, facebook_username, snapchat_username FROM users WHERE id = $1", userID)
+    row := r.db.QueryRow("SELECT email, instagram_username, facebook_username, snapchat_username, COALESCE(avatar_key, '') FROM users WHERE id = $1", userID)
     var user models.User
-    err := row.Scan(&user.Email, &user.InstagramUsername, &user.FacebookUsername, &user.SnapchatUsername)
+    err := row.Scan(&user.Email, &user.InstagramUsername, &user.FacebookUsername, &user.SnapchatUsername, &user.AvatarKey)
     if err != nil {
         if err == sql.ErrNoRows {
             r.logger.WithFields(logrus.Fields{
@@ -141,9 +242,10 @@ func (r *TeamRepository) GetUserByID(userID uint) (*models.User, error) {
 func (r *TeamRepository) FetchUserTeams(userID uint) ([]models.Team, error) {
     rows, err := r.db.Query(`
         SELECT t.event_id, t.team_id, t.created_at,
-            json_agg(json_build_object('userId', u.id, 'username', u.username, 'age', u.age, 'gender', u.gender)) AS members
+            json_agg(json_build_object('userId', u.id, 'username', u.username, 'age', CASE WHEN p.age = 'private' AND u.id <> $1 THEN NULL ELSE u.age END, 'gender', u.gender, 'avatarKey', u.avatar_key)) AS members
         FROM teams t
         JOIN users u ON t.user_id = u.id
+        LEFT JOIN profile_privacy p ON p.user_id = u.id
         WHERE t.team_id IN (
             SELECT DISTINCT team_id
             FROM teams
@@ -192,49 +294,92 @@ func (r *TeamRepository) FetchUserTeams(userID uint) ([]models.Team, error) {
     return teams, nil
 }
 
-// GetTeamsForEvent retrieves the teams for a specific event from the database
-func (r *TeamRepository) GetTeamsForEvent(eventID uint) ([]models.Team, error) {
+// AreTeammates reports whether two users have been placed in the same team for any event
+func (r *TeamRepository) AreTeammates(userID, otherUserID uint) (bool, error) {
+    var teammates bool
+    err := r.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1
+            FROM teams a
+            JOIN teams b ON a.team_id = b.team_id
+            WHERE a.user_id = $1 AND b.user_id = $2
+        )
+    `, userID, otherUserID).Scan(&teammates)
+    if err != nil {
+        r.logger.WithFields(logrus.Fields{
+            "userId":      userID,
+            "otherUserId": otherUserID,
+            "method":      "AreTeammates",
+        }).Error("Failed to check whether users are teammates", err)
+        return false, err
+    }
+    return teammates, nil
+}
+
+// GetTeamMemberProfiles retrieves the profile and privacy settings of every member of an event's
+// teams, ordered by team
+func (r *TeamRepository) GetTeamMemberProfiles(eventID uint) ([]models.TeamMemberProfile, error) {
     rows, err := r.db.Query(`
-        SELECT json_agg(json_build_object('id', team_id, 'members', members)) AS teams
-        FROM (
-            SELECT team_id, json_agg(json_build_object('userId', user_id, 'age', age, 'gender', gender, 'email', email, 'instagram_username', instagram_username, 'facebook_username', facebook_username, 'snapchat_username', snapchat_username)) AS members
-            FROM teams
-            WHERE event_id = $1
-            GROUP BY team_id
-        ) t
+        SELECT t.team_id, u.id, u.username, u.first_name, u.last_name, u.bio, u.interests, u.location, COALESCE(u.age, 0), COALESCE(u.gender, ''),
+               u.instagram_username, u.facebook_username, u.snapchat_username, COALESCE(u.avatar_key, ''), u.created_at,
+               p.email, p.location, p.age, p.instagram_username, p.facebook_username, p.snapchat_username
+        FROM teams t
+        JOIN users u ON u.id = t.user_id
+        LEFT JOIN profile_privacy p ON p.user_id = u.id
+        WHERE t.event_id = $1 AND u.deleted_at IS NULL
+        ORDER BY t.team_id, t.id
     `, eventID)
     if err != nil {
         r.logger.WithFields(logrus.Fields{
             "eventId": eventID,
-            "method":  "GetTeamsForEvent",
-        }).Error("Failed to fetch teams for event", err)
+            "method":  "GetTeamMemberProfiles",
+        }).Error("Failed to fetch team members for event", err)
         return nil, err
     }
     defer rows.Close()
 
-    var teamsJSON string
-    if rows.Next() {
-        err := rows.Scan(&teamsJSON)
+    var members []models.TeamMemberProfile
+    for rows.Next() {
+        var member models.TeamMemberProfile
+        user := &member.User
+        var firstName, lastName, bio, interests, location, instagramUsername, facebookUsername, snapchatUsername sql.NullString
+        var privacy [6]sql.NullString
+        err := rows.Scan(&member.TeamID, &user.ID, &user.Username, &firstName, &lastName, &bio, &interests, &location, &user.Age, &user.Gender,
+            &instagramUsername, &facebookUsername, &snapchatUsername, &user.AvatarKey, &user.CreatedAt,
+            &privacy[0], &privacy[1], &privacy[2], &privacy[3], &privacy[4], &privacy[5])
         if err != nil {
             r.logger.WithFields(logrus.Fields{
                 "eventId": eventID,
-                "method":  "GetTeamsForEvent",
-            }).Error("Failed to scan teams for event", err)
+                "method":  "GetTeamMemberProfiles",
+            }).Error("Failed to scan team member", err)
             return nil, err
         }
-    }
 
-    var teams []models.Team
-    err = json.Unmarshal([]byte(teamsJSON), &teams)
-    if err != nil {
-        r.logger.WithFields(logrus.Fields{
-            "eventId": eventID,
-            "method":  "GetTeamsForEvent",
-        }).Error("Failed to unmarshal teams for event", err)
-        return nil, err
+        if firstName.Valid {
+            user.FirstName = &firstName.String
+        }
+        user.LastName = lastName.String
+        user.Bio = bio.String
+        user.Interests = interests.String
+        user.Location = location.String
+        user.InstagramUsername = instagramUsername.String
+        user.FacebookUsername = facebookUsername.String
+        user.SnapchatUsername = snapchatUsername.String
+
+        // Users without a privacy row have the default settings
+        member.Privacy = models.DefaultProfilePrivacy()
+        settings := []*string{&member.Privacy.Email, &member.Privacy.Location, &member.Privacy.Age,
+            &member.Privacy.InstagramUsername, &member.Privacy.FacebookUsername, &member.Privacy.SnapchatUsername}
+        for i, setting := range settings {
+            if privacy[i].Valid {
+                *setting = privacy[i].String
+            }
+        }
+
+        members = append(members, member)
     }
 
-    return teams, nil
+    return members, rows.Err()
 }
 
 // FetchEventIDsFromRaffleEntries retrieves the distinct event IDs from the raffle entries in the database
@@ -271,9 +416,8 @@ func (r *TeamRepository) FetchEventIDsFromRaffleEntries() ([]uint, error) {
 func (r *TeamRepository) FetchRaffleEntriesByEventID(eventID uint) ([]models.User, error) {
     rows, err := r.db.Query(`
         SELECT user_id, age, gender, latitude, longitude
-        FROM raffle_entries
-        WHERE event_id = $1
-    `, eventID)
+        FROM raffle_entries e
+        WHERE event_id = $1 AND `+teamEntryFilter(), eventID)
     if err != nil {
         r.logger.WithFields(logrus.Fields{
             "eventId": eventID,
@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** TokenRepository ***************************
+
+// TokenRepository represents the repository for refresh token and revocation database operations
+type TokenRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewTokenRepository creates a new instance of TokenRepository
+func NewTokenRepository(db *sql.DB, logger *logrus.Logger) *TokenRepository {
+	return &TokenRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// CreateSession starts a new token family for a user with its first refresh token
+func (r *TokenRepository) CreateSession(userID uint, familyID, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "CreateSession",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO token_families (id, user_id) VALUES ($1, $2)", familyID, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "CreateSession",
+		}).Error("Error creating token family", err)
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO refresh_tokens (family_id, user_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)", familyID, userID, tokenHash, expiresAt)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "CreateSession",
+		}).Error("Error storing refresh token", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same family.
+// Presenting a token that was already used is treated as theft and revokes the whole family.
+func (r *TokenRepository) RotateRefreshToken(tokenHash, newTokenHash string, newExpiresAt time.Time) (userID uint, familyID string, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "RotateRefreshToken",
+		}).Error("Failed to begin transaction", err)
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(`
+        SELECT t.user_id, t.family_id, t.expires_at, t.used_at, f.revoked_at
+        FROM refresh_tokens t
+        JOIN token_families f ON t.family_id = f.id
+        WHERE t.token_hash = $1
+        FOR UPDATE OF t, f
+    `, tokenHash).Scan(&userID, &familyID, &expiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "RotateRefreshToken",
+		}).Error("Error retrieving refresh token", err)
+		return 0, "", err
+	}
+
+	if revokedAt.Valid {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	if usedAt.Valid {
+		r.logger.WithFields(logrus.Fields{
+			"userID":   userID,
+			"familyID": familyID,
+			"method":   "RotateRefreshToken",
+		}).Warn("Refresh token reuse detected, revoking token family")
+		if _, err := tx.Exec("UPDATE token_families SET revoked_at = $1 WHERE id = $2", time.Now(), familyID); err != nil {
+			return 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", err
+		}
+		return 0, "", ErrRefreshTokenReused
+	}
+
+	if time.Now().After(expiresAt) {
+		return 0, "", ErrRefreshTokenExpired
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2", time.Now(), tokenHash)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "RotateRefreshToken",
+		}).Error("Error marking refresh token as used", err)
+		return 0, "", err
+	}
+
+	_, err = tx.Exec("INSERT INTO refresh_tokens (family_id, user_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)", familyID, userID, newTokenHash, newExpiresAt)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "RotateRefreshToken",
+		}).Error("Error storing rotated refresh token", err)
+		return 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	return userID, familyID, nil
+}
+
+// RevokeFamily revokes every refresh token of a session and the access tokens issued for it
+func (r *TokenRepository) RevokeFamily(familyID string) error {
+	_, err := r.db.Exec("UPDATE token_families SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", time.Now(), familyID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"familyID": familyID,
+			"method":   "RevokeFamily",
+		}).Error("Error revoking token family", err)
+	}
+	return err
+}
+
+// RevokeAllForUser revokes every session of a user
+func (r *TokenRepository) RevokeAllForUser(userID uint) error {
+	_, err := r.db.Exec("UPDATE token_families SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", time.Now(), userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "RevokeAllForUser",
+		}).Error("Error revoking user sessions", err)
+	}
+	return err
+}
+
+// RevokeAccessToken revokes a single access token until it expires
+func (r *TokenRepository) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	_, err := r.db.Exec("INSERT INTO revoked_access_tokens (token_id, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING", tokenID, expiresAt)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"tokenID": tokenID,
+			"method":  "RevokeAccessToken",
+		}).Error("Error revoking access token", err)
+	}
+	return err
+}
+
+// IsRevoked reports whether an access token, or the session it belongs to, has been revoked
+func (r *TokenRepository) IsRevoked(tokenID, familyID string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE token_id = $1)
+            OR EXISTS (SELECT 1 FROM token_families WHERE id = $2 AND revoked_at IS NOT NULL)
+    `, tokenID, familyID).Scan(&revoked)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"tokenID": tokenID,
+			"method":  "IsRevoked",
+		}).Error("Error checking token revocation", err)
+		return false, err
+	}
+	return revoked, nil
+}
+
+// PruneExpiredTokens deletes refresh tokens and revocation records that have expired
+func (r *TokenRepository) PruneExpiredTokens(now time.Time) error {
+	if _, err := r.db.Exec("DELETE FROM revoked_access_tokens WHERE expires_at < $1", now); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "PruneExpiredTokens",
+		}).Error("Error pruning revoked access tokens", err)
+		return err
+	}
+	if _, err := r.db.Exec("DELETE FROM refresh_tokens WHERE expires_at < $1", now); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "PruneExpiredTokens",
+		}).Error("Error pruning expired refresh tokens", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package repositories
+
+import (
+	"database/sql"
+	"event-connect/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** TOTPRepository ***************************
+
+// TOTPRepository represents the repository for two-factor authentication database operations
+type TOTPRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewTOTPRepository creates a new instance of TOTPRepository
+func NewTOTPRepository(db *sql.DB, logger *logrus.Logger) *TOTPRepository {
+	return &TOTPRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// GetTOTP retrieves a user's TOTP enrolment, or nil if the user has not started enrolling
+func (r *TOTPRepository) GetTOTP(userID uint) (*models.UserTOTP, error) {
+	var enrolment models.UserTOTP
+	var enabledAt sql.NullTime
+	var lastUsedStep sql.NullInt64
+	err := r.db.QueryRow("SELECT user_id, secret, enabled_at, last_used_step, created_at FROM user_totp WHERE user_id = $1", userID).
+		Scan(&enrolment.UserID, &enrolment.Secret, &enabledAt, &lastUsedStep, &enrolment.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetTOTP",
+		}).Error("Error retrieving TOTP enrolment", err)
+		return nil, err
+	}
+
+	if enabledAt.Valid {
+		enrolment.EnabledAt = &enabledAt.Time
+	}
+	if lastUsedStep.Valid {
+		enrolment.LastUsedStep = &lastUsedStep.Int64
+	}
+	return &enrolment, nil
+}
+
+// IsEnabled reports whether a user has two-factor authentication turned on
+func (r *TOTPRepository) IsEnabled(userID uint) (bool, error) {
+	var enabled bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)", userID).Scan(&enabled)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "IsEnabled",
+		}).Error("Error checking TOTP enrolment", err)
+		return false, err
+	}
+	return enabled, nil
+}
+
+// StartEnrolment stores a new pending secret for a user, replacing any earlier pending one
+func (r *TOTPRepository) StartEnrolment(userID uint, secret string) error {
+	result, err := r.db.Exec(`
+        INSERT INTO user_totp (user_id, secret, created_at) VALUES ($1, $2, $3)
+        ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = NULL
+        WHERE user_totp.enabled_at IS NULL
+    `, userID, secret, time.Now())
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "StartEnrolment",
+		}).Error("Error starting TOTP enrolment", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+	return nil
+}
+
+// Enable turns on two-factor authentication for a user after a confirmed code, replacing their recovery codes
+func (r *TOTPRepository) Enable(userID uint, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "Enable",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE user_totp SET enabled_at = $1, last_used_step = $2 WHERE user_id = $3 AND enabled_at IS NULL", time.Now(), step, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "Enable",
+		}).Error("Error enabling TOTP", err)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "Enable",
+		}).Error("Error storing recovery codes", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable turns off two-factor authentication for a user and deletes their secret and recovery codes
+func (r *TOTPRepository) Disable(userID uint) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "Disable",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "Disable",
+		}).Error("Error deleting recovery codes", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "Disable",
+		}).Error("Error deleting TOTP enrolment", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records that the code for a time step was used. It returns false if that step or a later
+// one was already used, so each code is only accepted once.
+func (r *TOTPRepository) UseStep(userID uint, step int64) (bool, error) {
+	result, err := r.db.Exec("UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND (last_used_step IS NULL OR last_used_step < $1)", step, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "UseStep",
+		}).Error("Error recording TOTP step", err)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It returns false if the code doesn't match.
+func (r *TOTPRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result, err := r.db.Exec("UPDATE user_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL", time.Now(), userID, codeHash)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "UseRecoveryCode",
+		}).Error("Error using recovery code", err)
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// RegenerateRecoveryCodes replaces all of a user's recovery codes
+func (r *TOTPRepository) RegenerateRecoveryCodes(userID uint, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "RegenerateRecoveryCodes",
+		}).Error("Error storing recovery codes", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemainingRecoveryCodes returns how many unused recovery codes a user has
+func (r *TOTPRepository) RemainingRecoveryCodes(userID uint) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "RemainingRecoveryCodes",
+		}).Error("Error counting recovery codes", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID uint, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		if _, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, codeHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
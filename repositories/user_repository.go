@@ -3,7 +3,7 @@ package repositories
 import (
 	"database/sql"
 	"event-connect/models"
-	"fmt"
+	"event-connect/recommend"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -27,8 +27,8 @@ func NewUserRepository(db *sql.DB, logger *logrus.Logger) *UserRepository {
 
 // CreateUser creates a new user in the database
 func (r *UserRepository) CreateUser(user *models.User) error {
-	_, err := r.db.Exec("INSERT INTO users (username, password, email, first_name, last_name, bio, interests, location, latitude, longitude, age, gender, age_min, age_max, distance_preference, instagram_username, facebook_username, snapchat_username, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)",
-		user.Username, user.Password, user.Email, user.FirstName, user.LastName, user.Bio, user.Interests, user.Location, user.Latitude, user.Longitude, user.Age, user.Gender, user.AgeMin, user.AgeMax, user.DistancePreference, user.InstagramUsername, user.FacebookUsername, user.SnapchatUsername, time.Now(), time.Now())
+	err := r.db.QueryRow("INSERT INTO users (username, password, email, first_name, last_name, bio, interests, location, latitude, longitude, age, gender, age_min, age_max, distance_preference, instagram_username, facebook_username, snapchat_username, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) RETURNING id",
+		user.Username, user.Password, user.Email, user.FirstName, user.LastName, user.Bio, user.Interests, user.Location, user.Latitude, user.Longitude, user.Age, user.Gender, user.AgeMin, user.AgeMax, user.DistancePreference, user.InstagramUsername, user.FacebookUsername, user.SnapchatUsername, time.Now(), time.Now()).Scan(&user.ID)
 	if err != nil {
 		r.logger.WithFields(logrus.Fields{
 			"username": user.Username,
@@ -45,23 +45,21 @@ func (r *UserRepository) CreateUser(user *models.User) error {
 	return nil
 }
 
-// GetUserByUsernameAndPassword retrieves a user by their username and password from the database
+// dummyPasswordHash is compared against when a username doesn't exist so that failed logins take
+// the same time whether or not the account exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("event-connect-dummy-password"), bcrypt.DefaultCost)
+
+// GetUserByUsernameAndPassword retrieves a user by their username and password from the database.
+// An unknown username and a wrong password return the same error after the same amount of work.
 func (r *UserRepository) GetUserByUsernameAndPassword(username, password string) (*models.User, error) {
 	query := `SELECT id, username, email, password, created_at, updated_at
               FROM users
-              WHERE username = $1`
+              WHERE username = $1 AND deleted_at IS NULL`
 	row := r.db.QueryRow(query, username)
 
 	var user models.User
 	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			r.logger.WithFields(logrus.Fields{
-				"username": username,
-				"method":   "GetUserByUsernameAndPassword",
-			}).Warn("User not found")
-			return nil, fmt.Errorf("user not found")
-		}
+	if err != nil && err != sql.ErrNoRows {
 		r.logger.WithFields(logrus.Fields{
 			"username": username,
 			"method":   "GetUserByUsernameAndPassword",
@@ -69,13 +67,16 @@ func (r *UserRepository) GetUserByUsernameAndPassword(username, password string)
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
+	passwordHash := dummyPasswordHash
+	if err == nil {
+		passwordHash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(passwordHash, []byte(password)) != nil || err == sql.ErrNoRows {
 		r.logger.WithFields(logrus.Fields{
 			"username": username,
 			"method":   "GetUserByUsernameAndPassword",
-		}).Warn("Invalid password")
-		return nil, fmt.Errorf("invalid password")
+		}).Warn("Invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	return &user, nil
@@ -83,21 +84,24 @@ func (r *UserRepository) GetUserByUsernameAndPassword(username, password string)
 
 // GetUserProfile retrieves a user's profile by their ID from the database
 func (r *UserRepository) GetUserProfile(userID uint) (*models.User, error) {
-	query := `SELECT id, username, email, first_name, last_name, bio, interests, location, latitude, longitude, age, gender, instagram_username, facebook_username, snapchat_username, created_at, updated_at
+	query := `SELECT id, username, email, first_name, last_name, bio, interests, location, latitude, longitude, age, gender, instagram_username, facebook_username, snapchat_username,
+			  COALESCE(age_min, 0), COALESCE(age_max, 0), COALESCE(distance_preference, 0), email_verified_at, COALESCE(avatar_key, ''), created_at, updated_at
 			  FROM users
-			  WHERE id = $1`
+			  WHERE id = $1 AND deleted_at IS NULL`
 
 	row := r.db.QueryRow(query, userID)
 	var user models.User
 	var firstName, lastName, bio, interests, location, instagramUsername, facebookUsername, snapchatUsername sql.NullString
-	err := row.Scan(&user.ID, &user.Username, &user.Email, &firstName, &lastName, &bio, &interests, &location, &user.Latitude, &user.Longitude, &user.Age, &user.Gender, &instagramUsername, &facebookUsername, &snapchatUsername, &user.CreatedAt, &user.UpdatedAt)
+	var emailVerifiedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &firstName, &lastName, &bio, &interests, &location, &user.Latitude, &user.Longitude, &user.Age, &user.Gender, &instagramUsername, &facebookUsername, &snapchatUsername,
+		&user.AgeMin, &user.AgeMax, &user.DistancePreference, &emailVerifiedAt, &user.AvatarKey, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			r.logger.WithFields(logrus.Fields{
 				"userID": userID,
 				"method": "GetUserProfile",
 			}).Warn("User not found")
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		r.logger.WithFields(logrus.Fields{
 			"userID": userID,
@@ -117,13 +121,17 @@ func (r *UserRepository) GetUserProfile(userID uint) (*models.User, error) {
 	user.InstagramUsername = instagramUsername.String
 	user.FacebookUsername = facebookUsername.String
 	user.SnapchatUsername = snapchatUsername.String
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
 
 	return &user, nil
 }
 
+// UpdateUserProfile updates a user's profile. Changing the email address clears its verification.
 func (r *UserRepository) UpdateUserProfile(user *models.User) error {
-	_, err := r.db.Exec("UPDATE users SET username = $1, email = $2, first_name = $3, last_name = $4, bio = $5, interests = $6, location = $7, latitude = $8, longitude = $9, age = $10, gender = $11, updated_at = $12 WHERE id = $13",
-		user.Username, user.Email, user.FirstName, user.LastName, user.Bio, user.Interests, user.Location, user.Latitude, user.Longitude, user.Age, user.Gender, time.Now(), user.ID)
+	_, err := r.db.Exec("UPDATE users SET username = $1, email = $2, first_name = $3, last_name = $4, bio = $5, interests = $6, location = $7, latitude = $8, longitude = $9, age = $10, gender = $11, updated_at = $12, email_verified_at = CASE WHEN email = $2 THEN email_verified_at END, instagram_username = $14, facebook_username = $15, snapchat_username = $16 WHERE id = $13",
+		user.Username, user.Email, user.FirstName, user.LastName, user.Bio, user.Interests, user.Location, user.Latitude, user.Longitude, user.Age, user.Gender, time.Now(), user.ID, user.InstagramUsername, user.FacebookUsername, user.SnapchatUsername)
 	if err != nil {
 		r.logger.WithFields(logrus.Fields{
 			"userID": user.ID,
@@ -138,41 +146,115 @@ func (r *UserRepository) UpdateUserProfile(user *models.User) error {
 	return nil
 }
 
-// GetRecommendedUsers retrieves recommended users based on the user's preferences from the database
-func (r *UserRepository) GetRecommendedUsers(user *models.User) ([]models.User, error) {
+// UpdateUserProfileAndPreferences updates a user's profile and preferences in one statement, so that a
+// failure can't leave one saved without the other. Changing the email address clears its verification.
+func (r *UserRepository) UpdateUserProfileAndPreferences(user *models.User) error {
+	_, err := r.db.Exec(`
+        UPDATE users SET username = $1, email = $2, first_name = $3, last_name = $4, bio = $5, interests = $6, location = $7, latitude = $8,
+            longitude = $9, age = $10, gender = $11, updated_at = $12, email_verified_at = CASE WHEN email = $2 THEN email_verified_at END,
+            instagram_username = $14, facebook_username = $15, snapchat_username = $16, age_min = $17, age_max = $18, distance_preference = $19
+        WHERE id = $13
+    `, user.Username, user.Email, user.FirstName, user.LastName, user.Bio, user.Interests, user.Location, user.Latitude, user.Longitude, user.Age, user.Gender, time.Now(), user.ID,
+		user.InstagramUsername, user.FacebookUsername, user.SnapchatUsername, user.AgeMin, user.AgeMax, user.DistancePreference)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": user.ID,
+			"method": "UpdateUserProfileAndPreferences",
+		}).Error("Error updating user profile", err)
+		return err
+	}
+	return nil
+}
+
+// GetRecommendedUsers retrieves the users who could be recommended to a user, with how many events
+// they registered for in common. Existing teammates, suspended users and users blocked by or blocking
+// the user are left out, and age filters only match users whose age is public. Distance and interest
+// filters are applied when the candidates are scored.
+func (r *UserRepository) GetRecommendedUsers(userID uint, filters recommend.Filters) ([]recommend.Candidate, error) {
 	query := `
-		SELECT id, username, age, latitude, longitude
-		FROM users
-		WHERE id != $1
-		AND age BETWEEN $2 AND $3
-		ORDER BY sqrt(power(radians($4 - longitude) * cos(radians((latitude + $5) / 2)), 2) + power(radians(latitude - $5), 2)) * 6371
-		LIMIT 10
+		SELECT u.id, u.username, u.first_name, u.last_name, u.bio, u.interests, u.location, COALESCE(u.latitude, 0), COALESCE(u.longitude, 0),
+		       COALESCE(u.age, 0), COALESCE(u.gender, ''), u.instagram_username, u.facebook_username, u.snapchat_username, u.created_at,
+		       p.email, p.location, p.age, p.instagram_username, p.facebook_username, p.snapchat_username,
+		       (SELECT COUNT(DISTINCT theirs.event_id)
+		        FROM activities theirs
+		        JOIN activities mine ON mine.event_id = theirs.event_id
+		        WHERE theirs.user_id = u.id AND theirs.activity_type = 'event_registered'
+		          AND mine.user_id = $1 AND mine.activity_type = 'event_registered')
+		FROM users u
+		LEFT JOIN profile_privacy p ON p.user_id = u.id
+		WHERE u.id != $1
+		AND ($2 = 0 OR (u.age >= $2 AND COALESCE(p.age, $6) = 'public'))
+		AND ($3 = 0 OR (u.age <= $3 AND COALESCE(p.age, $6) = 'public'))
+		AND ($4 = '' OR u.gender = $4)
+		AND ($5 = 0 OR EXISTS (
+			SELECT 1 FROM activities e
+			WHERE e.user_id = u.id AND e.event_id = $5 AND e.activity_type = 'event_registered'
+		))
+		AND NOT EXISTS (
+			SELECT 1
+			FROM teams mine
+			JOIN teams theirs ON mine.team_id = theirs.team_id
+			WHERE mine.user_id = $1 AND theirs.user_id = u.id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+		)
+		AND u.suspended_at IS NULL
+		AND u.deleted_at IS NULL
 	`
-	rows, err := r.db.Query(query, user.ID, user.AgeMin, user.AgeMax, user.Longitude, user.Latitude)
+	rows, err := r.db.Query(query, userID, filters.MinAge, filters.MaxAge, filters.Gender, filters.EventID, models.DefaultProfilePrivacy().Age)
 	if err != nil {
 		r.logger.WithFields(logrus.Fields{
-			"userID": user.ID,
+			"userID": userID,
 			"method": "GetRecommendedUsers",
 		}).Error("Error fetching recommended users", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var recommendedUsers []models.User
+	var candidates []recommend.Candidate
 	for rows.Next() {
-		var recommendedUser models.User
-		err := rows.Scan(&recommendedUser.ID, &recommendedUser.Username, &recommendedUser.Age, &recommendedUser.Latitude, &recommendedUser.Longitude)
+		var candidate recommend.Candidate
+		user := &candidate.User
+		var firstName, lastName, bio, interests, location, instagramUsername, facebookUsername, snapchatUsername sql.NullString
+		var privacy [6]sql.NullString
+		err := rows.Scan(&user.ID, &user.Username, &firstName, &lastName, &bio, &interests, &location, &user.Latitude, &user.Longitude,
+			&user.Age, &user.Gender, &instagramUsername, &facebookUsername, &snapchatUsername, &user.CreatedAt,
+			&privacy[0], &privacy[1], &privacy[2], &privacy[3], &privacy[4], &privacy[5], &candidate.SharedEvents)
 		if err != nil {
 			r.logger.WithFields(logrus.Fields{
-				"userID": user.ID,
+				"userID": userID,
 				"method": "GetRecommendedUsers",
 			}).Error("Error scanning recommended user", err)
 			return nil, err
 		}
-		recommendedUsers = append(recommendedUsers, recommendedUser)
+
+		if firstName.Valid {
+			user.FirstName = &firstName.String
+		}
+		user.LastName = lastName.String
+		user.Bio = bio.String
+		user.Interests = interests.String
+		user.Location = location.String
+		user.InstagramUsername = instagramUsername.String
+		user.FacebookUsername = facebookUsername.String
+		user.SnapchatUsername = snapchatUsername.String
+
+		// Users without a privacy row have the default settings
+		candidate.Privacy = models.DefaultProfilePrivacy()
+		settings := []*string{&candidate.Privacy.Email, &candidate.Privacy.Location, &candidate.Privacy.Age,
+			&candidate.Privacy.InstagramUsername, &candidate.Privacy.FacebookUsername, &candidate.Privacy.SnapchatUsername}
+		for i, setting := range settings {
+			if privacy[i].Valid {
+				*setting = privacy[i].String
+			}
+		}
+
+		candidates = append(candidates, candidate)
 	}
 
-	return recommendedUsers, nil
+	return candidates, rows.Err()
 }
 
 // UpdateUserPreferences updates a user's preferences in the database
@@ -209,7 +291,7 @@ func (r *UserRepository) GetUserByID(userID uint) (*models.User, error) {
 				"userID": userID,
 				"method": "GetUserByID",
 			}).Warn("User not found")
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		r.logger.WithFields(logrus.Fields{
 			"userID": userID,
@@ -231,4 +313,295 @@ func (r *UserRepository) GetUserByID(userID uint) (*models.User, error) {
 	user.SnapchatUsername = snapchatUsername.String
 
 	return &user, nil
-}
\ No newline at end of file
+}
+
+// GetUserIDByUsername retrieves the ID of the user with the given username
+func (r *UserRepository) GetUserIDByUsername(username string) (uint, error) {
+	var userID uint
+	err := r.db.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrUserNotFound
+		}
+		r.logger.WithFields(logrus.Fields{
+			"username": username,
+			"method":   "GetUserIDByUsername",
+		}).Error("Error retrieving user ID", err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+// ClaimLockoutNotice records that a user is being told their account was locked and reports whether
+// they haven't already been told since the given time
+func (r *UserRepository) ClaimLockoutNotice(userID uint, now, since time.Time) (bool, error) {
+	result, err := r.db.Exec("UPDATE users SET lockout_notified_at = $1 WHERE id = $2 AND (lockout_notified_at IS NULL OR lockout_notified_at <= $3)", now, userID, since)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "ClaimLockoutNotice",
+		}).Error("Error recording lockout notice", err)
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// GetUserIDByEmail retrieves the ID of the user with the given email address, ignoring case.
+// Accounts pending deletion are not found.
+func (r *UserRepository) GetUserIDByEmail(email string) (uint, error) {
+	var userID uint
+	err := r.db.QueryRow("SELECT id FROM users WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL", email).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrUserNotFound
+		}
+		r.logger.WithFields(logrus.Fields{
+			"method": "GetUserIDByEmail",
+		}).Error("Error retrieving user ID", err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+// IsEmailTaken reports whether an account other than the given user has the email address, ignoring
+// case. Accounts pending deletion keep their address until they are purged, so they count.
+func (r *UserRepository) IsEmailTaken(email string, exceptUserID uint) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2)", email, exceptUserID).Scan(&taken)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": exceptUserID,
+			"method": "IsEmailTaken",
+		}).Error("Error checking email address", err)
+		return false, err
+	}
+	return taken, nil
+}
+
+// UpdatePassword replaces a user's password hash
+func (r *UserRepository) UpdatePassword(userID uint, passwordHash string) error {
+	_, err := r.db.Exec("UPDATE users SET password = $1, updated_at = $2 WHERE id = $3", passwordHash, time.Now(), userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "UpdatePassword",
+		}).Error("Error updating password", err)
+		return err
+	}
+	return nil
+}
+
+// MarkEmailVerified records that a user verified their email address. It returns an error if the
+// user's address is no longer the one that was verified.
+func (r *UserRepository) MarkEmailVerified(userID uint, email string) error {
+	result, err := r.db.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, $1) WHERE id = $2 AND LOWER(email) = LOWER($3)", time.Now(), userID, email)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "MarkEmailVerified",
+		}).Error("Error marking email as verified", err)
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrEmailChanged
+	}
+	return nil
+}
+
+// GetUsersRegisteredForEvent retrieves the fields needed to evaluate raffle eligibility of every user
+// registered for an event, leaving out deleted and suspended accounts
+func (r *UserRepository) GetUsersRegisteredForEvent(eventID uint) ([]models.User, error) {
+	rows, err := r.db.Query(`
+        SELECT u.id, u.username, u.email, COALESCE(u.age, 0), COALESCE(u.latitude, 0), COALESCE(u.longitude, 0)
+        FROM users u
+        WHERE u.deleted_at IS NULL AND u.suspended_at IS NULL
+          AND EXISTS (SELECT 1 FROM activities a WHERE a.user_id = u.id AND a.event_id = $1 AND a.activity_type = 'event_registered')
+    `, eventID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"eventID": eventID,
+			"method":  "GetUsersRegisteredForEvent",
+		}).Error("Error fetching registered users", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Age, &user.Latitude, &user.Longitude); err != nil {
+			r.logger.WithFields(logrus.Fields{
+				"eventID": eventID,
+				"method":  "GetUsersRegisteredForEvent",
+			}).Error("Error scanning user", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// *************************** Profile Privacy ***************************
+
+// GetProfilePrivacy retrieves a user's privacy settings, or the defaults if they have never changed them
+func (r *UserRepository) GetProfilePrivacy(userID uint) (models.ProfilePrivacy, error) {
+	var privacy models.ProfilePrivacy
+	err := r.db.QueryRow("SELECT email, location, age, instagram_username, facebook_username, snapchat_username FROM profile_privacy WHERE user_id = $1", userID).
+		Scan(&privacy.Email, &privacy.Location, &privacy.Age, &privacy.InstagramUsername, &privacy.FacebookUsername, &privacy.SnapchatUsername)
+	if err == sql.ErrNoRows {
+		return models.DefaultProfilePrivacy(), nil
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetProfilePrivacy",
+		}).Error("Error retrieving profile privacy", err)
+		return privacy, err
+	}
+	return privacy, nil
+}
+
+// UpdateProfilePrivacy saves a user's privacy settings
+func (r *UserRepository) UpdateProfilePrivacy(userID uint, privacy models.ProfilePrivacy) error {
+	_, err := r.db.Exec(`
+        INSERT INTO profile_privacy (user_id, email, location, age, instagram_username, facebook_username, snapchat_username, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (user_id) DO UPDATE SET email = $2, location = $3, age = $4, instagram_username = $5, facebook_username = $6, snapchat_username = $7, updated_at = $8
+    `, userID, privacy.Email, privacy.Location, privacy.Age, privacy.InstagramUsername, privacy.FacebookUsername, privacy.SnapchatUsername, time.Now())
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "UpdateProfilePrivacy",
+		}).Error("Error updating profile privacy", err)
+		return err
+	}
+	return nil
+}
+
+// *************************** Suspensions ***************************
+
+// SuspendUser suspends a user's account so they can no longer sign in
+func (r *UserRepository) SuspendUser(userID uint, reason string) error {
+	_, err := r.db.Exec("UPDATE users SET suspended_at = COALESCE(suspended_at, $1), suspension_reason = $2 WHERE id = $3", time.Now(), reason, userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "SuspendUser",
+		}).Error("Error suspending user", err)
+		return err
+	}
+	return nil
+}
+
+// UnsuspendUser lifts the suspension of a user's account
+func (r *UserRepository) UnsuspendUser(userID uint) error {
+	_, err := r.db.Exec("UPDATE users SET suspended_at = NULL, suspension_reason = NULL WHERE id = $1", userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "UnsuspendUser",
+		}).Error("Error lifting user suspension", err)
+		return err
+	}
+	return nil
+}
+
+// GetSuspension retrieves the suspension of a user's account, or nil if it isn't suspended
+func (r *UserRepository) GetSuspension(userID uint) (*models.Suspension, error) {
+	var suspendedAt sql.NullTime
+	var reason sql.NullString
+	err := r.db.QueryRow("SELECT suspended_at, suspension_reason FROM users WHERE id = $1", userID).Scan(&suspendedAt, &reason)
+	if err != nil && err != sql.ErrNoRows {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetSuspension",
+		}).Error("Error retrieving user suspension", err)
+		return nil, err
+	}
+	if !suspendedAt.Valid {
+		return nil, nil
+	}
+	return &models.Suspension{SuspendedAt: suspendedAt.Time, Reason: reason.String}, nil
+}
+
+// IsDeleted reports whether a user has deleted their account and it is waiting to be purged
+func (r *UserRepository) IsDeleted(userID uint) (bool, error) {
+	var deleted bool
+	err := r.db.QueryRow("SELECT deleted_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&deleted)
+	if err != nil && err != sql.ErrNoRows {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "IsDeleted",
+		}).Error("Error checking whether account is deleted", err)
+		return false, err
+	}
+	return deleted, nil
+}
+
+// *************************** Avatars ***************************
+
+// SetAvatarKey records where a user's avatar is stored, or clears it when key is empty, and returns
+// the key of the avatar it replaced so that it can be deleted
+func (r *UserRepository) SetAvatarKey(userID uint, key string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "SetAvatarKey",
+		}).Error("Error beginning transaction", err)
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	err = tx.QueryRow("SELECT avatar_key FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&previous)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrUserNotFound
+		}
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "SetAvatarKey",
+		}).Error("Error retrieving avatar", err)
+		return "", err
+	}
+
+	_, err = tx.Exec("UPDATE users SET avatar_key = NULLIF($1, ''), updated_at = $2 WHERE id = $3", key, time.Now(), userID)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "SetAvatarKey",
+		}).Error("Error updating avatar", err)
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return previous.String, nil
+}
+
+// GetAvatarKey retrieves where a user's avatar is stored, or an empty key when they have none.
+// Unlike GetUserProfile it also finds deleted accounts, so their avatar can be purged.
+func (r *UserRepository) GetAvatarKey(userID uint) (string, error) {
+	var key sql.NullString
+	err := r.db.QueryRow("SELECT avatar_key FROM users WHERE id = $1", userID).Scan(&key)
+	if err != nil && err != sql.ErrNoRows {
+		r.logger.WithFields(logrus.Fields{
+			"userID": userID,
+			"method": "GetAvatarKey",
+		}).Error("Error retrieving avatar", err)
+		return "", err
+	}
+	return key.String, nil
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// *************************** UserTokenRepository ***************************
+
+// UserTokenRepository represents the repository for single-use emailed tokens such as password resets
+type UserTokenRepository struct {
+	db     *sql.DB
+	logger *logrus.Logger
+}
+
+// NewUserTokenRepository creates a new instance of UserTokenRepository
+func NewUserTokenRepository(db *sql.DB, logger *logrus.Logger) *UserTokenRepository {
+	return &UserTokenRepository{db: db, logger: logger}
+}
+
+// *************************** Repository Methods ***************************
+
+// CreateToken stores a new token for a user, invalidating any unused token issued for the same purpose
+func (r *UserTokenRepository) CreateToken(userID uint, purpose, tokenHash string, expiresAt time.Time) error {
+	return r.createToken(userID, purpose, tokenHash, nil, expiresAt)
+}
+
+// CreateEmailToken stores a new token for a user like CreateToken, along with the email address it was sent to
+func (r *UserTokenRepository) CreateEmailToken(userID uint, purpose, tokenHash, email string, expiresAt time.Time) error {
+	return r.createToken(userID, purpose, tokenHash, &email, expiresAt)
+}
+
+func (r *UserTokenRepository) createToken(userID uint, purpose, tokenHash string, email *string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"purpose": purpose,
+			"method":  "CreateToken",
+		}).Error("Failed to begin transaction", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL", now, userID, purpose)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"purpose": purpose,
+			"method":  "CreateToken",
+		}).Error("Error invalidating previous tokens", err)
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)", userID, purpose, tokenHash, email, expiresAt, now)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"purpose": purpose,
+			"method":  "CreateToken",
+		}).Error("Error storing token", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeToken marks an unused, unexpired token as used and returns the user it was issued to.
+// A token can only be consumed once.
+func (r *UserTokenRepository) ConsumeToken(purpose, tokenHash string) (uint, error) {
+	userID, _, err := r.ConsumeEmailToken(purpose, tokenHash)
+	return userID, err
+}
+
+// ConsumeEmailToken consumes a token like ConsumeToken and also returns the email address it was sent to,
+// which is empty for tokens stored without one
+func (r *UserTokenRepository) ConsumeEmailToken(purpose, tokenHash string) (uint, string, error) {
+	var userID uint
+	var email sql.NullString
+	now := time.Now()
+	err := r.db.QueryRow(`
+        UPDATE user_tokens SET used_at = $1
+        WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+        RETURNING user_id, email
+    `, now, tokenHash, purpose).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidToken
+	}
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"purpose": purpose,
+			"method":  "ConsumeToken",
+		}).Error("Error consuming token", err)
+		return 0, "", err
+	}
+	return userID, email.String, nil
+}
+
+// CountRecentTokens returns how many tokens were issued to a user for a purpose since the given time
+func (r *UserTokenRepository) CountRecentTokens(userID uint, purpose string, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at > $3", userID, purpose, since).Scan(&count)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"userID":  userID,
+			"purpose": purpose,
+			"method":  "CountRecentTokens",
+		}).Error("Error counting recent tokens", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// PruneTokens deletes tokens that expired before the given time
+func (r *UserTokenRepository) PruneTokens(expiredBefore time.Time) error {
+	_, err := r.db.Exec("DELETE FROM user_tokens WHERE expires_at < $1", expiredBefore)
+	if err != nil {
+		r.logger.WithFields(logrus.Fields{
+			"method": "PruneTokens",
+		}).Error("Error pruning user tokens", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"event-connect/handlers"
+	"event-connect/models"
+	"event-connect/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// AdminRoutes sets up the role, event organiser and account suspension management routes for the application
+func AdminRoutes(r *mux.Router, roleRepo *repositories.RoleRepository, userRepo *repositories.UserRepository, tokenRepo *repositories.TokenRepository, authMiddleware alice.Chain) {
+	adminMiddleware := authMiddleware.Append(RequireRole(models.RoleAdmin))
+
+	r.Handle("/admin/users/{userId:[0-9]+}/roles", adminMiddleware.Then(handlers.GetUserRoles(roleRepo))).Methods("GET")
+	r.Handle("/admin/users/{userId:[0-9]+}/roles/{role}", adminMiddleware.Then(handlers.GrantUserRole(roleRepo, userRepo))).Methods("PUT")
+	r.Handle("/admin/users/{userId:[0-9]+}/roles/{role}", adminMiddleware.Then(handlers.RevokeUserRole(roleRepo, userRepo))).Methods("DELETE")
+
+	r.Handle("/admin/users/{userId:[0-9]+}/suspension", adminMiddleware.Then(handlers.GetUserSuspension(userRepo))).Methods("GET")
+	r.Handle("/admin/users/{userId:[0-9]+}/suspension", adminMiddleware.Then(handlers.SuspendUser(userRepo, tokenRepo))).Methods("PUT")
+	r.Handle("/admin/users/{userId:[0-9]+}/suspension", adminMiddleware.Then(handlers.UnsuspendUser(userRepo))).Methods("DELETE")
+
+	r.Handle("/admin/events/{eventId:[0-9]+}/organisers", adminMiddleware.Then(handlers.GetEventOrganisers(roleRepo))).Methods("GET")
+	r.Handle("/admin/events/{eventId:[0-9]+}/organisers/{userId:[0-9]+}", adminMiddleware.Then(handlers.AddEventOrganiser(roleRepo))).Methods("PUT")
+	r.Handle("/admin/events/{eventId:[0-9]+}/organisers/{userId:[0-9]+}", adminMiddleware.Then(handlers.RemoveEventOrganiser(roleRepo))).Methods("DELETE")
+}
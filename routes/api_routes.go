@@ -1,13 +1,12 @@
 package routes
 
 import (
-    "encoding/json"
-    "log"
     "net/http"
 
-    "event-connect/auth"
+    "event-connect/geo"
     "event-connect/repositories"
     "event-connect/handlers"
+    "event-connect/storage"
 
     "github.com/gorilla/mux"
     "github.com/justinas/alice"
@@ -17,16 +16,48 @@ import (
 
 // APIRoutes sets up the API routes for the application
 func APIRoutes(r *mux.Router, userRepo *repositories.UserRepository, activityRepo *repositories.ActivityRepository,
-    teamRepo *repositories.TeamRepository, raffleRepo *repositories.RaffleRepository, authMiddleware alice.Chain, eventHandler *handlers.EventHandler) {
+    teamRepo *repositories.TeamRepository, raffleRepo *repositories.RaffleRepository, commentRepo *repositories.CommentRepository,
+    tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository, userTokenRepo *repositories.UserTokenRepository, loginAttemptRepo *repositories.LoginAttemptRepository, totpRepo *repositories.TOTPRepository, friendRepo *repositories.FriendRepository, blockRepo *repositories.BlockRepository, accountRepo *repositories.AccountRepository, authMiddleware alice.Chain, eventHandler *handlers.EventHandler, notifier *handlers.Notifier, locationFuzzer *geo.LocationFuzzer, geocoder geo.Geocoder, avatarStore storage.BlobStore) {
+
+    // Organiser-only routes are limited to admins and the organisers of the event
+    organiserMiddleware := authMiddleware.Append(RequireEventOrganiser(roleRepo))
+
+    // Routes open to everyone that tailor the response to signed-in users
+    optionalAuthMiddleware := NewOptionalAuthMiddleware(tokenRepo)
 
     // ********** Login Route **********
     r.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-        handlers.Login(userRepo, w, r)
+        handlers.Login(userRepo, tokenRepo, roleRepo, loginAttemptRepo, userTokenRepo, totpRepo, w, r)
     }).Methods("POST")
 
+    r.HandleFunc("/login/2fa", handlers.LoginWithTwoFactor(userRepo, tokenRepo, roleRepo, totpRepo, loginAttemptRepo, userTokenRepo)).Methods("POST")
+    r.HandleFunc("/token/refresh", handlers.RefreshToken(tokenRepo, roleRepo)).Methods("POST")
+    r.Handle("/logout", authMiddleware.Then(handlers.Logout(tokenRepo))).Methods("POST")
+
+    r.HandleFunc("/password/forgot", handlers.ForgotPassword(userRepo, userTokenRepo)).Methods("POST")
+    r.HandleFunc("/password/reset", handlers.ResetPassword(userRepo, userTokenRepo, tokenRepo, loginAttemptRepo)).Methods("POST")
+
+    // ********** Two-Factor Authentication Routes **********
+    r.Handle("/2fa", authMiddleware.Then(handlers.GetTwoFactorStatus(totpRepo))).Methods("GET")
+    r.Handle("/2fa/enroll", authMiddleware.Then(handlers.EnrollTwoFactor(userRepo, totpRepo))).Methods("POST")
+    r.Handle("/2fa/enable", authMiddleware.Then(handlers.EnableTwoFactor(totpRepo))).Methods("POST")
+    r.Handle("/2fa/disable", authMiddleware.Then(handlers.DisableTwoFactor(userRepo, totpRepo, loginAttemptRepo, userTokenRepo))).Methods("POST")
+    r.Handle("/2fa/recovery-codes", authMiddleware.Then(handlers.RegenerateRecoveryCodes(totpRepo))).Methods("POST")
+
+    r.HandleFunc("/verify-email", handlers.VerifyEmail(userRepo, userTokenRepo)).Methods("GET")
+    r.HandleFunc("/account/unlock", handlers.UnlockAccount(userRepo, userTokenRepo, loginAttemptRepo)).Methods("GET")
+    r.Handle("/account/login-attempts", authMiddleware.Then(handlers.GetLoginAttempts(loginAttemptRepo))).Methods("GET")
+
+    // ********** Account Export and Deletion Routes **********
+    r.Handle("/account/export", authMiddleware.Then(handlers.ExportAccountData(accountRepo))).Methods("GET")
+    r.Handle("/account", authMiddleware.Then(handlers.DeleteAccount(accountRepo, userRepo, userTokenRepo, totpRepo, loginAttemptRepo, notifier))).Methods("DELETE")
+    r.HandleFunc("/account/restore", handlers.RestoreAccount(accountRepo, userTokenRepo)).Methods("GET")
+
+    r.Handle("/verify-email/resend", authMiddleware.Then(handlers.ResendVerificationEmail(userRepo, userTokenRepo))).Methods("POST")
+
     // ********** User Routes **********
     r.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
-        handlers.CreateUser(userRepo)(w, r)
+        handlers.CreateUser(userRepo, tokenRepo, roleRepo, userTokenRepo, geocoder)(w, r)
     }).Methods("POST")
 
     r.Handle("/user", authMiddleware.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -34,49 +65,53 @@ func APIRoutes(r *mux.Router, userRepo *repositories.UserRepository, activityRep
     }))).Methods("GET")
 
     r.Handle("/profile", authMiddleware.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        handlers.GetUserProfile(userRepo, activityRepo, teamRepo)(w, r)
+        handlers.GetUserProfile(userRepo, activityRepo, teamRepo, avatarStore)(w, r)
     }))).Methods("GET")
 
     r.Handle("/profile", authMiddleware.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        handlers.UpdateUserProfile(userRepo)(w, r)
+        handlers.UpdateUserProfile(userRepo, userTokenRepo, geocoder)(w, r)
     }))).Methods("PUT")
 
-    r.HandleFunc("/other-user-profile", func(w http.ResponseWriter, r *http.Request) {
-        handlers.GetOtherUserProfile(userRepo)(w, r)
-    }).Methods("GET")
+    r.Handle("/profile", authMiddleware.Then(handlers.PatchUserProfile(userRepo, userTokenRepo, geocoder, avatarStore))).Methods("PATCH")
+
+    r.Handle("/profile/avatar", authMiddleware.Then(handlers.UploadAvatar(userRepo, avatarStore))).Methods("POST")
+    r.Handle("/profile/avatar", authMiddleware.Then(handlers.DeleteAvatar(userRepo, avatarStore))).Methods("DELETE")
+
+    r.Handle("/profile/privacy", authMiddleware.Then(handlers.GetProfilePrivacy(userRepo))).Methods("GET")
+    r.Handle("/profile/privacy", authMiddleware.Then(handlers.UpdateProfilePrivacy(userRepo))).Methods("PUT")
+
+    r.Handle("/other-user-profile", authMiddleware.Then(handlers.GetOtherUserProfile(userRepo, teamRepo, avatarStore))).Methods("GET")
+
+    r.Handle("/recommendations/users", authMiddleware.Then(handlers.GetUserRecommendations(userRepo))).Methods("GET")
+    r.Handle("/recommendations/events", authMiddleware.Then(handlers.GetEventRecommendations(activityRepo, userRepo))).Methods("GET")
 
     // ********** Event Routes **********
     r.HandleFunc("/events", eventHandler.GetEvents).Methods("GET")
     r.HandleFunc("/events/{eventId}", eventHandler.GetEventByID).Methods("GET")
+    r.HandleFunc("/events/{eventId}/also-registered", handlers.GetAlsoRegisteredEvents(activityRepo)).Methods("GET")
     r.Handle("/events/{eventId}/register", authMiddleware.Then(http.HandlerFunc(eventHandler.RegisterEvent))).Methods("POST")
 
-    r.HandleFunc("/events/{eventId}/user-locations", func(w http.ResponseWriter, r *http.Request) {
-        params := mux.Vars(r)
-        eventID := params["eventId"]
-
-        userLocations, err := activityRepo.GetUserLocationsForEvent(eventID)
-        if err != nil {
-            log.Printf("Error fetching user locations for event: %v", err)
-            http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-            return
-        }
-
-        log.Printf("User locations for event %s: %+v", eventID, userLocations)
-
-        w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(userLocations)
-    }).Methods("GET")
+    r.Handle("/events/{eventId}/user-locations", authMiddleware.Then(handlers.GetUserLocationsForEvent(activityRepo, locationFuzzer))).Methods("GET")
 
     // ********** Comment Routes **********
-    r.HandleFunc("/events/{eventId}/comments", handlers.CreateComment).Methods("POST")
-    r.HandleFunc("/events/{eventId}/comments", handlers.GetComments).Methods("GET")
+    r.Handle("/events/{eventId}/comments", authMiddleware.Then(handlers.CreateComment(commentRepo, blockRepo, notifier))).Methods("POST")
+    r.Handle("/events/{eventId}/comments", optionalAuthMiddleware.Then(handlers.GetComments(commentRepo))).Methods("GET")
 
     // ********** Team Routes **********
-    r.HandleFunc("/events/{eventId}/teams", handlers.GetTeamsForEvent(teamRepo)).Methods("GET")
-    r.HandleFunc("/trigger-create-teams/{eventId}", handlers.TriggerCreateTeams(teamRepo)).Methods("POST")
+    r.Handle("/events/{eventId}/teams", authMiddleware.Then(handlers.GetTeamsForEvent(teamRepo, roleRepo, avatarStore))).Methods("GET")
+    r.Handle("/trigger-create-teams/{eventId}", organiserMiddleware.Then(handlers.TriggerCreateTeams(teamRepo, notifier, avatarStore))).Methods("POST")
 
     // ********** Raffle Routes **********
-    r.HandleFunc("/events/{eventId}/raffle", func(w http.ResponseWriter, r *http.Request) {
-        handlers.EnterRaffle(raffleRepo, auth.GetUserIDFromToken)(w, r)
-    }).Methods("POST")
+    r.Handle("/events/{eventId}/raffle", authMiddleware.Then(handlers.EnterRaffle(raffleRepo, userRepo, activityRepo, friendRepo))).Methods("POST")
+    r.Handle("/events/{eventId}/raffle", authMiddleware.Then(handlers.AmendRaffleEntry(raffleRepo, userRepo, activityRepo, friendRepo))).Methods("PUT")
+    r.Handle("/events/{eventId}/raffle", authMiddleware.Then(handlers.WithdrawRaffleEntry(raffleRepo))).Methods("DELETE")
+    r.HandleFunc("/events/{eventId}/raffle", handlers.GetRaffle(raffleRepo)).Methods("GET")
+    r.Handle("/events/{eventId}/raffle/settings", organiserMiddleware.Then(handlers.UpdateRaffleSettings(raffleRepo))).Methods("PUT")
+    r.HandleFunc("/events/{eventId}/raffle/draw", handlers.GetRaffleDraw(raffleRepo)).Methods("GET")
+    r.Handle("/events/{eventId}/raffle/draw", organiserMiddleware.Then(handlers.TriggerRaffleDraw(raffleRepo, notifier))).Methods("POST")
+    r.Handle("/events/{eventId}/raffle/rules", organiserMiddleware.Then(handlers.GetRaffleRules(raffleRepo))).Methods("GET")
+    r.Handle("/events/{eventId}/raffle/rules", organiserMiddleware.Then(handlers.UpdateRaffleRules(raffleRepo))).Methods("PUT")
+    r.Handle("/events/{eventId}/raffle/rules/preview", organiserMiddleware.Then(handlers.PreviewRaffleRules(raffleRepo, userRepo))).Methods("POST")
+    r.Handle("/events/{eventId}/raffle/entry", authMiddleware.Then(handlers.GetRaffleEntry(raffleRepo))).Methods("GET")
+    r.Handle("/events/{eventId}/raffle/decline", authMiddleware.Then(handlers.DeclineRafflePlace(raffleRepo, notifier))).Methods("POST")
 }
\ No newline at end of file
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"event-connect/handlers"
+	"event-connect/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// FriendRoutes sets up the routes for friendships between users
+func FriendRoutes(r *mux.Router, friendRepo *repositories.FriendRepository, blockRepo *repositories.BlockRepository, userRepo *repositories.UserRepository, notifier *handlers.Notifier, authMiddleware alice.Chain) {
+	r.Handle("/friends", authMiddleware.Then(handlers.GetFriends(friendRepo))).Methods("GET")
+	r.Handle("/friends/{userId:[0-9]+}", authMiddleware.Then(handlers.RemoveFriend(friendRepo))).Methods("DELETE")
+
+	r.Handle("/friends/requests", authMiddleware.Then(handlers.GetFriendRequests(friendRepo))).Methods("GET")
+	r.Handle("/friends/requests", authMiddleware.Then(handlers.SendFriendRequest(friendRepo, blockRepo, userRepo, notifier))).Methods("POST")
+	r.Handle("/friends/requests/{userId:[0-9]+}/accept", authMiddleware.Then(handlers.AcceptFriendRequest(friendRepo, userRepo, notifier))).Methods("POST")
+	r.Handle("/friends/requests/{userId:[0-9]+}/decline", authMiddleware.Then(handlers.DeclineFriendRequest(friendRepo))).Methods("POST")
+
+	r.Handle("/events/{eventId:[0-9]+}/friends", authMiddleware.Then(handlers.GetFriendsAttendingEvent(friendRepo))).Methods("GET")
+}
@@ -15,6 +15,7 @@ func HTMLFileRoutes(r *mux.Router) {
 	serveHTMLFile(r, "/event-comments.html", "html/event-comments.html")
 	serveHTMLFile(r, "/other-user-profile.html", "html/other-user-profile.html")
 	serveHTMLFile(r, "/recommendations.html", "html/recommendations.html")
+	serveHTMLFile(r, "/reset-password.html", "html/reset-password.html")
 }
 
 func serveHTMLFile(r *mux.Router, path, filename string) {
@@ -1,10 +1,16 @@
 package routes
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 
 	"event-connect/auth"
+	"event-connect/handlers"
+	"event-connect/models"
+	"event-connect/repositories"
+	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 )
 
@@ -15,13 +21,136 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-var AuthMiddleware = alice.New(func(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := auth.GetUserIDFromToken(r)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next.ServeHTTP(w, r)
+// NewAuthMiddleware rejects requests without a valid access token, including tokens that
+// were revoked individually or whose session was revoked. The authenticated principal is
+// stored in the request context for handlers to read with auth.PrincipalFromContext.
+func NewAuthMiddleware(tokenRepo *repositories.TokenRepository) alice.Chain {
+	return alice.New(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := auth.ParseRequestToken(r)
+			if err != nil {
+				writeUnauthorized(w, "Missing or invalid access token")
+				return
+			}
+
+			revoked, err := tokenRepo.IsRevoked(claims.Id, claims.SessionID)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				writeUnauthorized(w, "Access token has been revoked")
+				return
+			}
+
+			principal, err := auth.PrincipalFromClaims(claims)
+			if err != nil {
+				writeUnauthorized(w, "Missing or invalid access token")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	})
+}
+
+// NewOptionalAuthMiddleware stores the authenticated principal in the request context when the
+// request has a valid access token, and lets requests without one through anonymously
+func NewOptionalAuthMiddleware(tokenRepo *repositories.TokenRepository) alice.Chain {
+	return alice.New(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := auth.ParseRequestToken(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			revoked, err := tokenRepo.IsRevoked(claims.Id, claims.SessionID)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			principal, err := auth.PrincipalFromClaims(claims)
+			if revoked || err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
 	})
-})
\ No newline at end of file
+}
+
+// RequireRole only lets through requests whose principal holds at least one of the given roles.
+// It must run after the auth middleware, e.g. authMiddleware.Append(RequireRole(models.RoleAdmin)).
+func RequireRole(roles ...string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "Missing or invalid access token")
+				return
+			}
+
+			for _, role := range roles {
+				if principal.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeForbidden(w, "You do not have permission to perform this action")
+		})
+	}
+}
+
+// RequireEventOrganiser only lets through admins and organisers who manage the event in the
+// request's {eventId} path parameter. It must run after the auth middleware.
+func RequireEventOrganiser(roleRepo *repositories.RoleRepository) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "Missing or invalid access token")
+				return
+			}
+
+			if principal.HasRole(models.RoleAdmin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			eventID, err := strconv.ParseUint(mux.Vars(r)["eventId"], 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid event ID", http.StatusBadRequest)
+				return
+			}
+
+			if principal.HasRole(models.RoleOrganiser) {
+				manages, err := roleRepo.IsEventOrganiser(principal.UserID, uint(eventID))
+				if err != nil {
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				if manages {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeForbidden(w, "Only organisers of this event can perform this action")
+		})
+	}
+}
+
+// writeUnauthorized writes a 401 response in the same JSON shape as other API errors
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(handlers.APIError{Error: "unauthorized", Message: message})
+}
+
+// writeForbidden writes a 403 response in the same JSON shape as other API errors
+func writeForbidden(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(handlers.APIError{Error: "forbidden", Message: message})
+}
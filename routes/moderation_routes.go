@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"event-connect/handlers"
+	"event-connect/models"
+	"event-connect/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// ModerationRoutes sets up the routes for blocking and reporting users, and the moderator queue of reports
+func ModerationRoutes(r *mux.Router, blockRepo *repositories.BlockRepository, reportRepo *repositories.ReportRepository, userRepo *repositories.UserRepository, authMiddleware alice.Chain) {
+	moderatorMiddleware := authMiddleware.Append(RequireRole(models.RoleModerator, models.RoleAdmin))
+
+	r.Handle("/blocks", authMiddleware.Then(handlers.GetBlockedUsers(blockRepo))).Methods("GET")
+	r.Handle("/blocks/{userId:[0-9]+}", authMiddleware.Then(handlers.BlockUser(blockRepo, userRepo))).Methods("PUT")
+	r.Handle("/blocks/{userId:[0-9]+}", authMiddleware.Then(handlers.UnblockUser(blockRepo))).Methods("DELETE")
+
+	r.Handle("/reports", authMiddleware.Then(handlers.ReportUser(reportRepo, userRepo))).Methods("POST")
+
+	r.Handle("/moderation/reports", moderatorMiddleware.Then(handlers.GetReports(reportRepo))).Methods("GET")
+	r.Handle("/moderation/reports/{reportId:[0-9]+}/resolve", moderatorMiddleware.Then(handlers.ResolveReport(reportRepo))).Methods("POST")
+}
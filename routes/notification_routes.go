@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"event-connect/handlers"
+	"event-connect/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// NotificationRoutes sets up the notification centre routes for the application
+func NotificationRoutes(r *mux.Router, notificationRepo *repositories.NotificationRepository, authMiddleware alice.Chain) {
+	r.Handle("/notifications", authMiddleware.Then(handlers.GetNotifications(notificationRepo))).Methods("GET")
+	r.Handle("/notifications/unread-count", authMiddleware.Then(handlers.GetUnreadNotificationCount(notificationRepo))).Methods("GET")
+	r.Handle("/notifications/read-all", authMiddleware.Then(handlers.MarkAllNotificationsRead(notificationRepo))).Methods("POST")
+	r.Handle("/notifications/{notificationId:[0-9]+}/read", authMiddleware.Then(handlers.MarkNotificationRead(notificationRepo))).Methods("POST")
+
+	r.Handle("/notifications/preferences", authMiddleware.Then(handlers.GetNotificationPreferences(notificationRepo))).Methods("GET")
+	r.Handle("/notifications/preferences", authMiddleware.Then(handlers.UpdateNotificationPreferences(notificationRepo))).Methods("PUT")
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"event-connect/handlers"
+	"event-connect/oidc"
+	"event-connect/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// OIDCRoutes sets up the "sign in with" routes for the configured OpenID Connect providers
+func OIDCRoutes(r *mux.Router, providers map[string]*oidc.Provider, identityRepo *repositories.IdentityRepository, userRepo *repositories.UserRepository,
+	tokenRepo *repositories.TokenRepository, roleRepo *repositories.RoleRepository, totpRepo *repositories.TOTPRepository,
+	loginAttemptRepo *repositories.LoginAttemptRepository, authMiddleware alice.Chain) {
+	r.HandleFunc("/auth/oidc/providers", handlers.GetOIDCProviders(providers)).Methods("GET")
+	r.HandleFunc("/auth/oidc/{provider}/login", handlers.OIDCLogin(providers, identityRepo)).Methods("GET")
+	r.HandleFunc("/auth/oidc/{provider}/callback", handlers.OIDCCallback(providers, identityRepo, userRepo, tokenRepo, roleRepo, totpRepo, loginAttemptRepo)).Methods("GET")
+
+	r.Handle("/account/identities", authMiddleware.Then(handlers.GetLinkedIdentities(identityRepo))).Methods("GET")
+}
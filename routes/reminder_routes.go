@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"event-connect/handlers"
+	"event-connect/repositories"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+)
+
+// ReminderRoutes sets up the event reminder settings routes for the application
+func ReminderRoutes(r *mux.Router, reminderRepo *repositories.ReminderRepository, authMiddleware alice.Chain) {
+	r.Handle("/reminders/settings", authMiddleware.Then(handlers.GetReminderSettings(reminderRepo))).Methods("GET")
+	r.Handle("/reminders/settings", authMiddleware.Then(handlers.UpdateReminderSettings(reminderRepo))).Methods("PUT")
+}
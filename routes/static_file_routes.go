@@ -13,11 +13,19 @@ func StaticFileRoutes(r *mux.Router) {
 	r.PathPrefix("/css/").Handler(cssHandler)
 
 	// Serve JavaScript files
+	serveJSFile(r, "/auth.js")
 	serveJSFile(r, "/events.js")
 	serveJSFile(r, "/event-details.js")
 	serveJSFile(r, "/profile.js")
 	serveJSFile(r, "/login.js")
 	serveJSFile(r, "/event-comments.js")
+	serveJSFile(r, "/reset-password.js")
+	serveJSFile(r, "/recommendations.js")
+}
+
+// UploadRoutes serves uploaded files, such as avatars, from /uploads/
+func UploadRoutes(r *mux.Router, uploads http.Handler) {
+	r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", uploads))
 }
 
 func serveJSFile(r *mux.Router, path string) {
@@ -0,0 +1,129 @@
+// Package storage stores uploaded files, such as avatars, behind an interface so that the local
+// disk can later be swapped for an object store without changing the handlers.
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is returned for keys that are empty, absolute or could step outside the store
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores blobs under slash-separated keys such as "avatars/42/abc_256.jpg"
+type BlobStore interface {
+	// Put stores a blob, replacing any blob with the same key
+	Put(key string, data io.Reader, contentType string) error
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(key string) error
+	// URL returns the address the blob is served from
+	URL(key string) string
+}
+
+// LocalDisk stores blobs as files under a directory and serves them over HTTP
+type LocalDisk struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalDisk creates a store in dir, creating the directory if needed. Blobs are served from
+// baseURL, which is where the store's handler should be mounted.
+func NewLocalDisk(dir, baseURL string) (*LocalDisk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalDisk{dir: dir, baseURL: strings.TrimRight(baseURL, "/") + "/"}, nil
+}
+
+// NewLocalDiskFromEnv creates a store in UPLOAD_DIR (default "uploads") served from /uploads/
+func NewLocalDiskFromEnv() (*LocalDisk, error) {
+	dir := os.Getenv("UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	return NewLocalDisk(dir, "/uploads/")
+}
+
+// Put writes the blob to a temporary file and renames it into place, so a blob is never served half written.
+// The content type isn't stored; it is worked out from the key's extension when the blob is served.
+func (d *LocalDisk) Put(key string, data io.Reader, contentType string) error {
+	filename, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// Delete removes the blob's file
+func (d *LocalDisk) Delete(key string) error {
+	filename, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL returns the path the blob is served from
+func (d *LocalDisk) URL(key string) string {
+	return d.baseURL + key
+}
+
+// ServeHTTP serves the blob named by the request path, relative to where the handler is mounted.
+// Directories are never listed. Keys are never reused for different content, so blobs can be cached indefinitely.
+func (d *LocalDisk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filename, err := d.path(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filename)
+}
+
+// path maps a key to a file under the store's directory. Segments starting with a dot are
+// rejected, which rules out ".." and the temporary files Put writes.
+func (d *LocalDisk) path(key string) (string, error) {
+	if strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || strings.HasPrefix(segment, ".") {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestDisk(t *testing.T) *LocalDisk {
+	t.Helper()
+
+	disk, err := NewLocalDisk(t.TempDir(), "/uploads/")
+	if err != nil {
+		t.Fatalf("NewLocalDisk: %v", err)
+	}
+	return disk
+}
+
+func TestPathRejectsInvalidKeys(t *testing.T) {
+	disk := newTestDisk(t)
+
+	keys := []string{"", "../x", "a/../b", "a/..", "a\\b", "..\\x", "/abs", "a/", ".hidden", "a/.upload-1", "a//b"}
+	for _, key := range keys {
+		if filename, err := disk.path(key); err != ErrInvalidKey {
+			t.Errorf("path(%q) = %q, %v, want ErrInvalidKey", key, filename, err)
+		}
+	}
+}
+
+func TestPathMapsKeysUnderDirectory(t *testing.T) {
+	disk := newTestDisk(t)
+
+	filename, err := disk.path("avatars/42/abc_256.jpg")
+	if err != nil {
+		t.Fatalf("path: %v", err)
+	}
+	if want := filepath.Join(disk.dir, "avatars", "42", "abc_256.jpg"); filename != want {
+		t.Errorf("path() = %q, want %q", filename, want)
+	}
+}
+
+func TestPutAndDeleteRejectInvalidKeys(t *testing.T) {
+	disk := newTestDisk(t)
+
+	if err := disk.Put("../escaped.jpg", strings.NewReader("data"), "image/jpeg"); err != ErrInvalidKey {
+		t.Errorf("Put() = %v, want ErrInvalidKey", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(disk.dir), "escaped.jpg")); err == nil {
+		t.Error("Put wrote a file outside the store")
+	}
+	if err := disk.Delete("a/../b"); err != ErrInvalidKey {
+		t.Errorf("Delete() = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestPutServeDelete(t *testing.T) {
+	disk := newTestDisk(t)
+	key := "avatars/42/abc_256.jpg"
+
+	if err := disk.Put(key, strings.NewReader("data"), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if url := disk.URL(key); url != "/uploads/"+key {
+		t.Errorf("URL() = %q, want %q", url, "/uploads/"+key)
+	}
+
+	rec := httptest.NewRecorder()
+	disk.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "data" {
+		t.Errorf("ServeHTTP() = %d %q, want 200 %q", rec.Code, rec.Body.String(), "data")
+	}
+
+	// Directories aren't listed
+	rec = httptest.NewRecorder()
+	disk.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/avatars/42", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("ServeHTTP() of a directory = %d, want 404", rec.Code)
+	}
+
+	if err := disk.Delete(key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := disk.Delete(key); err != nil {
+		t.Errorf("Delete() of a missing blob = %v, want nil", err)
+	}
+	rec = httptest.NewRecorder()
+	disk.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("ServeHTTP() after Delete = %d, want 404", rec.Code)
+	}
+}
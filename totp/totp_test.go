@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// The test vectors of RFC 6238 appendix B for SHA-1, cut to the last six of their eight digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(vector.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if code != vector.code {
+			t.Errorf("Code() at %d = %s, want %s", vector.unix, code, vector.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code := "050471"
+
+	step, ok := Validate(rfcSecret, code, now)
+	if !ok || step != Step(now) {
+		t.Fatalf("Validate() = %d, %v, want %d, true", step, ok, Step(now))
+	}
+
+	// Lowercase secrets and spaced out codes are accepted
+	if _, ok := Validate(strings.ToLower(rfcSecret), "050 471", now); !ok {
+		t.Error("Validate rejected a spaced code with a lowercase secret")
+	}
+
+	// One step of clock drift either way is allowed, but no more
+	if step, ok := Validate(rfcSecret, code, now.Add(Period)); !ok || step != Step(now) {
+		t.Errorf("Validate() one step later = %d, %v, want %d, true", step, ok, Step(now))
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(-Period)); !ok {
+		t.Error("Validate rejected a code one step early")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(2*Period)); ok {
+		t.Error("Validate accepted a code two steps old")
+	}
+
+	for _, bad := range []string{"", "05047", "0504711", "123456"} {
+		if _, ok := Validate(rfcSecret, bad, now); ok {
+			t.Errorf("Validate accepted %q", bad)
+		}
+	}
+	if _, ok := Validate("not base32!", code, now); ok {
+		t.Error("Validate accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code with a generated secret: %v", err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+}